@@ -2,79 +2,175 @@ package google
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
 	"github.com/goplus/xgowiz/llm"
 	"github.com/goplus/xgowiz/llm/history"
+	"github.com/goplus/xgowiz/llm/retry"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 var (
-	_ llm.Provider = (*Provider)(nil)
+	_ llm.Provider          = (*Provider)(nil)
+	_ llm.StreamingProvider = (*Provider)(nil)
+	_ llm.Configurable      = (*Provider)(nil)
 )
 
+func init() {
+	llm.Register("google", func(ctx context.Context, conf *llm.ProviderConfig) (llm.Provider, error) {
+		apiKey := conf.APIKey
+		if apiKey == "" {
+			if apiKey = os.Getenv("GEMINI_API_KEY"); apiKey == "" {
+				apiKey = os.Getenv("GOOGLE_API_KEY")
+			}
+		}
+		model := conf.Model
+		if model == "" {
+			model = "gemini-2.0-flash"
+		}
+		var opts []option.ClientOption
+		if conf.BaseURL != "" {
+			opts = append(opts, option.WithEndpoint(conf.BaseURL))
+		}
+		return NewProvider(ctx, apiKey, model, opts...)
+	})
+}
+
+// Provider is safe for concurrent use: the model and the chat session of
+// a request are configured for it alone.
 type Provider struct {
 	client *genai.Client
-	model  *genai.GenerativeModel
-	chat   *genai.ChatSession
-
-	toolCallID int
+	model  string
+	opts   []llm.Option
 }
 
-func NewProvider(ctx context.Context, apiKey string, model string) (*Provider, error) {
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+func NewProvider(ctx context.Context, apiKey string, model string, opts ...option.ClientOption) (*Provider, error) {
+	client, err := genai.NewClient(ctx, append([]option.ClientOption{option.WithAPIKey(apiKey)}, opts...)...)
 	if err != nil {
 		return nil, err
 	}
-	m := client.GenerativeModel(model)
 	return &Provider{
 		client: client,
-		model:  m,
-		chat:   m.StartChat(),
+		model:  model,
 	}, nil
 }
 
-func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool) (llm.Message, error) {
-	var hist []*genai.Content
-	for _, msg := range messages {
-		for _, call := range msg.ToolCalls() {
-			hist = append(hist, &genai.Content{
-				Role: msg.Role(),
-				Parts: []genai.Part{
-					genai.FunctionCall{
-						Name: call.Name(),
-						Args: call.Arguments(),
-					},
-				},
-			})
-		}
+func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool, opts ...llm.Option) (llm.Message, error) {
+	chat, parts, err := p.prepare(prompt, messages, tools, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := chat.SendMessage(ctx, parts...)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return newMessage(resp, llm.NewToolCallIDs())
+}
 
-		if llm.IsToolResponse(msg) {
-			if historyMsg, ok := msg.(*history.HistoryMessage); ok {
-				for _, block := range historyMsg.AContent {
-					if block.Type == "tool_result" {
-						hist = append(hist, &genai.Content{
-							Role:  msg.Role(),
-							Parts: []genai.Part{genai.Text(block.Text)},
-						})
-					}
+func (p *Provider) StreamMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool, handler llm.StreamHandler, opts ...llm.Option) (llm.Message, error) {
+	chat, parts, err := p.prepare(prompt, messages, tools, opts)
+	if err != nil {
+		return nil, err
+	}
+	iter := chat.SendMessageStream(ctx, parts...)
+	ids := llm.NewToolCallIDs()
+	ncalls := 0
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			switch v := part.(type) {
+			case genai.Text:
+				if v == "" {
+					continue
+				}
+				err = handler(&llm.Chunk{Kind: llm.ChunkText, Text: string(v)})
+			case genai.FunctionCall:
+				var args []byte
+				if args, err = json.Marshal(v.Args); err != nil {
+					return nil, fmt.Errorf("error marshaling function call arguments: %w", err)
 				}
+				err = handler(&llm.Chunk{
+					Kind:      llm.ChunkToolCall,
+					Index:     ncalls,
+					ID:        ids.ID(ncalls),
+					Name:      v.Name,
+					Arguments: string(args),
+				})
+				ncalls++
+			}
+			if err != nil {
+				return nil, err
 			}
 		}
+	}
 
-		if text := strings.TrimSpace(msg.Content()); text != "" {
-			hist = append(hist, &genai.Content{
-				Role:  msg.Role(),
-				Parts: []genai.Part{genai.Text(text)},
-			})
-		}
+	resp := iter.MergedResponse()
+	if resp == nil {
+		return nil, fmt.Errorf("no response from model")
+	}
+	msg, err := newMessage(resp, ids)
+	if err != nil {
+		return nil, err
+	}
+	input, output := msg.StatUsage()
+	if err := handler(&llm.Chunk{Kind: llm.ChunkUsage, InputTokens: input, OutputTokens: output}); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func newMessage(resp *genai.GenerateContentResponse, ids llm.ToolCallIDs) (*Message, error) {
+	if len(resp.Candidates) == 0 {
+		return nil, fmt.Errorf("no response from model")
+	}
+
+	// The library enforces a generation config with 1 candidate.
+	return &Message{
+		Candidate: resp.Candidates[0],
+		ids:       ids,
+		usage:     resp.UsageMetadata,
+	}, nil
+}
+
+// prepare creates the model and the chat session of a request, and
+// returns the session with the parts to send.
+func (p *Provider) prepare(prompt string, messages []llm.Message, tools []llm.Tool, opts []llm.Option) (*genai.ChatSession, []genai.Part, error) {
+	// Gemini takes the system prompt as the system instruction of the model
+	o := p.options(opts)
+	system, messages := llm.SystemPrompt(o, messages)
+	model := p.client.GenerativeModel(p.model)
+	if system != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(system))
+	}
+	model.GenerationConfig = generationConfig(o)
+
+	hist, err := contents(messages)
+	if err != nil {
+		return nil, nil, err
+	}
+	if prompt != "" {
+		hist = append(hist, genai.NewUserContent(genai.Text(prompt)))
 	}
 
-	p.model.Tools = nil
 	for _, tool := range tools {
-		p.model.Tools = append(p.model.Tools, &genai.Tool{
+		model.Tools = append(model.Tools, &genai.Tool{
 			FunctionDeclarations: []*genai.FunctionDeclaration{
 				{
 					Name:        tool.Name,
@@ -85,31 +181,187 @@ func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []ll
 		})
 	}
 
-	p.chat.History = hist
-	// The provided messages slice (and thus history) already includes the new prompt,
-	// so we just call SendMessage with an empty string that will be trimmed by the server.
-	resp, err := p.chat.SendMessage(ctx, genai.Text(""))
-	if err != nil {
-		return nil, err
+	model.ToolConfig = toolConfig(o)
+
+	// The last content is sent, the contents before are the history. The
+	// library sends it as a user content, whatever its role.
+	n := len(hist)
+	if n == 0 {
+		return nil, nil, errors.New("google: no message to send")
 	}
+	chat := model.StartChat()
+	chat.History = hist[:n-1]
+	return chat, hist[n-1].Parts, nil
+}
 
-	if len(resp.Candidates) == 0 {
-		return nil, fmt.Errorf("no response from model")
+// contents converts messages into Gemini contents, whose roles are "user"
+// and "model". The function responses of a turn are sent in a single
+// content, named after the calls they answer or, if the calls are not in
+// messages, after the name stored in the responses.
+func contents(messages []llm.Message) ([]*genai.Content, error) {
+	var hist []*genai.Content
+	var responses *genai.Content // function responses of the current turn
+	names := make(map[string]string)
+	for _, msg := range messages {
+		if id, ok := msg.ToolResponse(); ok {
+			if responses == nil {
+				responses = &genai.Content{Role: "user"}
+				hist = append(hist, responses)
+			}
+			name := names[id]
+			if name == "" {
+				if name = resultName(msg); name == "" {
+					return nil, fmt.Errorf("google: no function call %s for its response", id)
+				}
+			}
+			responses.Parts = append(responses.Parts, genai.FunctionResponse{
+				Name:     name,
+				Response: functionResponse(toolResult(msg)),
+			})
+			continue
+		}
+
+		responses = nil
+		role := "user"
+		if r := msg.Role(); r == "assistant" || r == "model" {
+			role = "model"
+		}
+		c := &genai.Content{Role: role}
+		if llm.HasMedia(msg) {
+			c.Parts = contentParts(llm.PartsOf(msg))
+		} else if text := strings.TrimSpace(msg.Content()); text != "" {
+			c.Parts = []genai.Part{genai.Text(text)}
+		}
+		for _, call := range msg.ToolCalls() {
+			names[call.ID()] = call.Name()
+			c.Parts = append(c.Parts, genai.FunctionCall{
+				Name: call.Name(),
+				Args: call.Arguments(),
+			})
+		}
+		if len(c.Parts) > 0 {
+			hist = append(hist, c)
+		}
 	}
+	return hist, nil
+}
 
-	// The library enforces a generation config with 1 candidate.
-	m := &Message{
-		Candidate:  resp.Candidates[0],
-		toolCallID: p.toolCallID,
+// resultName returns the function name stored in a tool response, or "".
+func resultName(msg llm.Message) string {
+	switch m := msg.(type) {
+	case *Message:
+		for _, part := range m.Candidate.Content.Parts {
+			if r, ok := part.(genai.FunctionResponse); ok {
+				return r.Name
+			}
+		}
+	case *history.HistoryMessage:
+		for _, block := range m.AContent {
+			if block.Type == "tool_result" {
+				return block.Name
+			}
+		}
+	}
+	return ""
+}
+
+// toolResult returns the content of a tool response.
+func toolResult(msg llm.Message) any {
+	switch m := msg.(type) {
+	case *Message:
+		for _, part := range m.Candidate.Content.Parts {
+			if r, ok := part.(genai.FunctionResponse); ok {
+				return r.Response
+			}
+		}
+	case *history.HistoryMessage:
+		for _, block := range m.AContent {
+			if block.Type == "tool_result" {
+				if block.Content != nil {
+					return block.Content
+				}
+				return block.Text
+			}
+		}
+	}
+	return msg.Content()
+}
+
+// functionResponse converts the content of a tool response into the JSON
+// object Gemini expects. Other values are wrapped in a "content" property.
+func functionResponse(v any) map[string]any {
+	if s, ok := v.(string); ok {
+		var obj map[string]any
+		if json.Unmarshal([]byte(s), &obj) == nil && obj != nil {
+			return obj
+		}
+		return map[string]any{"content": s}
 	}
+	if obj, ok := v.(map[string]any); ok {
+		return obj
+	}
+	if data, err := json.Marshal(v); err == nil {
+		var obj map[string]any
+		if json.Unmarshal(data, &obj) == nil && obj != nil {
+			return obj
+		}
+	}
+	return map[string]any{"content": v}
+}
 
-	p.toolCallID += len(m.Candidate.FunctionCalls())
-	return m, nil
+func toolConfig(o *llm.Options) *genai.ToolConfig {
+	if o.ParallelToolCalls != nil {
+		llm.WarnUnsupported("google", "parallel_tool_calls")
+	}
+	tc := o.ToolChoice
+	if tc == nil {
+		return nil
+	}
+	cfg := new(genai.FunctionCallingConfig)
+	switch tc.Mode {
+	case llm.ToolChoiceNone:
+		cfg.Mode = genai.FunctionCallingNone
+	case llm.ToolChoiceRequired:
+		cfg.Mode = genai.FunctionCallingAny
+	case llm.ToolChoiceTool:
+		cfg.Mode = genai.FunctionCallingAny
+		cfg.AllowedFunctionNames = []string{tc.Name}
+	default:
+		cfg.Mode = genai.FunctionCallingAuto
+	}
+	return &genai.ToolConfig{FunctionCallingConfig: cfg}
+}
+
+// contentParts converts the parts of a message. Data is sent inline, and
+// URLs as file data, which Gemini only accepts for the files it stores.
+func contentParts(parts []llm.Part) []genai.Part {
+	ret := make([]genai.Part, 0, len(parts))
+	for _, part := range parts {
+		switch {
+		case part.Type == llm.PartText:
+			ret = append(ret, genai.Text(part.Text))
+		case part.Data == nil:
+			ret = append(ret, genai.FileData{MIMEType: part.MediaType, URI: part.URL})
+		default:
+			ret = append(ret, genai.Blob{MIMEType: part.MediaType, Data: part.Data})
+		}
+	}
+	return ret
 }
 
+// CreateToolResponse creates the function response answering the call
+// toolCallID. Its function name is set from the call when the history is
+// sent.
 func (p *Provider) CreateToolResponse(toolCallID string, content any) (llm.Message, error) {
-	// UNUSED: Nothing in root.go calls this.
-	return nil, nil
+	return &Message{
+		Candidate: &genai.Candidate{
+			Content: &genai.Content{
+				Role:  "user",
+				Parts: []genai.Part{genai.FunctionResponse{Response: functionResponse(content)}},
+			},
+		},
+		toolCallID: toolCallID,
+	}, nil
 }
 
 func (p *Provider) SupportsTools() bool {
@@ -118,7 +370,75 @@ func (p *Provider) SupportsTools() bool {
 }
 
 func (p *Provider) Name() string {
-	return "Google"
+	return "google"
+}
+
+// SetOptions sets the default options of all requests.
+func (p *Provider) SetOptions(opts ...llm.Option) {
+	p.opts = opts
+}
+
+func (p *Provider) options(opts []llm.Option) *llm.Options {
+	return llm.NewOptions(append(p.opts[:len(p.opts):len(p.opts)], opts...)...)
+}
+
+func generationConfig(o *llm.Options) genai.GenerationConfig {
+	var cfg genai.GenerationConfig
+	if o.MaxTokens > 0 {
+		cfg.SetMaxOutputTokens(int32(o.MaxTokens))
+	}
+	if o.Temperature != nil {
+		cfg.SetTemperature(float32(*o.Temperature))
+	}
+	if o.TopP != nil {
+		cfg.SetTopP(float32(*o.TopP))
+	}
+	if o.TopK != nil {
+		cfg.SetTopK(int32(*o.TopK))
+	}
+	cfg.StopSequences = o.Stop
+	if o.Seed != nil {
+		llm.WarnUnsupported("google", "seed")
+	}
+	if o.PresencePenalty != nil {
+		llm.WarnUnsupported("google", "presence_penalty")
+	}
+	if o.FrequencyPenalty != nil {
+		llm.WarnUnsupported("google", "frequency_penalty")
+	}
+	if o.Thinking != 0 {
+		llm.WarnUnsupported("google", "thinking")
+	}
+	if f := o.ResponseFormat; f != nil {
+		cfg.ResponseMIMEType = "application/json"
+		if f.Schema != nil {
+			cfg.ResponseSchema = propertyToGoogleSchema(f.Schema)
+		}
+	}
+	return cfg
+}
+
+// wrapError converts an error reported by the Gemini API into an
+// *llm.Error.
+func wrapError(err error) error {
+	var ge *googleapi.Error
+	if !errors.As(err, &ge) {
+		return err
+	}
+
+	// The body carries the gRPC status name, e.g. RESOURCE_EXHAUSTED.
+	var body struct {
+		Error struct {
+			Status string `json:"status"`
+		} `json:"error"`
+	}
+	json.Unmarshal([]byte(ge.Body), &body)
+	e := llm.NewError("google", ge.Code, strings.ToLower(body.Error.Status), ge.Message)
+	if d, ok := retry.RetryAfter(ge.Header, time.Now()); ok {
+		e.RetryAfter = d
+	}
+	e.Err = err
+	return e
 }
 
 func translateToGoogleSchema(schema llm.Schema) *genai.Schema {
@@ -146,30 +466,58 @@ func translateToGoogleSchema(schema llm.Schema) *genai.Schema {
 }
 
 func propertyToGoogleSchema(properties map[string]any) *genai.Schema {
-	s := &genai.Schema{Type: toType(properties["type"].(string))}
+	typ, _ := properties["type"].(string)
+	s := &genai.Schema{Type: toType(typ)}
 	if desc, ok := properties["description"].(string); ok {
 		s.Description = desc
 	}
+	if enum, ok := properties["enum"].([]any); ok {
+		for _, e := range enum {
+			s.Enum = append(s.Enum, fmt.Sprint(e))
+		}
+	}
 
 	// Objects and arrays need to have their properties recursively mapped.
 	if s.Type == genai.TypeObject {
-		objectProperties := properties["properties"].(map[string]any)
+		objectProperties, _ := properties["properties"].(map[string]any)
 		s.Properties = make(map[string]*genai.Schema)
 		for name, prop := range objectProperties {
 			s.Properties[name] = propertyToGoogleSchema(prop.(map[string]any))
 		}
+		s.Required = stringList(properties["required"])
 	} else if s.Type == genai.TypeArray {
-		itemProperties := properties["items"].(map[string]any)
-		s.Items = propertyToGoogleSchema(itemProperties)
+		if itemProperties, ok := properties["items"].(map[string]any); ok {
+			s.Items = propertyToGoogleSchema(itemProperties)
+		}
 	}
 
 	return s
 }
 
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []any:
+		ret := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
 func toType(typ string) genai.Type {
 	switch typ {
 	case "string":
 		return genai.TypeString
+	case "integer":
+		return genai.TypeInteger
+	case "number":
+		return genai.TypeNumber
 	case "boolean":
 		return genai.TypeBoolean
 	case "object":
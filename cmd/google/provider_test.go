@@ -0,0 +1,222 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/history"
+)
+
+func modelMessage(ids llm.ToolCallIDs, parts ...genai.Part) *Message {
+	return &Message{
+		Candidate: &genai.Candidate{Content: &genai.Content{Role: "model", Parts: parts}},
+		ids:       ids,
+	}
+}
+
+func call(name string, args map[string]any) genai.FunctionCall {
+	return genai.FunctionCall{Name: name, Args: args}
+}
+
+func response(id, content string) llm.Message {
+	msg, _ := new(Provider).CreateToolResponse(id, content)
+	return msg
+}
+
+func TestMessageToolCalls(t *testing.T) {
+	const ids = llm.ToolCallIDs("call_t")
+	m := modelMessage(ids, genai.Text("checking"),
+		call("read", map[string]any{"path": "a.xgo"}),
+		call("read", map[string]any{"path": "b.xgo"}),
+		call("build", nil))
+	want := []string{"call_t_0", "call_t_1", "call_t_2"}
+	for n := 0; n < 2; n++ { // the IDs do not change between calls
+		calls := m.ToolCalls()
+		if len(calls) != len(want) {
+			t.Fatalf("ToolCalls() returned %d calls, want %d", len(calls), len(want))
+		}
+		for i, c := range calls {
+			if c.ID() != want[i] {
+				t.Errorf("call %d: ID = %s, want %s", i, c.ID(), want[i])
+			}
+		}
+	}
+}
+
+func TestContents(t *testing.T) {
+	const ids = llm.ToolCallIDs("call_t")
+	tests := []struct {
+		name     string
+		messages []llm.Message
+		want     []*genai.Content
+	}{
+		{
+			name: "results in order",
+			messages: []llm.Message{
+				modelMessage(ids, call("read", map[string]any{"path": "a"}), call("build", nil)),
+				response(ids.ID(0), "package a"),
+				response(ids.ID(1), `{"ok":true}`),
+			},
+			want: []*genai.Content{
+				{Role: "model", Parts: []genai.Part{call("read", map[string]any{"path": "a"}), call("build", nil)}},
+				{Role: "user", Parts: []genai.Part{
+					genai.FunctionResponse{Name: "read", Response: map[string]any{"content": "package a"}},
+					genai.FunctionResponse{Name: "build", Response: map[string]any{"ok": true}},
+				}},
+			},
+		},
+		{
+			name: "results out of order",
+			messages: []llm.Message{
+				modelMessage(ids, genai.Text("let me see"), call("read", nil), call("build", nil), call("test", nil)),
+				response(ids.ID(2), "PASS"),
+				response(ids.ID(0), "src"),
+				response(ids.ID(1), "ok"),
+			},
+			want: []*genai.Content{
+				{Role: "model", Parts: []genai.Part{genai.Text("let me see"), call("read", nil), call("build", nil), call("test", nil)}},
+				{Role: "user", Parts: []genai.Part{
+					genai.FunctionResponse{Name: "test", Response: map[string]any{"content": "PASS"}},
+					genai.FunctionResponse{Name: "read", Response: map[string]any{"content": "src"}},
+					genai.FunctionResponse{Name: "build", Response: map[string]any{"content": "ok"}},
+				}},
+			},
+		},
+		{
+			name: "two turns",
+			messages: []llm.Message{
+				modelMessage("call_a", call("read", nil), call("read", nil)),
+				response("call_a_0", "one"),
+				response("call_a_1", "two"),
+				modelMessage("call_b", call("build", nil), call("test", nil)),
+				response("call_b_1", "PASS"),
+				response("call_b_0", "ok"),
+				modelMessage("", genai.Text("done")),
+			},
+			want: []*genai.Content{
+				{Role: "model", Parts: []genai.Part{call("read", nil), call("read", nil)}},
+				{Role: "user", Parts: []genai.Part{
+					genai.FunctionResponse{Name: "read", Response: map[string]any{"content": "one"}},
+					genai.FunctionResponse{Name: "read", Response: map[string]any{"content": "two"}},
+				}},
+				{Role: "model", Parts: []genai.Part{call("build", nil), call("test", nil)}},
+				{Role: "user", Parts: []genai.Part{
+					genai.FunctionResponse{Name: "test", Response: map[string]any{"content": "PASS"}},
+					genai.FunctionResponse{Name: "build", Response: map[string]any{"content": "ok"}},
+				}},
+				{Role: "model", Parts: []genai.Part{genai.Text("done")}},
+			},
+		},
+		{
+			name: "names stored in the results",
+			messages: []llm.Message{
+				&Message{
+					Candidate: &genai.Candidate{Content: &genai.Content{Role: "user", Parts: []genai.Part{
+						genai.FunctionResponse{Name: "read", Response: map[string]any{"content": "src"}},
+					}}},
+					toolCallID: "call_x_0",
+				},
+				&history.HistoryMessage{ARole: "tool", AContent: []history.ContentBlock{
+					{Type: "tool_result", ToolUseID: "call_x_1", Name: "build", Text: "ok"},
+				}},
+			},
+			want: []*genai.Content{
+				{Role: "user", Parts: []genai.Part{
+					genai.FunctionResponse{Name: "read", Response: map[string]any{"content": "src"}},
+					genai.FunctionResponse{Name: "build", Response: map[string]any{"content": "ok"}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := contents(tt.messages)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("contents() =")
+				for _, c := range got {
+					t.Errorf("  %s: %#v", c.Role, c.Parts)
+				}
+			}
+		})
+	}
+}
+
+func TestContentsUnknownCall(t *testing.T) {
+	_, err := contents([]llm.Message{modelMessage("call_a", call("read", nil)), response("call_b_0", "src")})
+	if err == nil || !strings.Contains(err.Error(), "no function call call_b_0") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	p, err := NewProvider(context.Background(), "key", "gemini-2.0-flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := history.NewTextMessage("user", "question")
+	answer := modelMessage("", genai.Text("answer"))
+	tests := []struct {
+		name     string
+		prompt   string
+		messages []llm.Message
+		history  int
+		parts    []genai.Part
+	}{
+		{"prompt", "next", []llm.Message{user, answer}, 2, []genai.Part{genai.Text("next")}},
+		{"user turn", "", []llm.Message{answer, user}, 1, []genai.Part{genai.Text("question")}},
+		{"model turn", "", []llm.Message{user, answer}, 1, []genai.Part{genai.Text("answer")}},
+	}
+	for _, tt := range tests {
+		chat, parts, err := p.prepare(tt.prompt, tt.messages, nil, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(chat.History) != tt.history || !reflect.DeepEqual(parts, tt.parts) {
+			t.Errorf("%s: %d contents of history, parts %v", tt.name, len(chat.History), parts)
+		}
+	}
+	if _, _, err = p.prepare("", nil, nil, nil); err == nil {
+		t.Error("prepare without messages succeeded")
+	}
+	if name := p.Name(); name != "google" {
+		t.Errorf("Name() = %s, want google", name)
+	}
+}
+
+func TestPrepareConcurrent(t *testing.T) {
+	p, err := NewProvider(context.Background(), "key", "gemini-2.0-flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			system := fmt.Sprint("system ", i)
+			hist := []llm.Message{modelMessage("", genai.Text(fmt.Sprint("answer ", i)))}
+			chat, parts, err := p.prepare(fmt.Sprint("question ", i), hist, nil, []llm.Option{llm.WithSystem(system)})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(chat.History) != 1 || chat.History[0].Parts[0] != genai.Text(fmt.Sprint("answer ", i)) {
+				t.Errorf("request %d: history = %v", i, chat.History)
+			}
+			if len(parts) != 1 || parts[0] != genai.Text(fmt.Sprint("question ", i)) {
+				t.Errorf("request %d: parts = %v", i, parts)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
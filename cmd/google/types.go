@@ -1,7 +1,7 @@
 package google
 
 import (
-	"fmt"
+	"encoding/json"
 	"strings"
 
 	"github.com/google/generative-ai-go/genai"
@@ -11,7 +11,7 @@ import (
 type ToolCall struct {
 	genai.FunctionCall
 
-	toolCallID int
+	id string
 }
 
 func (t *ToolCall) Name() string {
@@ -23,13 +23,15 @@ func (t *ToolCall) Arguments() map[string]any {
 }
 
 func (t *ToolCall) ID() string {
-	return fmt.Sprintf("Tool<%d>", t.toolCallID)
+	return t.id
 }
 
 type Message struct {
 	*genai.Candidate
 
-	toolCallID int
+	ids        llm.ToolCallIDs // identifies the function calls
+	toolCallID string          // of a function response
+	usage      *genai.UsageMetadata
 }
 
 func (m *Message) Role() string {
@@ -39,8 +41,11 @@ func (m *Message) Role() string {
 func (m *Message) Content() string {
 	var sb strings.Builder
 	for _, part := range m.Candidate.Content.Parts {
-		if text, ok := part.(genai.Text); ok {
-			sb.WriteString(string(text))
+		switch v := part.(type) {
+		case genai.Text:
+			sb.WriteString(string(v))
+		case genai.FunctionResponse:
+			sb.WriteString(responseText(v.Response))
 		}
 	}
 	return sb.String()
@@ -49,20 +54,43 @@ func (m *Message) Content() string {
 func (m *Message) ToolCalls() []llm.ToolCall {
 	var calls []llm.ToolCall
 	for i, call := range m.Candidate.FunctionCalls() {
-		calls = append(calls, &ToolCall{call, m.toolCallID + i})
+		calls = append(calls, &ToolCall{call, m.ids.ID(i)})
 	}
 	return calls
 }
 
 func (m *Message) ToolResponse() (toolCallID string, is bool) {
 	for _, part := range m.Candidate.Content.Parts {
-		if _, ok := part.(*genai.FunctionResponse); ok {
-			return fmt.Sprintf("Tool<%d>", m.toolCallID), true
+		if _, ok := part.(genai.FunctionResponse); ok {
+			return m.toolCallID, true
 		}
 	}
 	return
 }
 
 func (m *Message) StatUsage() (input int, output int) {
-	return 0, 0
+	u := m.Usage()
+	return u.InputTokens, u.OutputTokens
+}
+
+// Usage implements llm.UsageReporter.
+func (m *Message) Usage() llm.Usage {
+	if m.usage == nil {
+		return llm.Usage{}
+	}
+	return llm.Usage{
+		InputTokens:     int(m.usage.PromptTokenCount),
+		OutputTokens:    int(m.usage.CandidatesTokenCount),
+		CacheReadTokens: int(m.usage.CachedContentTokenCount),
+	}
+}
+
+// responseText returns the text of a function response, unwrapping the
+// content wrapped by functionResponse.
+func responseText(resp map[string]any) string {
+	if s, ok := resp["content"].(string); ok && len(resp) == 1 {
+		return s
+	}
+	data, _ := json.Marshal(resp)
+	return string(data)
 }
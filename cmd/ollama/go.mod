@@ -7,7 +7,7 @@ toolchain go1.24.2
 require (
 	github.com/goplus/xgowiz v0.0.0-00010101000000-000000000000
 	github.com/ollama/ollama v0.5.13
-	github.com/qiniu/x v1.13.19
+	github.com/qiniu/x v1.15.1
 )
 
 replace github.com/goplus/xgowiz => ../../
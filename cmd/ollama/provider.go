@@ -1,10 +1,19 @@
+// Package ollama implements an llm.Provider for models served by Ollama.
+//
+// Reasoning support is limited: the reasoning that models such as
+// deepseek-r1 enclose in <think> tags is split from the answer, but the
+// API cannot enable or budget it. WithThinking is ignored with a warning.
 package ollama
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/goplus/xgowiz/llm"
@@ -18,13 +27,35 @@ func boolPtr(b bool) *bool {
 }
 
 var (
-	_ llm.Provider = (*Provider)(nil)
+	_ llm.Provider          = (*Provider)(nil)
+	_ llm.StreamingProvider = (*Provider)(nil)
+	_ llm.Configurable      = (*Provider)(nil)
 )
 
+func init() {
+	llm.Register("ollama", func(ctx context.Context, conf *llm.ProviderConfig) (llm.Provider, error) {
+		if conf.Model == "" {
+			return nil, fmt.Errorf("ollama: no model specified")
+		}
+		if conf.BaseURL == "" {
+			return NewProvider(conf.Model)
+		}
+		base, err := url.Parse(conf.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		return &Provider{
+			client: api.NewClient(base, http.DefaultClient),
+			model:  conf.Model,
+		}, nil
+	})
+}
+
 // Provider implements the Provider interface for Ollama
 type Provider struct {
 	client *api.Client
 	model  string
+	opts   []llm.Option
 }
 
 // NewProvider creates a new Ollama provider
@@ -44,14 +75,143 @@ func (p *Provider) SendMessage(
 	prompt string,
 	messages []llm.Message,
 	tools []llm.Tool,
+	opts ...llm.Option,
 ) (llm.Message, error) {
+	req, o := p.chatRequest(prompt, messages, tools, opts)
+	req.Stream = boolPtr(false)
+
+	var response api.Message
+	var metrics api.Metrics
+	err := p.client.Chat(ctx, req, func(r api.ChatResponse) error {
+		if r.Done {
+			response, metrics = r.Message, r.Metrics
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	if singleCall(o) && len(response.ToolCalls) > 1 {
+		response.ToolCalls = response.ToolCalls[:1]
+	}
+
+	return &OllamaMessage{Message: response, Metrics: metrics, CallIDs: llm.NewToolCallIDs()}, nil
+}
+
+func (p *Provider) StreamMessage(
+	ctx context.Context,
+	prompt string,
+	messages []llm.Message,
+	tools []llm.Tool,
+	handler llm.StreamHandler,
+	opts ...llm.Option,
+) (llm.Message, error) {
+	req, o := p.chatRequest(prompt, messages, tools, opts)
+	req.Stream = boolPtr(true)
+
+	var response api.Message
+	var metrics api.Metrics
+	var content strings.Builder
+	var think thinkSplitter
+	ids := llm.NewToolCallIDs()
+	err := p.client.Chat(ctx, req, func(r api.ChatResponse) error {
+		if r.Message.Role != "" {
+			response.Role = r.Message.Role
+		}
+		if r.Message.Content != "" {
+			content.WriteString(r.Message.Content)
+			reasoning, answer := think.write(r.Message.Content)
+			if err := emitText(handler, reasoning, answer); err != nil {
+				return err
+			}
+		}
+		for _, call := range r.Message.ToolCalls {
+			if singleCall(o) && len(response.ToolCalls) > 0 {
+				break
+			}
+			args, err := json.Marshal(call.Function.Arguments)
+			if err != nil {
+				return fmt.Errorf("error marshaling tool call arguments: %w", err)
+			}
+			err = handler(&llm.Chunk{
+				Kind:      llm.ChunkToolCall,
+				Index:     len(response.ToolCalls),
+				ID:        ids.ID(len(response.ToolCalls)),
+				Name:      call.Function.Name,
+				Arguments: string(args),
+			})
+			if err != nil {
+				return err
+			}
+			response.ToolCalls = append(response.ToolCalls, call)
+		}
+		response.Images = append(response.Images, r.Message.Images...)
+		if r.Done {
+			metrics = r.Metrics
+			reasoning, answer := think.flush()
+			if err := emitText(handler, reasoning, answer); err != nil {
+				return err
+			}
+			return handler(&llm.Chunk{
+				Kind:         llm.ChunkUsage,
+				InputTokens:  r.PromptEvalCount,
+				OutputTokens: r.EvalCount,
+			})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	response.Content = content.String()
+	return &OllamaMessage{Message: response, Metrics: metrics, CallIDs: ids}, nil
+}
+
+// emitText delivers the reasoning and answer deltas to handler.
+func emitText(handler llm.StreamHandler, reasoning, answer string) error {
+	if reasoning != "" {
+		if err := handler(&llm.Chunk{Kind: llm.ChunkReasoning, Text: reasoning}); err != nil {
+			return err
+		}
+	}
+	if answer != "" {
+		return handler(&llm.Chunk{Kind: llm.ChunkText, Text: answer})
+	}
+	return nil
+}
+
+func (p *Provider) chatRequest(
+	prompt string,
+	messages []llm.Message,
+	tools []llm.Tool,
+	opts []llm.Option,
+) (*api.ChatRequest, *llm.Options) {
 	log.Debug("creating message",
 		"prompt", prompt,
 		"num_messages", len(messages),
 		"num_tools", len(tools))
 
+	o := p.options(opts)
+	system, messages := llm.SystemPrompt(o, messages)
+	messages = pairResults(messages)
+	tools, instruction := chooseTools(tools, o.ToolChoice)
+	if instruction != "" {
+		system = strings.TrimSpace(system + "\n\n" + instruction)
+	}
+
 	// Convert generic messages to Ollama format
-	ollamaMessages := make([]api.Message, 0, len(messages)+1)
+	ollamaMessages := make([]api.Message, 0, len(messages)+2)
+
+	// Ollama takes the system prompt as the first message
+	if system != "" {
+		ollamaMessages = append(ollamaMessages, api.Message{
+			Role:    "system",
+			Content: system,
+		})
+	}
 
 	// Add existing messages
 	for _, msg := range messages {
@@ -74,10 +234,8 @@ func (p *Provider) SendMessage(
 				content = msg.Content()
 			}
 
-			if content == "" {
-				continue
-			}
-
+			// Empty results are sent too, so that every call has its
+			// result
 			ollamaMsg := api.Message{
 				Role:    "tool",
 				Content: content,
@@ -86,8 +244,8 @@ func (p *Provider) SendMessage(
 			continue
 		}
 
-		// Skip completely empty messages (no content and no tool calls)
-		if msg.Content() == "" && len(msg.ToolCalls()) == 0 {
+		// Skip completely empty messages (no content, tool calls or media)
+		if msg.Content() == "" && len(msg.ToolCalls()) == 0 && !llm.HasMedia(msg) {
 			continue
 		}
 
@@ -95,6 +253,9 @@ func (p *Provider) SendMessage(
 			Role:    msg.Role(),
 			Content: msg.Content(),
 		}
+		if llm.HasMedia(msg) {
+			addParts(&ollamaMsg, llm.PartsOf(msg))
+		}
 
 		// Add tool calls for assistant messages
 		if msg.Role() == "assistant" {
@@ -150,33 +311,153 @@ func (p *Provider) SendMessage(
 		}
 	}
 
-	var response api.Message
-	log.Debug("creating message",
-		"prompt", prompt,
-		"num_messages", len(messages),
-		"num_tools", len(tools))
-
 	log.Debug("sending messages to Ollama",
 		"messages", ollamaMessages,
 		"num_tools", len(tools))
 
-	err := p.client.Chat(ctx, &api.ChatRequest{
+	req := &api.ChatRequest{
 		Model:    p.model,
 		Messages: ollamaMessages,
 		Tools:    ollamaTools,
-		Stream:   boolPtr(false),
-	}, func(r api.ChatResponse) error {
-		if r.Done {
-			response = r.Message
+		Options:  convertOptions(o),
+	}
+	if f := o.ResponseFormat; f != nil {
+		req.Format = json.RawMessage(`"json"`)
+		if f.Schema != nil {
+			if schema, err := json.Marshal(f.Schema); err == nil {
+				req.Format = schema
+			}
 		}
-		return nil
-	})
+	}
+	return req, o
+}
 
-	if err != nil {
-		return nil, err
+// addParts adds the images of parts to msg, and the text documents to its
+// content. Ollama takes neither image URLs nor other documents.
+func addParts(msg *api.Message, parts []llm.Part) {
+	for _, part := range parts {
+		switch {
+		case part.Type == llm.PartText:
+			// already in the content
+		case part.Data == nil:
+			llm.WarnUnsupported("ollama", part.Type+" URL")
+		case part.Type == llm.PartImage:
+			msg.Images = append(msg.Images, api.ImageData(part.Data))
+		case part.IsText():
+			msg.Content += fmt.Sprintf("\n\n%s:\n%s", part.Name, part.Data)
+		default:
+			llm.WarnUnsupported("ollama", "document of type "+part.MediaType)
+		}
+	}
+}
+
+// pairResults orders the tool results following a message as its tool
+// calls, since Ollama pairs them by position rather than by ID. Results
+// of unknown calls are kept after the others.
+func pairResults(messages []llm.Message) []llm.Message {
+	var ret []llm.Message
+	for i := 0; i < len(messages); {
+		msg := messages[i]
+		ret = append(ret, msg)
+		i++
+		calls := msg.ToolCalls()
+		if len(calls) == 0 {
+			continue
+		}
+		j := i
+		for j < len(messages) && llm.IsToolResponse(messages[j]) {
+			j++
+		}
+		results := append([]llm.Message(nil), messages[i:j]...)
+		index := func(m llm.Message) int {
+			id, _ := m.ToolResponse()
+			for k, call := range calls {
+				if call.ID() == id {
+					return k
+				}
+			}
+			return len(calls)
+		}
+		sort.SliceStable(results, func(a, b int) bool {
+			return index(results[a]) < index(results[b])
+		})
+		ret = append(ret, results...)
+		i = j
+	}
+	return ret
+}
+
+// chooseTools emulates the tool choice, which Ollama does not support, by
+// removing the tools that must not be called and instructing the model.
+func chooseTools(tools []llm.Tool, tc *llm.ToolChoice) ([]llm.Tool, string) {
+	if tc == nil || len(tools) == 0 {
+		return tools, ""
+	}
+	switch tc.Mode {
+	case llm.ToolChoiceNone:
+		return nil, ""
+	case llm.ToolChoiceRequired:
+		return tools, "You must answer by calling one of the tools."
+	case llm.ToolChoiceTool:
+		for _, t := range tools {
+			if t.Name == tc.Name {
+				return []llm.Tool{t}, fmt.Sprintf("You must answer by calling the tool %s.", tc.Name)
+			}
+		}
 	}
+	return tools, ""
+}
+
+// singleCall reports whether the tool calls after the first of a response
+// are dropped, which emulates forbidding parallel tool calls.
+func singleCall(o *llm.Options) bool {
+	return o.ParallelToolCalls != nil && !*o.ParallelToolCalls
+}
+
+// SetOptions sets the default options of all requests.
+func (p *Provider) SetOptions(opts ...llm.Option) {
+	p.opts = opts
+}
 
-	return &OllamaMessage{Message: response}, nil
+func (p *Provider) options(opts []llm.Option) *llm.Options {
+	return llm.NewOptions(append(p.opts[:len(p.opts):len(p.opts)], opts...)...)
+}
+
+// Helper function to convert generation parameters to Ollama's model options
+func convertOptions(o *llm.Options) map[string]any {
+	ret := make(map[string]any)
+	if o.MaxTokens > 0 {
+		ret["num_predict"] = o.MaxTokens
+	}
+	if o.Temperature != nil {
+		ret["temperature"] = *o.Temperature
+	}
+	if o.TopP != nil {
+		ret["top_p"] = *o.TopP
+	}
+	if o.TopK != nil {
+		ret["top_k"] = *o.TopK
+	}
+	if len(o.Stop) > 0 {
+		ret["stop"] = o.Stop
+	}
+	if o.Seed != nil {
+		ret["seed"] = *o.Seed
+	}
+	if o.PresencePenalty != nil {
+		ret["presence_penalty"] = *o.PresencePenalty
+	}
+	if o.FrequencyPenalty != nil {
+		ret["frequency_penalty"] = *o.FrequencyPenalty
+	}
+	if o.Thinking != 0 {
+		// Reasoning models think on their own, without a budget
+		llm.WarnUnsupported("ollama", "thinking")
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
 }
 
 func (p *Provider) SupportsTools() bool {
@@ -240,7 +521,22 @@ func (p *Provider) CreateToolResponse(
 	return msg, nil
 }
 
-// Helper function to convert properties to Ollama's format
+// wrapError converts an error reported by the Ollama server into an
+// *llm.Error.
+func wrapError(err error) error {
+	var se api.StatusError
+	if errors.As(err, &se) {
+		e := llm.NewError("ollama", se.StatusCode, "", se.ErrorMessage)
+		e.Err = err
+		return e
+	}
+	return err
+}
+
+// convertProperties converts the properties of an input schema to Ollama's
+// format. The API only carries the type, description and enum of top-level
+// properties, so the schema of array items and nested objects is appended
+// to the description for the model to follow.
 func convertProperties(props map[string]any) map[string]struct {
 	Type        string   `json:"type"`
 	Description string   `json:"description"`
@@ -262,6 +558,9 @@ func convertProperties(props map[string]any) map[string]struct {
 				Type:        getString(propMap, "type"),
 				Description: getString(propMap, "description"),
 			}
+			if nested := nestedSchema(propMap); nested != "" {
+				prop.Description = strings.TrimSpace(prop.Description + " JSON schema: " + nested)
+			}
 
 			// Handle enum if present
 			if enumRaw, ok := propMap["enum"].([]any); ok {
@@ -279,6 +578,26 @@ func convertProperties(props map[string]any) map[string]struct {
 	return result
 }
 
+// nestedSchema returns the JSON encoding of the parts of the property
+// schema prop that describe array items or object members, or "" if it has
+// none.
+func nestedSchema(prop map[string]any) string {
+	nested := make(map[string]any)
+	for _, key := range []string{"items", "properties", "required", "additionalProperties"} {
+		if v, ok := prop[key]; ok {
+			nested[key] = v
+		}
+	}
+	if len(nested) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(nested)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
 // Helper function to safely get string values from map
 func getString(m map[string]any, key string) string {
 	if v, ok := m[key].(string); ok {
@@ -0,0 +1,189 @@
+package ollama
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/goplus/xgowiz/llm"
+	api "github.com/ollama/ollama/api"
+)
+
+func assistant(ids llm.ToolCallIDs, names ...string) *OllamaMessage {
+	msg := &OllamaMessage{Message: api.Message{Role: "assistant"}, CallIDs: ids}
+	for _, name := range names {
+		msg.Message.ToolCalls = append(msg.Message.ToolCalls, api.ToolCall{
+			Function: api.ToolCallFunction{Name: name},
+		})
+	}
+	return msg
+}
+
+func result(id string) *OllamaMessage {
+	return &OllamaMessage{Message: api.Message{Role: "tool", Content: id}, ToolCallID: id}
+}
+
+func user(text string) *OllamaMessage {
+	return &OllamaMessage{Message: api.Message{Role: "user", Content: text}}
+}
+
+// describe lists the messages as their text or the IDs of their results.
+func describe(messages []llm.Message) string {
+	var s []string
+	for _, msg := range messages {
+		if id, ok := msg.ToolResponse(); ok {
+			s = append(s, id)
+		} else if calls := msg.ToolCalls(); len(calls) > 0 {
+			s = append(s, "calls")
+		} else {
+			s = append(s, msg.Content())
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func TestMessageToolCalls(t *testing.T) {
+	msg := assistant("call_t", "read", "read", "build")
+	want := []string{"call_t_0", "call_t_1", "call_t_2"}
+	for n := 0; n < 2; n++ { // the IDs do not change between calls
+		calls := msg.ToolCalls()
+		if len(calls) != len(want) {
+			t.Fatalf("ToolCalls() returned %d calls, want %d", len(calls), len(want))
+		}
+		for i, c := range calls {
+			if c.ID() != want[i] {
+				t.Errorf("call %d: ID = %s, want %s", i, c.ID(), want[i])
+			}
+		}
+	}
+}
+
+func TestMessageToolCallsLazyIDs(t *testing.T) {
+	msg := assistant("", "read", "build")
+	ids := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i] = msg.ToolCalls()[1].ID()
+		}(i)
+	}
+	wg.Wait()
+	if !strings.HasPrefix(ids[0], "call_") || !strings.HasSuffix(ids[0], "_1") {
+		t.Errorf("ID = %s", ids[0])
+	}
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("IDs differ: %s and %s", id, ids[0])
+		}
+	}
+	if other := assistant("", "read").ToolCalls()[0].ID(); other == msg.ToolCalls()[0].ID() {
+		t.Errorf("two messages share the ID %s", other)
+	}
+	if calls := user("q").ToolCalls(); calls != nil || user("q").CallIDs != "" {
+		t.Errorf("ToolCalls() of a user message = %v", calls)
+	}
+}
+
+func TestNewOllamaToolCall(t *testing.T) {
+	call := api.ToolCall{Function: api.ToolCallFunction{Name: "read"}}
+	a, b := NewOllamaToolCall(call), NewOllamaToolCall(call)
+	if a.ID() == "" || a.ID() == b.ID() || a.Name() != "read" {
+		t.Errorf("NewOllamaToolCall() = %s %s, %s", a.ID(), a.Name(), b.ID())
+	}
+	if c := NewOllamaToolCallWithID(call, "id"); c.ID() != "id" {
+		t.Errorf("NewOllamaToolCallWithID() = %s", c.ID())
+	}
+}
+
+func TestChatRequestEmptyResult(t *testing.T) {
+	p := &Provider{model: "m"}
+	call := assistant("call_a", "write")
+	empty := &OllamaMessage{Message: api.Message{Role: "tool"}, ToolCallID: "call_a_0"}
+	req, _ := p.chatRequest("", []llm.Message{user("q"), call, empty}, nil, nil)
+	var roles []string
+	for _, m := range req.Messages {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, " "); got != "user assistant tool" {
+		t.Errorf("roles = %s, want the empty result sent", got)
+	}
+}
+
+func TestPairResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []llm.Message
+		want     string
+	}{
+		{
+			name: "in order",
+			messages: []llm.Message{
+				user("q"), assistant("call_a", "read", "build"), result("call_a_0"), result("call_a_1"),
+			},
+			want: "q calls call_a_0 call_a_1",
+		},
+		{
+			name: "reversed",
+			messages: []llm.Message{
+				assistant("call_a", "read", "build", "test"),
+				result("call_a_2"), result("call_a_1"), result("call_a_0"),
+			},
+			want: "calls call_a_0 call_a_1 call_a_2",
+		},
+		{
+			name: "unknown result last",
+			messages: []llm.Message{
+				assistant("call_a", "read", "build"),
+				result("other"), result("call_a_1"), result("call_a_0"),
+			},
+			want: "calls call_a_0 call_a_1 other",
+		},
+		{
+			name: "two turns",
+			messages: []llm.Message{
+				user("q"),
+				assistant("call_a", "read", "read"), result("call_a_1"), result("call_a_0"),
+				assistant("call_b", "build", "test"), result("call_b_1"), result("call_b_0"),
+				user("thanks"),
+			},
+			want: "q calls call_a_0 call_a_1 calls call_b_0 call_b_1 thanks",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describe(pairResults(tt.messages)); got != tt.want {
+				t.Errorf("pairResults() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertProperties(t *testing.T) {
+	props := map[string]any{
+		"path": map[string]any{"type": "string", "description": "file path", "enum": []any{"a", "b"}},
+		"files": map[string]any{
+			"type":        "array",
+			"description": "files to write",
+			"items": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"name": map[string]any{"type": "string"}},
+				"required":   []string{"name"},
+			},
+		},
+		"env": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+	}
+	got := convertProperties(props)
+	if p := got["path"]; p.Type != "string" || p.Description != "file path" || strings.Join(p.Enum, ",") != "a,b" {
+		t.Errorf("path = %+v", p)
+	}
+	want := `files to write JSON schema: {"items":{"properties":{"name":{"type":"string"}},"required":["name"],"type":"object"}}`
+	if p := got["files"]; p.Type != "array" || p.Description != want {
+		t.Errorf("files = %+v, want description %s", p, want)
+	}
+	want = `JSON schema: {"additionalProperties":{"type":"string"}}`
+	if p := got["env"]; p.Type != "object" || p.Description != want {
+		t.Errorf("env = %+v, want description %s", p, want)
+	}
+}
@@ -0,0 +1,63 @@
+package ollama
+
+import "strings"
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// thinkSplitter separates the reasoning that models such as deepseek-r1
+// enclose in <think> tags from the answer of a streamed response.
+type thinkSplitter struct {
+	buf   string
+	state int // 0: undecided, 1: thinking, 2: answering
+}
+
+// write returns the reasoning and answer deltas of the text delta. Text
+// that may be part of a tag is held until the next call.
+func (s *thinkSplitter) write(text string) (reasoning, answer string) {
+	switch s.state {
+	case 0:
+		s.buf += text
+		t := strings.TrimLeft(s.buf, " \t\r\n")
+		if len(t) < len(thinkOpen) && strings.HasPrefix(thinkOpen, t) {
+			return "", ""
+		}
+		if !strings.HasPrefix(t, thinkOpen) {
+			s.state = 2
+			answer, s.buf = s.buf, ""
+			return
+		}
+		s.state, s.buf, text = 1, "", t[len(thinkOpen):]
+		fallthrough
+	case 1:
+		s.buf += text
+		if i := strings.Index(s.buf, thinkClose); i >= 0 {
+			reasoning = s.buf[:i]
+			answer = strings.TrimLeft(s.buf[i+len(thinkClose):], " \t\r\n")
+			s.state, s.buf = 2, ""
+			return
+		}
+		n := len(s.buf)
+		for k := len(thinkClose) - 1; k > 0; k-- {
+			if strings.HasSuffix(s.buf, thinkClose[:k]) {
+				n -= k
+				break
+			}
+		}
+		reasoning, s.buf = s.buf[:n], s.buf[n:]
+		return
+	}
+	return "", text
+}
+
+// flush returns the text held by the splitter.
+func (s *thinkSplitter) flush() (reasoning, answer string) {
+	text := s.buf
+	s.buf = ""
+	if s.state == 1 {
+		return text, ""
+	}
+	return "", text
+}
@@ -1,9 +1,8 @@
 package ollama
 
 import (
-	"fmt"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/goplus/xgowiz/llm"
 	api "github.com/ollama/ollama/api"
@@ -13,27 +12,54 @@ import (
 type OllamaMessage struct {
 	Message    api.Message
 	ToolCallID string // Store tool call ID separately since Ollama API doesn't have this field
+	Metrics    api.Metrics
+	CallIDs    llm.ToolCallIDs // identifies the tool calls, set on first use if empty
 }
 
+// callIDsMu guards the CallIDs set by ToolCalls. It is not a field so that
+// messages can still be copied.
+var callIDsMu sync.Mutex
+
 func (m *OllamaMessage) Role() string {
 	return m.Message.Role
 }
 
 func (m *OllamaMessage) Content() string {
-	// For tool responses and regular messages, just return the content string
-	return strings.TrimSpace(m.Message.Content)
+	// For tool responses and regular messages, just return the content
+	// string without the reasoning of the model
+	_, answer := llm.SplitThink(m.Message.Content)
+	return strings.TrimSpace(answer)
+}
+
+// Thoughts implements llm.ReasoningMessage with the reasoning enclosed in
+// <think> tags by models such as deepseek-r1 and qwen3.
+func (m *OllamaMessage) Thoughts() []llm.Thought {
+	if reasoning, _ := llm.SplitThink(m.Message.Content); reasoning != "" {
+		return []llm.Thought{{Text: reasoning}}
+	}
+	return nil
 }
 
 func (m *OllamaMessage) ToolCalls() []llm.ToolCall {
-	var calls []llm.ToolCall
-	for _, call := range m.Message.ToolCalls {
-		calls = append(calls, NewOllamaToolCall(call))
+	if len(m.Message.ToolCalls) == 0 {
+		return nil
+	}
+	callIDsMu.Lock()
+	if m.CallIDs == "" {
+		m.CallIDs = llm.NewToolCallIDs()
+	}
+	ids := m.CallIDs
+	callIDsMu.Unlock()
+
+	calls := make([]llm.ToolCall, len(m.Message.ToolCalls))
+	for i, call := range m.Message.ToolCalls {
+		calls[i] = NewOllamaToolCallWithID(call, ids.ID(i))
 	}
 	return calls
 }
 
 func (m *OllamaMessage) StatUsage() (int, int) {
-	return 0, 0 // Ollama doesn't provide token usage info
+	return m.Metrics.PromptEvalCount, m.Metrics.EvalCount
 }
 
 func (m *OllamaMessage) ToolResponse() (string, bool) {
@@ -46,15 +72,14 @@ type OllamaToolCall struct {
 	id   string // Store a unique ID for the tool call
 }
 
+// NewOllamaToolCall returns a tool call with a new unique ID.
 func NewOllamaToolCall(call api.ToolCall) *OllamaToolCall {
-	return &OllamaToolCall{
-		call: call,
-		id: fmt.Sprintf(
-			"tc_%s_%d",
-			call.Function.Name,
-			time.Now().UnixNano(),
-		),
-	}
+	return NewOllamaToolCallWithID(call, llm.NewToolCallIDs().ID(0))
+}
+
+// NewOllamaToolCallWithID returns a tool call identified by id.
+func NewOllamaToolCallWithID(call api.ToolCall, id string) *OllamaToolCall {
+	return &OllamaToolCall{call: call, id: id}
 }
 
 func (t *OllamaToolCall) Name() string {
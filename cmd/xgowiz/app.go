@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/agent"
+	"github.com/goplus/xgowiz/llm/approval"
+	"github.com/goplus/xgowiz/llm/config"
+	"github.com/goplus/xgowiz/llm/history"
+	"github.com/goplus/xgowiz/llm/mcp"
+	"github.com/goplus/xgowiz/llm/tool"
+	"github.com/goplus/xgowiz/llm/usage"
+	"github.com/goplus/xgowiz/llm/window"
+	"github.com/goplus/xgowiz/tools/workspace"
+	"github.com/goplus/xgowiz/tools/xgo"
+	"github.com/qiniu/x/log"
+)
+
+// app holds the state of a conversation.
+type app struct {
+	conf     *config.Config
+	spec     string
+	provider llm.Provider
+	window   *window.Window // context window of the model
+	tools    *tool.Registry
+	gate     *approval.Gate // approves the calls of tools
+	input    *bufio.Scanner // reads the answers to approval prompts
+	system   string
+	out      *renderer
+	servers  []*mcp.Client
+	usage    *usage.Tracker
+	thinking int // reasoning budget in tokens, 0 for the default
+
+	conv        string     // identifies the conversation in the usage
+	attachments []llm.Part // sent with the next question
+	messages    []llm.Message
+	store       *history.Store
+	session     *history.Session // nil until the conversation is saved
+}
+
+func newApp(conf *config.Config, system string, out *renderer) (*app, error) {
+	a := &app{
+		conf:   conf,
+		tools:  tool.NewRegistry(),
+		system: system,
+		out:    out,
+		usage:  conf.Usage,
+		conv:   newConv(),
+	}
+	if a.usage == nil {
+		a.usage = new(usage.Tracker)
+	}
+	if err := openUsage(a.usage); err != nil {
+		log.Warn("usage is not recorded", "error", err)
+	}
+	policy := conf.Approval
+	if policy == nil {
+		policy = defaultPolicy()
+	}
+	gate, err := approval.New(a.tools, policy)
+	if err != nil {
+		return nil, err
+	}
+	if gate.Audit, err = openAudit(); err != nil {
+		log.Warn("approval decisions are not audited", "error", err)
+	}
+	a.gate = gate
+
+	tc := xgo.FindToolchain()
+	if err := xgo.Register(a.tools, tc); err != nil {
+		return nil, err
+	}
+	if tc != nil {
+		if err := xgo.RegisterSandbox(a.tools, &xgo.Sandbox{Toolchain: tc, CPUTime: time.Minute}); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.connectServers(context.Background()); err != nil {
+		a.close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// connectServers connects to the MCP servers of the configuration and adds
+// their tools, prefixed by the server name, to the tools of the app.
+func (a *app) connectServers(ctx context.Context) error {
+	for name, sc := range a.conf.MCPServers {
+		c, err := mcp.Dial(ctx, sc)
+		if err != nil {
+			return fmt.Errorf("mcp server %s: %w", name, err)
+		}
+		a.servers = append(a.servers, c)
+		names, err := c.Register(ctx, a.tools, name+"_")
+		if err != nil {
+			return fmt.Errorf("mcp server %s: %w", name, err)
+		}
+		log.Debug("mcp server connected", "name", name, "tools", names)
+	}
+	return nil
+}
+
+// openWorkspace gives access to the files under root.
+func (a *app) openWorkspace(root string, writable bool) error {
+	w, err := workspace.New(root)
+	if err != nil {
+		return err
+	}
+	return workspace.Register(a.tools, w, writable)
+}
+
+// close closes the connections to the MCP servers.
+func (a *app) close() {
+	for _, c := range a.servers {
+		c.Close()
+	}
+	a.servers = nil
+}
+
+// setModel switches to the provider given by spec. If spec is empty, the
+// default provider of the configuration is used.
+func (a *app) setModel(ctx context.Context, spec string) error {
+	if spec == "" {
+		spec = a.conf.Default
+	}
+	if spec == "" {
+		return fmt.Errorf("no provider specified, use -m (e.g. -m anthropic:claude-3-5-sonnet-20240620), set XGOWIZ_MODEL or configure a default provider (providers: %s)",
+			strings.Join(llm.Providers(), ", "))
+	}
+	p, err := a.conf.NewProvider(ctx, spec)
+	if err != nil {
+		return err
+	}
+	a.spec, a.provider = spec, p
+	a.window = a.conf.Window(spec)
+	a.window.Strategy = &window.Summarize{Provider: p}
+	return nil
+}
+
+// ask sends a question and prints the answer, running the tool calls
+// requested on the way.
+func (a *app) ask(ctx context.Context, question string) error {
+	r := agent.New(a.provider, a.gate)
+	r.Options = []llm.Option{llm.WithSystem(a.system)}
+	if a.thinking != 0 {
+		r.Options = append(r.Options, llm.WithThinking(a.thinking))
+	}
+	r.Window = a.window
+	r.Meter = a.meter()
+	r.Stream = func(chunk *llm.Chunk) error {
+		switch chunk.Kind {
+		case llm.ChunkText:
+			a.out.Write(chunk.Text)
+		case llm.ChunkReasoning:
+			a.out.Think(chunk.Text)
+		}
+		return nil
+	}
+	r.OnEvent = func(ev *agent.Event) {
+		switch ev.Kind {
+		case agent.EventMessage:
+			a.out.Flush()
+		case agent.EventToolCall:
+			args, _ := json.Marshal(ev.ToolCall.Arguments())
+			a.out.Note(fmt.Sprintf("⚙ %s %s", ev.ToolCall.Name(), args))
+		case agent.EventToolResult:
+			if ev.Err != nil {
+				a.out.Note(fmt.Sprintf("✗ %s: %v", ev.ToolCall.Name(), ev.Err))
+			}
+		}
+	}
+
+	n := len(a.messages)
+	msgs := a.messages
+	if len(a.attachments) > 0 {
+		parts := append([]llm.Part{llm.TextPart(question)}, a.attachments...)
+		msgs = append(msgs[:n:n], history.NewMessage("user", parts...))
+		question, a.attachments = "", nil
+	}
+	msgs, err := r.Run(ctx, question, msgs)
+	a.out.Flush()
+	if len(msgs) > n {
+		a.messages = msgs
+		if a.session != nil {
+			if e := a.session.Append(msgs[n:]...); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// attach adds the image or document at path, a file path or a URL, to the
+// next question.
+func (a *app) attach(path string) error {
+	var part llm.Part
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		part = llm.ImageURLPart(path)
+		if u, err := url.Parse(path); err == nil && strings.EqualFold(filepath.Ext(u.Path), ".pdf") {
+			part.Type, part.MediaType, part.Name = llm.PartDocument, "application/pdf", filepath.Base(u.Path)
+		}
+	} else {
+		var err error
+		if part, err = llm.FilePart(path); err != nil {
+			return err
+		}
+	}
+	a.attachments = append(a.attachments, part)
+	return nil
+}
+
+// clear starts a new conversation. The tools allowed for the session must
+// be approved again.
+func (a *app) clear() {
+	a.gate.ResetSession()
+	a.messages = nil
+	a.attachments = nil
+	a.session = nil
+	a.conv = newConv()
+}
+
+func newConv() string {
+	return time.Now().Format("20060102-150405")
+}
+
+// save saves the conversation, and the following messages as they come.
+func (a *app) save() (*history.Session, error) {
+	if a.session != nil {
+		return a.session, nil
+	}
+	store, err := a.openStore()
+	if err != nil {
+		return nil, err
+	}
+	name, model := llm.ParseSpec(a.spec)
+	sess, err := store.Create(name, model)
+	if err != nil {
+		return nil, err
+	}
+	if err = sess.Append(a.messages...); err != nil {
+		return nil, err
+	}
+	a.session = sess
+	return sess, nil
+}
+
+// load resumes a saved conversation. If id is empty, the latest one is
+// resumed.
+func (a *app) load(id string) (*history.Session, error) {
+	store, err := a.openStore()
+	if err != nil {
+		return nil, err
+	}
+	sess, err := store.Resume(id)
+	if err != nil {
+		return nil, err
+	}
+	a.messages = sess.Messages()
+	a.session = sess
+	a.conv = sess.ID
+	return sess, nil
+}
+
+func (a *app) sessions() ([]*history.SessionInfo, error) {
+	store, err := a.openStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.List()
+}
+
+func (a *app) openStore() (*history.Store, error) {
+	if a.store == nil {
+		store, err := openStore()
+		if err != nil {
+			return nil, err
+		}
+		a.store = store
+	}
+	return a.store, nil
+}
+
+func (a *app) printf(format string, args ...any) {
+	a.out.Flush()
+	fmt.Fprintf(os.Stdout, format, args...)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/approval"
+)
+
+// defaultPolicy allows the tools that only read, and asks for the others.
+func defaultPolicy() *approval.Policy {
+	p := &approval.Policy{Default: approval.Ask}
+	for _, name := range []string{"read_file", "list_dir", "glob", "grep", "xgo_check", "xgo_format", "xgo_decls", "xgo_classfile"} {
+		p.Rules = append(p.Rules, &approval.Rule{Tool: name, Action: approval.Allow})
+	}
+	return p
+}
+
+// openAudit returns the audit function appending the decisions to
+// audit.jsonl in the configuration directory.
+func openAudit() (func(*approval.Record), error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "xgowiz")
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "audit.jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return approval.JSONLog(f), nil
+}
+
+// setInput sets the scanner reading the answers to approval prompts.
+func (a *app) setInput(in *bufio.Scanner) {
+	a.input = in
+	a.gate.Prompt = a.promptTool
+}
+
+func (a *app) promptTool(ctx context.Context, call llm.ToolCall) (approval.Answer, error) {
+	a.out.Flush()
+	args, _ := json.MarshalIndent(call.Arguments(), "  ", "  ")
+	for {
+		fmt.Fprintf(os.Stderr, "Allow %s?\n  %s\n[y]es, [a]lways this session, [N]o: ", call.Name(), args)
+		if !a.input.Scan() {
+			if err := a.input.Err(); err != nil {
+				return approval.DenyOnce, err
+			}
+			return approval.DenyOnce, nil
+		}
+		switch strings.ToLower(strings.TrimSpace(a.input.Text())) {
+		case "y", "yes":
+			return approval.AllowOnce, nil
+		case "a", "always":
+			return approval.AllowSession, nil
+		case "", "n", "no":
+			return approval.DenyOnce, nil
+		}
+	}
+}
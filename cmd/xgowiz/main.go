@@ -0,0 +1,201 @@
+// Command xgowiz is an intelligent companion for XGo programming.
+//
+// Usage:
+//
+//	xgowiz [flags]                  start an interactive chat
+//	xgowiz [flags] ask "question"   ask a single question
+//	xgowiz [flags] mcp [-http addr] run as an MCP server
+//
+// Files given by -f are added to the first question as context, and so is
+// the data piped to stdin in ask mode. The provider is selected by -m, the
+// XGOWIZ_MODEL environment variable or the default of the configuration
+// file.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/goplus/xgowiz/llm/config"
+	"github.com/goplus/xgowiz/llm/history"
+	"github.com/qiniu/x/log"
+
+	_ "github.com/goplus/xgowiz/cmd/google"
+	_ "github.com/goplus/xgowiz/cmd/ollama"
+	_ "github.com/goplus/xgowiz/llm/anthropic"
+	_ "github.com/goplus/xgowiz/llm/openai"
+)
+
+const defaultSystem = `You are XGoWiz, an expert assistant for the XGo programming language (formerly Go+).
+XGo is compatible with Go and adds features such as classfiles, command-style calls,
+list comprehensions and simplified syntax for data processing and teaching.
+Answer precisely, prefer idiomatic XGo code, and format your answers in Markdown.`
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+var (
+	flagModel   = flag.String("m", "", "provider and model, such as anthropic:claude-3-5-sonnet-20240620")
+	flagConfig  = flag.String("config", "", "path of the configuration file")
+	flagSystem  = flag.String("system", defaultSystem, "system prompt")
+	flagRaw     = flag.Bool("raw", false, "print responses without rendering Markdown")
+	flagVerbose = flag.Bool("v", false, "print debug logs")
+	flagRoot    = flag.String("w", ".", "root of the workspace the assistant can access, none if empty")
+	flagRead    = flag.Bool("readonly", false, "do not allow the assistant to edit the files of the workspace")
+	flagThink   = flag.Int("think", 0, "tokens the model may spend reasoning before answering, for models supporting it")
+	flagFiles   stringList
+	flagAttach  stringList
+)
+
+func main() {
+	flag.Var(&flagFiles, "f", "add a file as context (may be repeated)")
+	flag.Var(&flagAttach, "a", "attach an image or a document such as a PDF, by path or URL (may be repeated)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  xgowiz [flags]                  start an interactive chat\n  xgowiz [flags] ask \"question\"   ask a single question\n  xgowiz [flags] mcp [-http addr] run as an MCP server\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *flagVerbose {
+		log.SetOutputLevel(log.Ldebug)
+	}
+
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "xgowiz:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	conf, err := loadConfig(*flagConfig)
+	if err != nil {
+		return err
+	}
+	a, err := newApp(conf, *flagSystem, newRenderer(os.Stdout, !*flagRaw && isTerminal(os.Stdout)))
+	if err != nil {
+		return err
+	}
+	defer a.close()
+	a.thinking = *flagThink
+	if *flagRoot != "" {
+		if err = a.openWorkspace(*flagRoot, !*flagRead); err != nil {
+			return err
+		}
+	}
+
+	spec := *flagModel
+	if spec == "" {
+		spec = os.Getenv("XGOWIZ_MODEL")
+	}
+	if len(args) > 0 && args[0] == "mcp" {
+		return a.serveMCP(args[1:], spec)
+	}
+	if err = a.setModel(context.Background(), spec); err != nil {
+		return err
+	}
+	for _, file := range flagAttach {
+		if err = a.attach(file); err != nil {
+			return err
+		}
+	}
+
+	if len(args) == 0 || args[0] == "chat" {
+		extra, err := readContext(flagFiles, false)
+		if err != nil {
+			return err
+		}
+		return a.repl(os.Stdin, extra)
+	}
+	if args[0] != "ask" {
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	extra, err := readContext(flagFiles, !isTerminal(os.Stdin))
+	if err != nil {
+		return err
+	}
+	if isTerminal(os.Stdin) {
+		a.setInput(bufio.NewScanner(os.Stdin))
+	}
+	question := strings.TrimSpace(strings.Join(args[1:], " "))
+	if question == "" && extra == "" && len(a.attachments) == 0 {
+		return fmt.Errorf("ask: no question given")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return a.ask(ctx, joinContext(extra, question))
+}
+
+func loadConfig(path string) (*config.Config, error) {
+	if path != "" {
+		return config.Load(path)
+	}
+	path, err := config.DefaultPath()
+	if err == nil {
+		conf, err := config.Load(path)
+		if err == nil {
+			return conf, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return new(config.Config), nil
+}
+
+func openStore() (*history.Store, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return history.NewStore(filepath.Join(dir, "xgowiz", "sessions"))
+}
+
+// readContext reads the files, and the data piped to stdin if stdin is set.
+func readContext(files []string, stdin bool) (string, error) {
+	var sb strings.Builder
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "File %s:\n```\n%s\n```\n\n", file, strings.TrimRight(string(data), "\n"))
+	}
+	if stdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		if text := strings.TrimSpace(string(data)); text != "" {
+			fmt.Fprintf(&sb, "Input:\n```\n%s\n```\n\n", text)
+		}
+	}
+	return sb.String(), nil
+}
+
+func joinContext(extra, question string) string {
+	if extra == "" {
+		return question
+	}
+	return extra + question
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
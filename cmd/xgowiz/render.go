@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiItalic = "\x1b[3m"
+	ansiCyan   = "\x1b[36m"
+	ansiYellow = "\x1b[33m"
+)
+
+var (
+	reBold   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	reCode   = regexp.MustCompile("`([^`]+)`")
+	reList   = regexp.MustCompile(`^(\s*)([-*+]|\d+\.)\s+`)
+	reHeader = regexp.MustCompile(`^#{1,6}\s+`)
+)
+
+// renderer prints Markdown text as it is streamed, line by line. If color
+// is false, or the NO_COLOR environment variable is set, the text is
+// printed as is.
+type renderer struct {
+	w     io.Writer
+	color bool
+	line  strings.Builder
+	fence bool // inside a code block
+	open  bool // the last line printed in raw mode is incomplete
+	think bool // reasoning is being printed
+}
+
+func newRenderer(w io.Writer, color bool) *renderer {
+	if os.Getenv("NO_COLOR") != "" {
+		color = false
+	}
+	return &renderer{w: w, color: color}
+}
+
+// Write prints text, holding back the last incomplete line.
+func (r *renderer) Write(text string) {
+	r.endThink()
+	if !r.color {
+		if text != "" {
+			io.WriteString(r.w, text)
+			r.open = !strings.HasSuffix(text, "\n")
+		}
+		return
+	}
+	for {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			r.line.WriteString(text)
+			return
+		}
+		r.line.WriteString(text[:i])
+		r.writeLine(r.line.String())
+		r.line.Reset()
+		text = text[i+1:]
+	}
+}
+
+// Flush prints the pending incomplete line, if any, and ends it.
+func (r *renderer) Flush() {
+	r.endThink()
+	if !r.color {
+		if r.open {
+			io.WriteString(r.w, "\n")
+			r.open = false
+		}
+		return
+	}
+	if r.line.Len() > 0 {
+		r.writeLine(r.line.String())
+		r.line.Reset()
+	}
+	r.fence = false
+}
+
+// Note prints a side message, such as a tool call, to stderr.
+func (r *renderer) Note(msg string) {
+	r.Flush()
+	if r.color {
+		fmt.Fprintf(os.Stderr, "%s%s%s\n", ansiDim, msg, ansiReset)
+	} else {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+// Think prints the reasoning of the model, dimmed, to stderr as it is
+// streamed.
+func (r *renderer) Think(text string) {
+	if !r.think {
+		r.Flush()
+		r.think = true
+	}
+	if r.color {
+		fmt.Fprintf(os.Stderr, "%s%s%s", ansiDim, text, ansiReset)
+	} else {
+		io.WriteString(os.Stderr, text)
+	}
+}
+
+// endThink ends the line of the reasoning printed, if any.
+func (r *renderer) endThink() {
+	if r.think {
+		r.think = false
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func (r *renderer) writeLine(line string) {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(trimmed, "```"):
+		r.fence = !r.fence
+		fmt.Fprintf(r.w, "%s%s%s\n", ansiDim, line, ansiReset)
+	case r.fence:
+		fmt.Fprintf(r.w, "%s%s%s\n", ansiCyan, line, ansiReset)
+	case reHeader.MatchString(line):
+		fmt.Fprintf(r.w, "%s%s%s\n", ansiBold+ansiYellow, reHeader.ReplaceAllString(line, ""), ansiReset)
+	case strings.HasPrefix(trimmed, ">"):
+		fmt.Fprintf(r.w, "%s%s%s\n", ansiItalic, inline(line), ansiReset)
+	default:
+		if m := reList.FindStringSubmatchIndex(line); m != nil {
+			bullet := line[m[4]:m[5]]
+			if bullet == "-" || bullet == "*" || bullet == "+" {
+				bullet = "•"
+			}
+			line = line[m[2]:m[3]] + bullet + " " + line[m[1]:]
+		}
+		fmt.Fprintln(r.w, inline(line))
+	}
+}
+
+// inline renders **bold** and `code` spans.
+func inline(s string) string {
+	s = reCode.ReplaceAllString(s, ansiCyan+"$1"+ansiReset)
+	return reBold.ReplaceAllString(s, ansiBold+"$1"+ansiReset)
+}
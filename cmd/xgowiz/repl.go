@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const replHelp = `Commands:
+  /model [spec]   show or switch the provider, e.g. /model openai:gpt-4o
+  /attach <file>  attach an image or a PDF, by path or URL, to the next message
+  /clear          start a new conversation
+  /save           save the conversation and keep saving it
+  /load [id]      resume a saved conversation, the latest if no id is given
+  /sessions       list saved conversations
+  /tools          list available tools
+  /approvals      list the tools allowed for this session
+  /usage          show the tokens used and their cost
+  /think [tokens] show or set the reasoning budget, 0 for the default
+  /help           show this help
+  /exit           quit
+End a line with \ to continue the message on the next line.
+`
+
+// repl runs an interactive chat reading input from in. The first message
+// sent is prefixed by extra.
+func (a *app) repl(in io.Reader, extra string) error {
+	fmt.Printf("XGoWiz (%s) - type /help for help\n", a.spec)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	a.setInput(scanner)
+	for {
+		input, ok := readInput(scanner)
+		if !ok {
+			fmt.Println()
+			return scanner.Err()
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		if strings.HasPrefix(input, "/") {
+			if quit := a.command(input); quit {
+				return nil
+			}
+			continue
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := a.ask(ctx, joinContext(extra, input))
+		stop()
+		extra = ""
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Fprintln(os.Stderr, "interrupted")
+			} else {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		}
+	}
+}
+
+// readInput reads a message, joining lines ending with a backslash.
+func readInput(scanner *bufio.Scanner) (string, bool) {
+	var lines []string
+	prompt := "> "
+	for {
+		fmt.Print(prompt)
+		if !scanner.Scan() {
+			return strings.Join(lines, "\n"), len(lines) > 0
+		}
+		line := scanner.Text()
+		if !strings.HasSuffix(line, "\\") {
+			lines = append(lines, line)
+			return strings.Join(lines, "\n"), true
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\\"))
+		prompt = ". "
+	}
+}
+
+// command executes a slash command. It returns true if the chat should end.
+func (a *app) command(input string) (quit bool) {
+	cmd, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case "/exit", "/quit":
+		return true
+	case "/help":
+		a.printf("%s", replHelp)
+	case "/model":
+		if arg == "" {
+			a.printf("model: %s\n", a.spec)
+			break
+		}
+		if err := a.setModel(context.Background(), arg); err != nil {
+			a.printf("error: %v\n", err)
+			break
+		}
+		a.printf("switched to %s\n", a.spec)
+	case "/attach":
+		if arg == "" {
+			for _, part := range a.attachments {
+				a.printf("%s %s%s\n", part.Type, part.Name, part.URL)
+			}
+			break
+		}
+		if err := a.attach(arg); err != nil {
+			a.printf("error: %v\n", err)
+			break
+		}
+		a.printf("attached %s to the next message\n", arg)
+	case "/think":
+		if arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				a.printf("error: invalid budget %q\n", arg)
+				break
+			}
+			a.thinking = n
+		}
+		a.printf("thinking: %d tokens\n", a.thinking)
+	case "/clear":
+		a.clear()
+		a.printf("conversation cleared\n")
+	case "/save":
+		sess, err := a.save()
+		if err != nil {
+			a.printf("error: %v\n", err)
+			break
+		}
+		a.printf("saved as %s\n", sess.ID)
+	case "/load":
+		sess, err := a.load(arg)
+		if err != nil {
+			a.printf("error: %v\n", err)
+			break
+		}
+		a.printf("loaded %s: %s (%d messages)\n", sess.ID, sess.Title, len(sess.History))
+	case "/sessions":
+		sessions, err := a.sessions()
+		if err != nil {
+			a.printf("error: %v\n", err)
+			break
+		}
+		if len(sessions) == 0 {
+			a.printf("no saved conversations\n")
+		}
+		for _, s := range sessions {
+			a.printf("%s  %s  %3d  %s\n", s.ID, s.Updated.Format(time.DateTime), s.NumMessages, s.Title)
+		}
+	case "/tools":
+		tools := a.gate.Tools()
+		if len(tools) == 0 {
+			a.printf("no tools available\n")
+		}
+		for _, t := range tools {
+			a.printf("%-20s %s\n", t.Name, firstLine(t.Description))
+		}
+	case "/approvals":
+		names := a.gate.Session()
+		if len(names) == 0 {
+			a.printf("no tools allowed for this session\n")
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			a.printf("%s\n", name)
+		}
+	case "/usage":
+		a.printUsage()
+	default:
+		a.printf("unknown command %s, type /help for help\n", cmd)
+	}
+	return false
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/agent"
+	"github.com/goplus/xgowiz/llm/mcp"
+	"github.com/goplus/xgowiz/llm/tool"
+	"github.com/goplus/xgowiz/llm/window"
+	"github.com/qiniu/x/log"
+)
+
+const version = "0.1.0"
+
+type askArgs struct {
+	Question string `json:"question" desc:"the question about XGo or Go programming"`
+	Context  string `json:"context,omitempty" desc:"additional context such as source code or error messages"`
+}
+
+// serveMCP runs xgowiz as an MCP server publishing its tools, and the
+// ask_xgowiz tool if a provider is given.
+func (a *app) serveMCP(args []string, spec string) error {
+	fs := flag.NewFlagSet("mcp", flag.ContinueOnError)
+	addr := fs.String("http", "", "serve over HTTP at this address (e.g. :8080, on loopback if no host is given) instead of stdio")
+	ask := fs.Bool("ask", true, "publish the ask_xgowiz tool, which requires a provider")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The tools go through the gate as in the REPL, so the policy applies.
+	// Nobody can answer prompts here: the calls it asks about are denied.
+	tools := tool.NewRegistry()
+	for _, t := range a.gate.Tools() {
+		name := t.Name
+		handler := func(ctx context.Context, args map[string]any) (any, error) {
+			return a.gate.Call(ctx, name, args)
+		}
+		if err := tools.Add(t, handler); err != nil {
+			return err
+		}
+	}
+	if *ask {
+		if err := a.setModel(context.Background(), spec); err != nil {
+			return fmt.Errorf("%w (or use -ask=false)", err)
+		}
+		err := tool.Register(tools, "ask_xgowiz",
+			"Ask XGoWiz, an expert assistant for the XGo programming language, a question. It answers with the help of its own tools.",
+			func(ctx context.Context, args askArgs) (string, error) {
+				return a.answer(ctx, joinContext(args.Context, args.Question))
+			})
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s := mcp.NewServer("xgowiz", version, tools)
+	if *addr == "" {
+		log.Debug("serving MCP over stdio", "tools", len(tools.Tools()))
+		return s.Serve(ctx, mcp.NewStreamTransport(os.Stdin, os.Stdout, nil))
+	}
+
+	srv := &http.Server{Addr: loopbackAddr(*addr), Handler: s}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	fmt.Fprintf(os.Stderr, "serving MCP at http://%s\n", srv.Addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// loopbackAddr binds addr to the loopback interface if it has no host, as
+// the tools published run code and write files without authentication.
+func loopbackAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// answer answers a question in a new conversation, without printing
+// anything. The tools needing approval are denied since nobody can be
+// asked.
+func (a *app) answer(ctx context.Context, question string) (string, error) {
+	r := agent.New(a.provider, a.gate)
+	r.Options = []llm.Option{llm.WithSystem(a.system)}
+	r.Window = &window.Window{Limit: a.window.Limit}
+	r.Meter = a.meter()
+	msgs, err := r.Run(ctx, question, nil)
+	if err != nil {
+		return "", err
+	}
+	return msgs[len(msgs)-1].Content(), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/usage"
+)
+
+// openUsage loads the usage of today from usage.jsonl in the configuration
+// directory and appends the following usage to it. The budget of the
+// tracker is thus a daily budget.
+func openUsage(t *usage.Tracker) error {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return err
+	}
+	dir = filepath.Join(dir, "xgowiz")
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "usage.jsonl"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	y, m, d := time.Now().Date()
+	if err = t.Replay(f, time.Date(y, m, d, 0, 0, 0, 0, time.Local)); err != nil {
+		f.Close()
+		return err
+	}
+	t.Log = usage.JSONLog(f)
+	return nil
+}
+
+// meter returns the meter of the current conversation.
+func (a *app) meter() *usage.Meter {
+	name, model := llm.ParseSpec(a.spec)
+	if pc := a.conf.Providers[name]; model == "" && pc != nil {
+		model = pc.Model
+	}
+	return a.usage.Meter(usage.Key{Session: a.conv, Provider: name, Model: model})
+}
+
+// printUsage prints the usage of the conversation and of the day.
+func (a *app) printUsage() {
+	conv := a.usage.Sum(func(key usage.Key) bool { return key.Session == a.conv })
+	a.printf("conversation: %s\n", formatTotal(conv, a.usage.Session))
+	a.printf("today:        %s\n", formatTotal(a.usage.Sum(nil), a.usage.Budget))
+	type pm struct{ provider, model string }
+	byModel := make(map[pm]usage.Total)
+	var models []pm
+	for key, total := range a.usage.Totals() {
+		k := pm{key.Provider, key.Model}
+		t, ok := byModel[k]
+		if !ok {
+			models = append(models, k)
+		}
+		t.Usage.Add(total.Usage)
+		t.Requests += total.Requests
+		t.Cost += total.Cost
+		byModel[k] = t
+	}
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].provider != models[j].provider {
+			return models[i].provider < models[j].provider
+		}
+		return models[i].model < models[j].model
+	})
+	for _, k := range models {
+		a.printf("  %s:%s  %s\n", k.provider, k.model, formatTotal(byModel[k], usage.Budget{}))
+	}
+}
+
+func formatTotal(t usage.Total, budget usage.Budget) string {
+	s := fmt.Sprintf("%d requests, %d tokens in, %d out", t.Requests, t.InputTokens, t.OutputTokens)
+	if t.CacheReadTokens > 0 || t.CacheWriteTokens > 0 {
+		s += fmt.Sprintf(" (cache %d read, %d written)", t.CacheReadTokens, t.CacheWriteTokens)
+	}
+	if t.ReasoningTokens > 0 {
+		s += fmt.Sprintf(" (%d reasoning)", t.ReasoningTokens)
+	}
+	if t.Cost > 0 {
+		s += fmt.Sprintf(", $%.4f", t.Cost)
+	}
+	if budget.Tokens > 0 {
+		s += fmt.Sprintf(", budget %d tokens", budget.Tokens)
+	}
+	if budget.Cost > 0 {
+		s += fmt.Sprintf(", budget $%.2f", budget.Cost)
+	}
+	return s
+}
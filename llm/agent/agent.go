@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/history"
+	"github.com/qiniu/x/log"
+)
+
+// DefaultMaxIterations is the default limit of LLM round trips in one run.
+const DefaultMaxIterations = 20
+
+// ErrMaxIterations is returned by Runner.Run when the LLM still requests
+// tool calls after the maximum number of iterations.
+var ErrMaxIterations = errors.New("agent: max iterations exceeded")
+
+// Toolbox provides the tools available to an agent and executes them.
+type Toolbox interface {
+	// Tools returns the definitions of all tools.
+	Tools() []llm.Tool
+
+	// CallTool executes a tool call and returns its result.
+	CallTool(ctx context.Context, call llm.ToolCall) (any, error)
+}
+
+// Window fits conversations in the context window of a model.
+type Window interface {
+	// Fit returns messages shortened, if needed, to fit in the context
+	// window together with tools and the system prompt of opts.
+	Fit(ctx context.Context, messages []llm.Message, tools []llm.Tool, opts *llm.Options) ([]llm.Message, error)
+}
+
+// Meter accounts for the usage of the LLM.
+type Meter interface {
+	// Allow returns an error if no more requests may be sent.
+	Allow() error
+
+	// Record accounts for a response. An error stops the run before the
+	// tool calls of the response are executed; a final answer is returned
+	// anyway.
+	Record(msg llm.Message) error
+}
+
+// Runner drives a conversation with a Provider: it executes the tool calls
+// requested by the LLM, feeds the results back and repeats until the LLM
+// gives a final answer.
+type Runner struct {
+	// Provider is the LLM provider to talk to.
+	Provider llm.Provider
+
+	// Toolbox provides the tools. It may be nil if no tools are available.
+	Toolbox Toolbox
+
+	// MaxIterations limits the LLM round trips of a run. If zero,
+	// DefaultMaxIterations is used.
+	MaxIterations int
+
+	// Parallel executes the tool calls of a message concurrently.
+	Parallel bool
+
+	// Options are passed to each Provider.SendMessage call. A tool choice
+	// forcing tool calls only applies to the first call of a run.
+	Options []llm.Option
+
+	// Window fits the messages of each request in the context window if
+	// not nil. The conversation returned by Run is never shortened.
+	Window Window
+
+	// Meter accounts for the usage of each response if not nil, and may
+	// stop a run using too much.
+	Meter Meter
+
+	// Stream receives the chunks of each response if not nil. The
+	// responses are streamed if the Provider supports it.
+	Stream llm.StreamHandler
+
+	// OnEvent is called for each step of a run if not nil. When Parallel
+	// is set, events of different tool calls may interleave, but OnEvent
+	// is never called concurrently.
+	OnEvent func(ev *Event)
+
+	mu sync.Mutex
+}
+
+// New creates a new Runner.
+func New(provider llm.Provider, toolbox Toolbox) *Runner {
+	return &Runner{
+		Provider: provider,
+		Toolbox:  toolbox,
+	}
+}
+
+// Run appends prompt to messages as a user message and talks to the LLM
+// until it answers without tool calls. It returns the conversation with
+// all new messages appended, the last of which is the final answer. On
+// error, the messages exchanged so far are returned as well.
+func (r *Runner) Run(ctx context.Context, prompt string, messages []llm.Message) ([]llm.Message, error) {
+	if prompt != "" {
+		messages = append(messages, history.NewTextMessage("user", prompt))
+	}
+
+	var tools []llm.Tool
+	if r.Toolbox != nil {
+		tools = r.Toolbox.Tools()
+	}
+
+	maxIter := r.MaxIterations
+	if maxIter <= 0 {
+		maxIter = DefaultMaxIterations
+	}
+	for iter := 0; iter < maxIter; iter++ {
+		if err := ctx.Err(); err != nil {
+			return messages, err
+		}
+
+		if r.Meter != nil {
+			if err := r.Meter.Allow(); err != nil {
+				return messages, err
+			}
+		}
+		msg, err := r.send(ctx, iter, messages, tools)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, msg)
+		r.emit(&Event{Kind: EventMessage, Iteration: iter, Message: msg})
+		if r.Meter != nil {
+			if err := r.Meter.Record(msg); err != nil && len(msg.ToolCalls()) > 0 {
+				return messages, err
+			}
+		}
+
+		calls := msg.ToolCalls()
+		if len(calls) == 0 {
+			r.emit(&Event{Kind: EventDone, Iteration: iter, Message: msg})
+			return messages, nil
+		}
+
+		responses, err := r.callTools(ctx, iter, calls)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, responses...)
+	}
+	return messages, ErrMaxIterations
+}
+
+func (r *Runner) send(ctx context.Context, iter int, messages []llm.Message, tools []llm.Tool) (llm.Message, error) {
+	opts := r.Options
+	if iter > 0 {
+		// A tool choice forcing tool calls applies to the first request
+		// only, otherwise the LLM could never give a final answer.
+		opts = append(opts[:len(opts):len(opts)], unforceTools)
+	}
+	if r.Window != nil {
+		var err error
+		if messages, err = r.Window.Fit(ctx, messages, tools, llm.NewOptions(opts...)); err != nil {
+			return nil, err
+		}
+	}
+	if r.Stream != nil {
+		return llm.StreamMessage(ctx, r.Provider, "", messages, tools, r.Stream, opts...)
+	}
+	return r.Provider.SendMessage(ctx, "", messages, tools, opts...)
+}
+
+func unforceTools(opts *llm.Options) {
+	if tc := opts.ToolChoice; tc != nil && (tc.Mode == llm.ToolChoiceRequired || tc.Mode == llm.ToolChoiceTool) {
+		opts.ToolChoice = nil
+	}
+}
+
+func (r *Runner) callTools(ctx context.Context, iter int, calls []llm.ToolCall) ([]llm.Message, error) {
+	responses := make([]llm.Message, len(calls))
+	errs := make([]error, len(calls))
+	if r.Parallel && len(calls) > 1 {
+		var wg sync.WaitGroup
+		wg.Add(len(calls))
+		for i, call := range calls {
+			go func(i int, call llm.ToolCall) {
+				defer wg.Done()
+				responses[i], errs[i] = r.callTool(ctx, iter, call)
+			}(i, call)
+		}
+		wg.Wait()
+	} else {
+		for i, call := range calls {
+			responses[i], errs[i] = r.callTool(ctx, iter, call)
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return responses, nil
+}
+
+// callTool executes a tool call and creates the tool response. A failure of
+// the tool itself is reported to the LLM rather than aborting the run.
+func (r *Runner) callTool(ctx context.Context, iter int, call llm.ToolCall) (llm.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.emit(&Event{Kind: EventToolCall, Iteration: iter, ToolCall: call})
+
+	var result any
+	var err error
+	if r.Toolbox == nil {
+		err = fmt.Errorf("tool %s not found", call.Name())
+	} else {
+		result, err = r.Toolbox.CallTool(ctx, call)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		log.Debug("tool call failed",
+			"tool", call.Name(),
+			"tool_call_id", call.ID(),
+			"error", err)
+		result = "Error: " + err.Error()
+	}
+
+	msg, e := r.Provider.CreateToolResponse(call.ID(), result)
+	if e != nil {
+		return nil, e
+	}
+	if msg == nil {
+		return nil, fmt.Errorf("provider %s cannot create tool responses", r.Provider.Name())
+	}
+	r.emit(&Event{
+		Kind:      EventToolResult,
+		Iteration: iter,
+		Message:   msg,
+		ToolCall:  call,
+		Result:    result,
+		Err:       err,
+	})
+	return msg, nil
+}
+
+func (r *Runner) emit(ev *Event) {
+	if r.OnEvent != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.OnEvent(ev)
+	}
+}
@@ -0,0 +1,313 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+type fakeCall struct {
+	id, name string
+	args     map[string]any
+}
+
+func (c *fakeCall) ID() string                { return c.id }
+func (c *fakeCall) Name() string              { return c.name }
+func (c *fakeCall) Arguments() map[string]any { return c.args }
+
+type fakeMessage struct {
+	role    string
+	content string
+	calls   []llm.ToolCall
+	result  string // ID of the call answered by a tool response
+}
+
+func (m *fakeMessage) Role() string                 { return m.role }
+func (m *fakeMessage) Content() string              { return m.content }
+func (m *fakeMessage) ToolCalls() []llm.ToolCall    { return m.calls }
+func (m *fakeMessage) ToolResponse() (string, bool) { return m.result, m.result != "" }
+func (m *fakeMessage) StatUsage() (int, int)        { return 0, 0 }
+
+func answer(text string) *fakeMessage {
+	return &fakeMessage{role: "assistant", content: text}
+}
+
+func calls(names ...string) *fakeMessage {
+	msg := &fakeMessage{role: "assistant"}
+	for i, name := range names {
+		msg.calls = append(msg.calls, &fakeCall{id: fmt.Sprint("call_", i), name: name, args: map[string]any{"n": i}})
+	}
+	return msg
+}
+
+// fakeProvider answers the requests with the responses in turn, repeating
+// the last one, and records the requests.
+type fakeProvider struct {
+	responses []llm.Message
+	requests  [][]llm.Message
+	options   []*llm.Options
+}
+
+func (p *fakeProvider) SendMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool, opts ...llm.Option) (llm.Message, error) {
+	p.requests = append(p.requests, messages)
+	p.options = append(p.options, llm.NewOptions(opts...))
+	i := len(p.requests) - 1
+	if i >= len(p.responses) {
+		i = len(p.responses) - 1
+	}
+	return p.responses[i], nil
+}
+
+func (p *fakeProvider) CreateToolResponse(toolCallID string, content any) (llm.Message, error) {
+	return &fakeMessage{role: "tool", content: fmt.Sprint(content), result: toolCallID}, nil
+}
+
+func (p *fakeProvider) SupportsTools() bool { return true }
+func (p *fakeProvider) Name() string        { return "fake" }
+
+// fakeToolbox calls the function of the tool named by a call.
+type fakeToolbox map[string]func(ctx context.Context, call llm.ToolCall) (any, error)
+
+func (tb fakeToolbox) Tools() []llm.Tool {
+	var tools []llm.Tool
+	for name := range tb {
+		tools = append(tools, llm.Tool{Name: name})
+	}
+	return tools
+}
+
+func (tb fakeToolbox) CallTool(ctx context.Context, call llm.ToolCall) (any, error) {
+	fn, ok := tb[call.Name()]
+	if !ok {
+		return nil, fmt.Errorf("tool %s not found", call.Name())
+	}
+	return fn(ctx, call)
+}
+
+// describe lists the role and content of messages.
+func describe(messages []llm.Message) string {
+	var s []string
+	for _, msg := range messages {
+		text := msg.Role() + ":" + msg.Content()
+		for _, c := range msg.ToolCalls() {
+			text += " " + c.Name()
+		}
+		s = append(s, text)
+	}
+	return strings.Join(s, " | ")
+}
+
+func TestRunFinalAnswer(t *testing.T) {
+	p := &fakeProvider{responses: []llm.Message{answer("42")}}
+	r := New(p, nil)
+	var events []string
+	r.OnEvent = func(ev *Event) { events = append(events, ev.Kind.String()) }
+
+	history := []llm.Message{answer("earlier")}
+	msgs, err := r.Run(context.Background(), "question", history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describe(msgs), "assistant:earlier | user:question | assistant:42"; got != want {
+		t.Errorf("messages = %s, want %s", got, want)
+	}
+	if len(p.requests) != 1 || len(p.requests[0]) != 2 {
+		t.Errorf("requests = %d", len(p.requests))
+	}
+	if got := strings.Join(events, ","); got != "message,done" {
+		t.Errorf("events = %s", got)
+	}
+}
+
+func TestRunToolCalls(t *testing.T) {
+	p := &fakeProvider{responses: []llm.Message{calls("echo", "fail", "missing"), answer("done")}}
+	tb := fakeToolbox{
+		"echo": func(ctx context.Context, call llm.ToolCall) (any, error) {
+			return fmt.Sprint("echo ", call.Arguments()["n"]), nil
+		},
+		"fail": func(ctx context.Context, call llm.ToolCall) (any, error) {
+			return nil, errors.New("boom")
+		},
+	}
+	r := New(p, tb)
+	r.Options = []llm.Option{llm.WithToolChoice(llm.ToolChoiceRequired)}
+	var events []string
+	r.OnEvent = func(ev *Event) {
+		e := ev.Kind.String()
+		if ev.ToolCall != nil {
+			e += " " + ev.ToolCall.ID()
+		}
+		if ev.Err != nil {
+			e += " error"
+		}
+		events = append(events, e)
+	}
+
+	msgs, err := r.Run(context.Background(), "go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "user:go | assistant: echo fail missing | tool:echo 0 | tool:Error: boom | " +
+		"tool:Error: tool missing not found | assistant:done"
+	if got := describe(msgs); got != want {
+		t.Errorf("messages = %s\nwant %s", got, want)
+	}
+	for i, id := range []string{"call_0", "call_1", "call_2"} {
+		if got, _ := msgs[2+i].ToolResponse(); got != id {
+			t.Errorf("response %d answers %s, want %s", i, got, id)
+		}
+	}
+	if len(p.requests) != 2 || len(p.requests[1]) != 5 {
+		t.Fatalf("requests = %d", len(p.requests))
+	}
+	if p.options[0].ToolChoice == nil || p.options[1].ToolChoice != nil {
+		t.Errorf("tool choice = %v, %v, want forced only first", p.options[0].ToolChoice, p.options[1].ToolChoice)
+	}
+	wantEvents := "message,tool_call call_0,tool_result call_0,tool_call call_1,tool_result call_1 error," +
+		"tool_call call_2,tool_result call_2 error,message,done"
+	if got := strings.Join(events, ","); got != wantEvents {
+		t.Errorf("events = %s\nwant %s", got, wantEvents)
+	}
+}
+
+func TestRunMaxIterations(t *testing.T) {
+	p := &fakeProvider{responses: []llm.Message{calls("echo")}}
+	tb := fakeToolbox{"echo": func(ctx context.Context, call llm.ToolCall) (any, error) { return "ok", nil }}
+	r := New(p, tb)
+	r.MaxIterations = 3
+
+	msgs, err := r.Run(context.Background(), "loop", nil)
+	if !errors.Is(err, ErrMaxIterations) {
+		t.Fatalf("err = %v, want ErrMaxIterations", err)
+	}
+	if len(p.requests) != 3 {
+		t.Errorf("requests = %d, want 3", len(p.requests))
+	}
+	if len(msgs) != 1+3*2 {
+		t.Errorf("messages = %d, want 7", len(msgs))
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	p := &fakeProvider{responses: []llm.Message{calls("wait", "wait", "wait"), answer("done")}}
+	var started sync.WaitGroup
+	started.Add(3)
+	tb := fakeToolbox{"wait": func(ctx context.Context, call llm.ToolCall) (any, error) {
+		// Each call waits for all to start, which only happens if they
+		// run concurrently; the last call returns first.
+		started.Done()
+		started.Wait()
+		n := call.Arguments()["n"].(int)
+		time.Sleep(time.Duration(2-n) * 10 * time.Millisecond)
+		return fmt.Sprint("result ", n), nil
+	}}
+	r := New(p, tb)
+	r.Parallel = true
+	var mu sync.Mutex
+	inEvent := false
+	r.OnEvent = func(ev *Event) {
+		mu.Lock()
+		if inEvent {
+			t.Error("OnEvent called concurrently")
+		}
+		inEvent = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inEvent = false
+		mu.Unlock()
+	}
+
+	done := make(chan struct{})
+	var msgs []llm.Message
+	var err error
+	go func() {
+		msgs, err = r.Run(context.Background(), "go", nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("tool calls did not run concurrently")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "user:go | assistant: wait wait wait | tool:result 0 | tool:result 1 | tool:result 2 | assistant:done"
+	if got := describe(msgs); got != want {
+		t.Errorf("messages = %s\nwant %s", got, want)
+	}
+}
+
+func TestRunCancelDuringTool(t *testing.T) {
+	p := &fakeProvider{responses: []llm.Message{calls("block", "never"), answer("done")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	never := false
+	tb := fakeToolbox{
+		"block": func(ctx context.Context, call llm.ToolCall) (any, error) {
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		"never": func(ctx context.Context, call llm.ToolCall) (any, error) {
+			never = true
+			return "ran", nil
+		},
+	}
+	r := New(p, tb)
+
+	msgs, err := r.Run(ctx, "go", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context canceled", err)
+	}
+	if never {
+		t.Error("tool called after cancellation")
+	}
+	if len(p.requests) != 1 {
+		t.Errorf("requests = %d, want 1", len(p.requests))
+	}
+	if got, want := describe(msgs), "user:go | assistant: block never"; got != want {
+		t.Errorf("messages = %s, want %s", got, want)
+	}
+}
+
+type fakeMeter struct {
+	allowed int
+	records int
+}
+
+func (m *fakeMeter) Allow() error {
+	if m.allowed == 0 {
+		return errors.New("budget exceeded")
+	}
+	m.allowed--
+	return nil
+}
+
+func (m *fakeMeter) Record(msg llm.Message) error {
+	m.records++
+	return nil
+}
+
+func TestRunMeter(t *testing.T) {
+	p := &fakeProvider{responses: []llm.Message{calls("echo")}}
+	tb := fakeToolbox{"echo": func(ctx context.Context, call llm.ToolCall) (any, error) { return "ok", nil }}
+	r := New(p, tb)
+	m := &fakeMeter{allowed: 2}
+	r.Meter = m
+
+	_, err := r.Run(context.Background(), "go", nil)
+	if err == nil || err.Error() != "budget exceeded" {
+		t.Fatalf("err = %v, want budget exceeded", err)
+	}
+	if len(p.requests) != 2 || m.records != 2 {
+		t.Errorf("requests = %d, records = %d, want 2", len(p.requests), m.records)
+	}
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"github.com/goplus/xgowiz/llm"
+)
+
+// EventKind identifies the kind of an Event.
+type EventKind int
+
+const (
+	// EventMessage reports a message received from the LLM.
+	EventMessage EventKind = iota
+
+	// EventToolCall reports a tool call about to be executed.
+	EventToolCall
+
+	// EventToolResult reports the result of an executed tool call.
+	EventToolResult
+
+	// EventDone reports the final answer of the LLM.
+	EventDone
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventMessage:
+		return "message"
+	case EventToolCall:
+		return "tool_call"
+	case EventToolResult:
+		return "tool_result"
+	case EventDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// Event represents a step of a Runner.
+type Event struct {
+	Kind EventKind
+
+	// Iteration is the index of the LLM round trip the event belongs to.
+	Iteration int
+
+	// Message is the message received from the LLM for EventMessage and
+	// EventDone, or the tool response for EventToolResult.
+	Message llm.Message
+
+	// ToolCall is the tool call of EventToolCall and EventToolResult.
+	ToolCall llm.ToolCall
+
+	// Result is the result of the tool call for EventToolResult. If the
+	// tool failed, Err is the error and Result is its description sent
+	// to the LLM.
+	Result any
+	Err    error
+}
@@ -5,14 +5,35 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/internal/sse"
+	"github.com/goplus/xgowiz/llm/retry"
 )
 
 type Client struct {
 	apiKey  string
 	client  *http.Client
 	baseURL string
+	retry   *retry.Policy
+}
+
+const defaultBaseURL = "https://api.anthropic.com/v1"
+
+// endpoint returns the URL of the API at baseURL, which may omit the /v1
+// suffix, or the default URL if baseURL is empty.
+func endpoint(baseURL string) string {
+	if baseURL == "" {
+		return defaultBaseURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !strings.HasSuffix(baseURL, "/v1") {
+		baseURL += "/v1"
+	}
+	return baseURL
 }
 
 func NewClient(apiKey string, baseURL string, client *http.Client) *Client {
@@ -20,64 +41,167 @@ func NewClient(apiKey string, baseURL string, client *http.Client) *Client {
 }
 
 func (c *Client) Init(apiKey string, baseURL string, client *http.Client) *Client {
-	if baseURL == "" {
-		baseURL = "https://api.anthropic.com/v1"
-	} else if !strings.HasSuffix(baseURL, "/v1") {
-		baseURL = strings.TrimSuffix(baseURL, "/") + "/v1"
-	}
+	baseURL = endpoint(baseURL)
 	if client == nil {
 		client = http.DefaultClient
 	}
 	c.apiKey = apiKey
 	c.baseURL = baseURL
 	c.client = client
+	c.retry = retry.Default()
 	return c
 }
 
+// SetRetryPolicy sets the policy to retry requests failed with transient
+// errors. A nil policy disables retries.
+func (c *Client) SetRetryPolicy(policy *retry.Policy) {
+	c.retry = policy
+}
+
 func (c *Client) SendMessage(ctx context.Context, req CreateRequest) (*APIMessage, error) {
-	body, err := json.Marshal(req)
+	resp, err := c.post(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling request: %w", err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	url := c.baseURL + "/messages"
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+	var message APIMessage
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-Api-Key", c.apiKey)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	return &message, nil
+}
 
-	resp, err := c.client.Do(httpReq)
+// StreamMessage sends a streaming request and calls fn for each event
+// received. It returns the message assembled from all events.
+func (c *Client) StreamMessage(ctx context.Context, req CreateRequest, fn func(ev *StreamEvent) error) (*APIMessage, error) {
+	req.Stream = true
+	resp, err := c.post(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		var errResp struct {
-			Error struct {
-				Type    string `json:"type"`
-				Message string `json:"message"`
-			} `json:"error"`
+	var message APIMessage
+	var inputs []string // partial JSON of tool_use blocks
+	r := sse.NewReader(resp.Body)
+	for {
+		e, err := r.Next()
+		if err != nil {
+			if err == io.EOF { // the stream ends with message_stop
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("error reading stream: %w", err)
 		}
-		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-			return nil, fmt.Errorf("error response with status %d", resp.StatusCode)
+		if e.Data == "" {
+			continue
 		}
-
-		if errResp.Error.Type == "overloaded_error" {
-			return nil, fmt.Errorf("overloaded_error: %s", errResp.Error.Message)
+		var ev StreamEvent
+		if err := json.Unmarshal([]byte(e.Data), &ev); err != nil {
+			return nil, fmt.Errorf("error decoding stream event: %w", err)
+		}
+		switch ev.Type {
+		case "message_start":
+			if ev.Message != nil {
+				message = *ev.Message
+			}
+		case "content_block_start":
+			if ev.ContentBlock != nil {
+				for len(message.Content) <= ev.Index {
+					message.Content = append(message.Content, ContentBlock{})
+					inputs = append(inputs, "")
+				}
+				message.Content[ev.Index] = *ev.ContentBlock
+			}
+		case "content_block_delta":
+			if ev.Delta != nil && ev.Index < len(message.Content) {
+				switch ev.Delta.Type {
+				case "text_delta":
+					message.Content[ev.Index].Text += ev.Delta.Text
+				case "input_json_delta":
+					inputs[ev.Index] += ev.Delta.PartialJSON
+				case "thinking_delta":
+					message.Content[ev.Index].Thinking += ev.Delta.Thinking
+				case "signature_delta":
+					message.Content[ev.Index].Signature += ev.Delta.Signature
+				}
+			}
+		case "content_block_stop":
+			if ev.Index < len(message.Content) && message.Content[ev.Index].Type == "tool_use" {
+				input := inputs[ev.Index]
+				if input == "" {
+					input = "{}"
+				}
+				message.Content[ev.Index].Input = json.RawMessage(input)
+			}
+		case "message_delta":
+			if ev.Delta != nil {
+				message.StopReason = ev.Delta.StopReason
+				message.StopSequence = ev.Delta.StopSequence
+			}
+			if ev.Usage != nil {
+				message.Usage.OutputTokens = ev.Usage.OutputTokens
+			}
+		case "error":
+			e := llm.NewError("anthropic", 0, "", "error event in stream: "+e.Data)
+			if ev.Error != nil {
+				e = llm.NewError("anthropic", 0, ev.Error.Type, ev.Error.Message)
+			}
+			e.RequestID = resp.Header.Get("request-id")
+			return nil, e
+		}
+		if err := fn(&ev); err != nil {
+			return nil, err
+		}
+		if ev.Type == "message_stop" {
+			return &message, nil
 		}
-
-		return nil, fmt.Errorf("%s: %s", errResp.Error.Type, errResp.Error.Message)
 	}
+}
 
-	var message APIMessage
-	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
-		return nil, fmt.Errorf("error decoding response: %w", err)
+func (c *Client) post(ctx context.Context, req CreateRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	return &message, nil
+	url := c.baseURL + "/messages"
+	return c.retry.Do(ctx, func() (*http.Response, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("X-Api-Key", c.apiKey)
+		httpReq.Header.Set("anthropic-version", "2023-06-01")
+		if req.Stream {
+			httpReq.Header.Set("Accept", "text/event-stream")
+		}
+
+		resp, err := c.client.Do(httpReq)
+		if err != nil {
+			return nil, fmt.Errorf("error making request: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, responseError(resp)
+		}
+		return resp, nil
+	})
+}
+
+// responseError decodes the error of a failed response. It is returned
+// from within the retry loop, so that the policy sees whether the error
+// is worth retrying.
+func responseError(resp *http.Response) error {
+	var errResp struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	return llm.NewHTTPError("anthropic", resp, "request-id", errResp.Error.Type, errResp.Error.Message)
 }
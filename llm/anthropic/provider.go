@@ -2,9 +2,11 @@ package anthropic
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"reflect"
 	"strings"
 
@@ -14,12 +16,29 @@ import (
 )
 
 var (
-	_ llm.Provider = (*Provider)(nil)
+	_ llm.Provider          = (*Provider)(nil)
+	_ llm.StreamingProvider = (*Provider)(nil)
+	_ llm.Configurable      = (*Provider)(nil)
 )
 
+func init() {
+	llm.Register("anthropic", func(ctx context.Context, conf *llm.ProviderConfig) (llm.Provider, error) {
+		apiKey := conf.APIKey
+		if apiKey == "" {
+			// The key of Anthropic is not sent to other services
+			if endpoint(conf.BaseURL) != defaultBaseURL {
+				return nil, fmt.Errorf("anthropic: no API key for %s", conf.BaseURL)
+			}
+			apiKey = os.Getenv("ANTHROPIC_API_KEY")
+		}
+		return NewProvider(apiKey, conf.BaseURL, nil, conf.Model), nil
+	})
+}
+
 type Provider struct {
 	client Client
 	model  string
+	opts   []llm.Option
 }
 
 func NewProvider(apiKey string, baseURL string, client *http.Client, model string) *Provider {
@@ -33,12 +52,77 @@ func NewProvider(apiKey string, baseURL string, client *http.Client, model strin
 	return ret
 }
 
-func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool) (llm.Message, error) {
+func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool, opts ...llm.Option) (llm.Message, error) {
+	// Make the API call
+	resp, err := p.client.SendMessage(ctx, p.createRequest(prompt, messages, tools, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{Msg: *resp}, nil
+}
+
+func (p *Provider) StreamMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool, handler llm.StreamHandler, opts ...llm.Option) (llm.Message, error) {
+	toolIndex := make(map[int]int) // content block index => tool call index
+	resp, err := p.client.StreamMessage(ctx, p.createRequest(prompt, messages, tools, opts), func(ev *StreamEvent) error {
+		switch ev.Type {
+		case "content_block_start":
+			if block := ev.ContentBlock; block != nil && block.Type == "tool_use" {
+				idx := len(toolIndex)
+				toolIndex[ev.Index] = idx
+				return handler(&llm.Chunk{
+					Kind:  llm.ChunkToolCall,
+					Index: idx,
+					ID:    block.ID,
+					Name:  block.Name,
+				})
+			}
+		case "content_block_delta":
+			if ev.Delta == nil {
+				break
+			}
+			switch ev.Delta.Type {
+			case "text_delta":
+				return handler(&llm.Chunk{Kind: llm.ChunkText, Text: ev.Delta.Text})
+			case "thinking_delta":
+				return handler(&llm.Chunk{Kind: llm.ChunkReasoning, Text: ev.Delta.Thinking})
+			case "input_json_delta":
+				return handler(&llm.Chunk{
+					Kind:      llm.ChunkToolCall,
+					Index:     toolIndex[ev.Index],
+					Arguments: ev.Delta.PartialJSON,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{Msg: *resp}
+	input, output := msg.StatUsage()
+	err = handler(&llm.Chunk{
+		Kind:         llm.ChunkUsage,
+		InputTokens:  input,
+		OutputTokens: output,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (p *Provider) createRequest(prompt string, messages []llm.Message, tools []llm.Tool, opts []llm.Option) CreateRequest {
 	log.Debug("creating message",
 		"prompt", prompt,
 		"num_messages", len(messages),
 		"num_tools", len(tools))
 
+	// Anthropic takes the system prompt as a top-level parameter
+	o := p.options(opts)
+	system, messages := llm.SystemPrompt(o, messages)
+
 	anthropicMessages := make([]MessageParam, 0, len(messages))
 
 	for _, msg := range messages {
@@ -49,12 +133,24 @@ func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []ll
 
 		content := []ContentBlock{}
 
-		// Add regular text content if present
-		if textContent := strings.TrimSpace(msg.Content()); textContent != "" {
-			content = append(content, ContentBlock{
-				Type: "text",
-				Text: textContent,
-			})
+		// Thinking blocks go back unchanged before the tool calls they led
+		// to, the API checks their signatures
+		for _, t := range llm.ThoughtsOf(msg) {
+			if t.Redacted != "" {
+				content = append(content, ContentBlock{Type: "redacted_thinking", Data: t.Redacted})
+			} else if t.Signature != "" {
+				content = append(content, ContentBlock{Type: "thinking", Thinking: t.Text, Signature: t.Signature})
+			}
+		}
+
+		// Add regular content if present, the content of a tool response
+		// is carried by its tool_result block
+		if !llm.IsToolResponse(msg) {
+			for _, part := range llm.PartsOf(msg) {
+				if block, ok := partBlock(part); ok {
+					content = append(content, block)
+				}
+			}
 		}
 
 		// Add tool calls if present
@@ -94,10 +190,16 @@ func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []ll
 			}
 		}
 
+		// Anthropic expects tool results in user messages
+		role := msg.Role()
+		if llm.IsToolResponse(msg) {
+			role = "user"
+		}
+
 		// Always append the message, even if content is empty
 		// This maintains conversation flow
 		anthropicMessages = append(anthropicMessages, MessageParam{
-			Role:    msg.Role(),
+			Role:    role,
 			Content: content,
 		})
 	}
@@ -131,18 +233,202 @@ func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []ll
 		"messages", anthropicMessages,
 		"num_tools", len(tools))
 
-	// Make the API call
-	resp, err := p.client.SendMessage(ctx, CreateRequest{
-		Model:     p.model,
-		Messages:  anthropicMessages,
-		MaxTokens: 4096,
-		Tools:     anthropicTools,
-	})
-	if err != nil {
-		return nil, err
+	maxTokens := o.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 4096
+	}
+	if o.Seed != nil {
+		llm.WarnUnsupported("anthropic", "seed")
+	}
+	if o.PresencePenalty != nil {
+		llm.WarnUnsupported("anthropic", "presence_penalty")
+	}
+	if o.FrequencyPenalty != nil {
+		llm.WarnUnsupported("anthropic", "frequency_penalty")
 	}
 
-	return &Message{Msg: *resp}, nil
+	req := CreateRequest{
+		Model:         p.model,
+		Messages:      anthropicMessages,
+		MaxTokens:     maxTokens,
+		Tools:         anthropicTools,
+		Temperature:   o.Temperature,
+		TopP:          o.TopP,
+		TopK:          o.TopK,
+		StopSequences: o.Stop,
+	}
+	if system != "" {
+		req.System = []ContentBlock{{Type: "text", Text: system}}
+	}
+
+	if len(req.Tools) > 0 {
+		req.ToolChoice = toolChoice(o)
+	}
+
+	// Anthropic has no JSON mode, the response is the input of a tool the
+	// model is forced to call
+	if f := o.ResponseFormat; f != nil {
+		schema := InputSchema{Type: "object", Properties: map[string]any{}}
+		if props, ok := f.Schema["properties"].(map[string]any); ok {
+			schema.Properties = props
+			schema.Required = stringList(f.Schema["required"])
+		}
+		description := f.Description
+		if description == "" {
+			description = "Respond with the result."
+		}
+		req.Tools = append(req.Tools, Tool{Name: f.Name, Description: description, InputSchema: schema})
+		req.ToolChoice = &ToolChoice{Type: "tool", Name: f.Name}
+	}
+
+	if o.Thinking > 0 {
+		p.think(&req, o.Thinking)
+	}
+	if !o.NoCache {
+		cache(&req)
+	}
+	return req
+}
+
+// cache sets the cache breakpoints of req, at most 4 for the API: after
+// the tools, after the system prompt, after the last message and after
+// the last user message before it. The latter ends the prompt of the
+// previous request of an agent loop, cached by it. Prefixes shorter than
+// the minimum cacheable length of the model are not cached.
+func cache(req *CreateRequest) {
+	ephemeral := &CacheControl{Type: "ephemeral"}
+	if n := len(req.Tools); n > 0 {
+		req.Tools[n-1].CacheControl = ephemeral
+	}
+	if n := len(req.System); n > 0 {
+		req.System[n-1].CacheControl = ephemeral
+	}
+	last := true
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		msg := &req.Messages[i]
+		if !last && msg.Role != "user" {
+			continue
+		}
+		if markLast(msg.Content, ephemeral) {
+			if !last {
+				return
+			}
+			last = false
+		}
+	}
+}
+
+// markLast sets the cache control of the last block of content that may
+// have one.
+func markLast(content []ContentBlock, cc *CacheControl) bool {
+	for i := len(content) - 1; i >= 0; i-- {
+		b := &content[i]
+		switch {
+		case b.Type == "thinking" || b.Type == "redacted_thinking":
+		case b.Type == "text" && b.Text == "":
+		default:
+			b.CacheControl = cc
+			return true
+		}
+	}
+	return false
+}
+
+// think enables extended thinking with budget tokens. Thinking is
+// incompatible with forced tool calls and with some sampling options.
+func (p *Provider) think(req *CreateRequest, budget int) {
+	if tc := req.ToolChoice; tc != nil && (tc.Type == "any" || tc.Type == "tool") {
+		log.Warn("thinking disabled when a tool call is forced", "provider", "anthropic")
+		return
+	}
+	if budget < 1024 { // minimum budget of the API
+		budget = 1024
+	}
+	req.Thinking = &Thinking{Type: "enabled", BudgetTokens: budget}
+	if req.MaxTokens <= budget {
+		req.MaxTokens = budget + 4096
+	}
+	if req.Temperature != nil || req.TopK != nil {
+		log.Warn("temperature and top_k ignored when thinking", "provider", "anthropic")
+		req.Temperature, req.TopK = nil, nil
+	}
+}
+
+func toolChoice(o *llm.Options) *ToolChoice {
+	if o.ToolChoice == nil && o.ParallelToolCalls == nil {
+		return nil
+	}
+	ret := &ToolChoice{Type: "auto"}
+	if tc := o.ToolChoice; tc != nil {
+		switch tc.Mode {
+		case llm.ToolChoiceNone:
+			ret.Type = "none"
+		case llm.ToolChoiceRequired:
+			ret.Type = "any"
+		case llm.ToolChoiceTool:
+			ret.Type, ret.Name = "tool", tc.Name
+		}
+	}
+	if p := o.ParallelToolCalls; p != nil && ret.Type != "none" {
+		ret.DisableParallelToolUse = !*p
+	}
+	return ret
+}
+
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []any:
+		ret := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// partBlock converts a content part into a text, image or document block.
+func partBlock(part llm.Part) (ContentBlock, bool) {
+	if part.Type == llm.PartText {
+		text := strings.TrimSpace(part.Text)
+		return ContentBlock{Type: "text", Text: text}, text != ""
+	}
+	src := &Source{MediaType: part.MediaType}
+	switch {
+	case part.Data == nil:
+		src.Type, src.URL = "url", part.URL
+	case part.Type == llm.PartDocument && part.IsText():
+		src.Type, src.MediaType, src.Data = "text", "text/plain", string(part.Data)
+	case part.Type == llm.PartDocument && part.MediaType != "application/pdf":
+		llm.WarnUnsupported("anthropic", "document of type "+part.MediaType)
+		return ContentBlock{}, false
+	default:
+		src.Type, src.Data = "base64", base64.StdEncoding.EncodeToString(part.Data)
+	}
+	block := ContentBlock{Type: part.Type, Source: src}
+	if part.Type == llm.PartDocument {
+		block.Title = part.Name
+	}
+	return block, true
+}
+
+// SetOptions sets the default options of all requests.
+func (p *Provider) SetOptions(opts ...llm.Option) {
+	p.opts = opts
+}
+
+func (p *Provider) options(opts []llm.Option) *llm.Options {
+	return llm.NewOptions(append(p.opts[:len(p.opts):len(p.opts)], opts...)...)
+}
+
+// Client returns the underlying API client, e.g. to configure its retry
+// policy.
+func (p *Provider) Client() *Client {
+	return &p.client
 }
 
 func (p *Provider) SupportsTools() bool {
@@ -0,0 +1,197 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/history"
+)
+
+const (
+	blockingResponse = `{"id":"msg_1","type":"message","role":"assistant","model":"m",
+"content":[{"type":"text","text":"Hello, world"},
+{"type":"tool_use","id":"toolu_1","name":"read","input":{"path":"a.xgo"}},
+{"type":"tool_use","id":"toolu_2","name":"build","input":{}}],
+"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5}}`
+
+	streamResponse = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"m","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":", world"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"read","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"pa"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"th\": \"a.x"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"go\"}"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: content_block_start
+data: {"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"build","input":{}}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":2}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}
+
+`
+	streamEnd = `event: message_stop
+data: {"type":"message_stop"}
+
+`
+)
+
+// newStreamServer serves the blocking response to blocking requests, and
+// stream to streaming ones.
+func newStreamServer(t *testing.T, stream string) *Provider {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, blockingResponse)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, stream)
+	}))
+	t.Cleanup(srv.Close)
+	return NewProvider("key", srv.URL, srv.Client(), "m")
+}
+
+func TestStreamMessage(t *testing.T) {
+	p := newStreamServer(t, streamResponse+streamEnd)
+	ctx := context.Background()
+	want, err := p.SendMessage(ctx, "hello", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text strings.Builder
+	args := make(map[int]string)
+	ids := make(map[int]string)
+	var usage *llm.Chunk
+	got, err := p.StreamMessage(ctx, "hello", nil, nil, func(c *llm.Chunk) error {
+		switch c.Kind {
+		case llm.ChunkText:
+			text.WriteString(c.Text)
+		case llm.ChunkToolCall:
+			if c.ID != "" {
+				ids[c.Index] = c.ID
+			}
+			args[c.Index] += c.Arguments
+		case llm.ChunkUsage:
+			usage = c
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Role() != want.Role() || got.Content() != want.Content() {
+		t.Errorf("message = %s %q, want %s %q", got.Role(), got.Content(), want.Role(), want.Content())
+	}
+	if text.String() != want.Content() {
+		t.Errorf("streamed text = %q, want %q", text.String(), want.Content())
+	}
+	gotCalls, wantCalls := got.ToolCalls(), want.ToolCalls()
+	if len(gotCalls) != len(wantCalls) {
+		t.Fatalf("got %d tool calls, want %d", len(gotCalls), len(wantCalls))
+	}
+	for i, w := range wantCalls {
+		g := gotCalls[i]
+		if g.ID() != w.ID() || g.Name() != w.Name() || !reflect.DeepEqual(g.Arguments(), w.Arguments()) {
+			t.Errorf("call %d = %s %s %v, want %s %s %v", i, g.ID(), g.Name(), g.Arguments(), w.ID(), w.Name(), w.Arguments())
+		}
+		if ids[i] != w.ID() {
+			t.Errorf("streamed id of call %d = %q", i, ids[i])
+		}
+	}
+	if args[0] != `{"path": "a.xgo"}` || args[1] != "" {
+		t.Errorf("streamed arguments = %q", args)
+	}
+	gi, gout := got.StatUsage()
+	wi, wo := want.StatUsage()
+	if gi != wi || gout != wo {
+		t.Errorf("usage = %d/%d, want %d/%d", gi, gout, wi, wo)
+	}
+	if usage == nil || usage.InputTokens != wi || usage.OutputTokens != wo {
+		t.Errorf("usage chunk = %+v", usage)
+	}
+}
+
+func TestStreamMessageTruncated(t *testing.T) {
+	p := newStreamServer(t, streamResponse)
+	_, err := p.StreamMessage(context.Background(), "hello", nil, nil, func(*llm.Chunk) error { return nil })
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("err = %v, want unexpected EOF", err)
+	}
+}
+
+func TestCreateRequestToolResponse(t *testing.T) {
+	p := NewProvider("key", "", nil, "m")
+	resp, err := p.CreateToolResponse("toolu_1", "package a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []llm.Message{history.NewTextMessage("user", "read a.xgo"), resp}
+	req := p.createRequest("", messages, nil, nil)
+	if len(req.Messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(req.Messages))
+	}
+	got := req.Messages[1]
+	if got.Role != "user" {
+		t.Errorf("tool response role = %s, want user", got.Role)
+	}
+	if len(got.Content) != 1 || got.Content[0].Type != "tool_result" || got.Content[0].ToolUseID != "toolu_1" {
+		t.Errorf("tool response content = %+v, want a single tool_result block", got.Content)
+	}
+}
+
+func TestFactoryAPIKey(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-env")
+	p, err := llm.New(context.Background(), "anthropic", &llm.ProviderConfig{BaseURL: "https://api.anthropic.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.(*Provider).client.apiKey; got != "sk-env" {
+		t.Errorf("API key = %q, want sk-env", got)
+	}
+	_, err = llm.New(context.Background(), "anthropic", &llm.ProviderConfig{BaseURL: "https://proxy.example.com"})
+	if err == nil || !strings.Contains(err.Error(), "no API key") {
+		t.Errorf("err = %v, want no API key", err)
+	}
+}
@@ -11,9 +11,30 @@ import (
 
 type CreateRequest struct {
 	Model     string         `json:"model"`
+	System    []ContentBlock `json:"system,omitempty"`
 	Messages  []MessageParam `json:"messages"`
 	MaxTokens int            `json:"max_tokens"`
 	Tools     []Tool         `json:"tools,omitempty"`
+	Stream    bool           `json:"stream,omitempty"`
+
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	StopSequences []string `json:"stop_sequences,omitempty"`
+
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+	Thinking   *Thinking   `json:"thinking,omitempty"`
+}
+
+type Thinking struct {
+	Type         string `json:"type"` // enabled or disabled
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+type ToolChoice struct {
+	Type                   string `json:"type"` // auto, any, tool or none
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
 }
 
 type MessageParam struct {
@@ -29,12 +50,34 @@ type ContentBlock struct {
 	Name      string          `json:"name,omitempty"`
 	Input     json.RawMessage `json:"input,omitempty"`
 	Content   any             `json:"content,omitempty"`
+	Source    *Source         `json:"source,omitempty"`
+	Title     string          `json:"title,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	Data      string          `json:"data,omitempty"` // redacted thinking
+
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// CacheControl marks the end of a prompt prefix to cache.
+type CacheControl struct {
+	Type string `json:"type"` // ephemeral
+}
+
+// Source is the data of an image or a document block.
+type Source struct {
+	Type      string `json:"type"` // base64, text or url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
 }
 
 type Tool struct {
 	Name        string      `json:"name"`
 	Description string      `json:"description"`
 	InputSchema InputSchema `json:"input_schema"`
+
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 type InputSchema struct {
@@ -55,8 +98,38 @@ type APIMessage struct {
 }
 
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// StreamEvent represents an event of a streaming response.
+type StreamEvent struct {
+	Type         string        `json:"type"`
+	Index        int           `json:"index"`
+	Message      *APIMessage   `json:"message,omitempty"`
+	ContentBlock *ContentBlock `json:"content_block,omitempty"`
+	Delta        *StreamDelta  `json:"delta,omitempty"`
+	Usage        *Usage        `json:"usage,omitempty"`
+	Error        *StreamError  `json:"error,omitempty"`
+}
+
+// StreamDelta is the delta of a content_block_delta or message_delta event.
+type StreamDelta struct {
+	Type         string  `json:"type"`
+	Text         string  `json:"text,omitempty"`
+	PartialJSON  string  `json:"partial_json,omitempty"`
+	Thinking     string  `json:"thinking,omitempty"`
+	Signature    string  `json:"signature,omitempty"`
+	StopReason   *string `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+}
+
+// StreamError is the payload of an error event.
+type StreamError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
 }
 
 // Message implements the llm.Message interface
@@ -141,8 +214,35 @@ func (m *Message) ToolResponse() (toolCallID string, ok bool) {
 	return
 }
 
+// Thoughts implements llm.ReasoningMessage.
+func (m *Message) Thoughts() []llm.Thought {
+	var thoughts []llm.Thought
+	for _, block := range m.Msg.Content {
+		switch block.Type {
+		case "thinking":
+			thoughts = append(thoughts, llm.Thought{Text: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			thoughts = append(thoughts, llm.Thought{Redacted: block.Data})
+		}
+	}
+	return thoughts
+}
+
 func (m *Message) StatUsage() (input int, output int) {
-	return m.Msg.Usage.InputTokens, m.Msg.Usage.OutputTokens
+	u := m.Usage()
+	return u.InputTokens, u.OutputTokens
+}
+
+// Usage implements llm.UsageReporter. The input tokens reported by the API
+// exclude the tokens read from or written to the cache, they are added.
+func (m *Message) Usage() llm.Usage {
+	u := m.Msg.Usage
+	return llm.Usage{
+		InputTokens:      u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
 }
 
 // ToolCall implements the llm.ToolCall interface
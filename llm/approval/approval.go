@@ -0,0 +1,224 @@
+// Package approval puts a human in the loop of tool execution: a Gate
+// wraps the Toolbox of an agent and decides, for each tool call, whether
+// it runs according to a Policy and, if the policy says so, to the answer
+// of the user.
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/agent"
+)
+
+var (
+	_ agent.Toolbox = (*Gate)(nil)
+)
+
+// ErrDenied is wrapped by the errors of denied tool calls.
+var ErrDenied = errors.New("tool call denied")
+
+// Answer is the answer of the user to an approval prompt.
+type Answer int
+
+const (
+	// DenyOnce refuses the call.
+	DenyOnce Answer = iota
+	// AllowOnce executes the call.
+	AllowOnce
+	// AllowSession executes the call and all later calls of the same tool.
+	AllowSession
+)
+
+// Prompt asks the user whether to execute call.
+type Prompt func(ctx context.Context, call llm.ToolCall) (Answer, error)
+
+// Record is the audit record of a decision.
+type Record struct {
+	Time      time.Time      `json:"time"`
+	Tool      string         `json:"tool"`
+	CallID    string         `json:"call_id,omitempty"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+	Allowed   bool           `json:"allowed"`
+	By        string         `json:"by"` // policy, user, session or no-prompt
+	Rule      string         `json:"rule,omitempty"`
+	Err       string         `json:"error,omitempty"`
+}
+
+// Gate is a Toolbox executing the tool calls approved by a policy or the
+// user. It is safe for concurrent use; prompts are shown one at a time.
+type Gate struct {
+	tools  agent.Toolbox
+	policy *Policy
+
+	// Prompt asks the user about the calls the policy wants to ask for. If
+	// nil, these calls are denied.
+	Prompt Prompt
+
+	// Audit is called with the record of every decision if not nil.
+	Audit func(rec *Record)
+
+	mu      sync.Mutex
+	session map[string]bool // tools allowed for the session
+	prompt  sync.Mutex      // serializes prompts
+}
+
+// New creates a Gate in front of tools. If policy is nil, all calls are
+// asked for.
+func New(tools agent.Toolbox, policy *Policy) (*Gate, error) {
+	if policy == nil {
+		policy = new(Policy)
+	}
+	if err := policy.Compile(); err != nil {
+		return nil, err
+	}
+	return &Gate{tools: tools, policy: policy, session: make(map[string]bool)}, nil
+}
+
+// Tools returns the tools that are not denied by the policy.
+func (g *Gate) Tools() []llm.Tool {
+	tools := g.tools.Tools()
+	ret := tools[:0:0]
+	for _, t := range tools {
+		if !g.policy.Denied(t.Name) {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// AllowSession allows the tool name for the rest of the session.
+func (g *Gate) AllowSession(name string) {
+	g.mu.Lock()
+	g.session[name] = true
+	g.mu.Unlock()
+}
+
+// Session returns the tools allowed for the session.
+func (g *Gate) Session() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	names := make([]string, 0, len(g.session))
+	for name := range g.session {
+		names = append(names, name)
+	}
+	return names
+}
+
+// ResetSession forgets the tools allowed for the session.
+func (g *Gate) ResetSession() {
+	g.mu.Lock()
+	g.session = make(map[string]bool)
+	g.mu.Unlock()
+}
+
+// CallTool executes call if it is approved. Otherwise it returns an error
+// wrapping ErrDenied, which the agent reports to the LLM.
+func (g *Gate) CallTool(ctx context.Context, call llm.ToolCall) (any, error) {
+	rec := &Record{
+		Time:      time.Now(),
+		Tool:      call.Name(),
+		CallID:    call.ID(),
+		Arguments: call.Arguments(),
+	}
+	err := g.approve(ctx, call, rec)
+	if g.Audit != nil {
+		if err != nil && !errors.Is(err, ErrDenied) {
+			rec.Err = err.Error()
+		}
+		g.Audit(rec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g.tools.CallTool(ctx, call)
+}
+
+// Call executes the tool named name with args if the call is approved, as
+// CallTool does. It lets the tools behind the gate be published as plain
+// handlers, such as by an MCP server.
+func (g *Gate) Call(ctx context.Context, name string, args map[string]any) (any, error) {
+	return g.CallTool(ctx, &toolCall{name: name, args: args})
+}
+
+// toolCall is a tool call made without an LLM message.
+type toolCall struct {
+	name string
+	args map[string]any
+}
+
+func (c *toolCall) Name() string              { return c.name }
+func (c *toolCall) Arguments() map[string]any { return c.args }
+func (c *toolCall) ID() string                { return "" }
+
+func (g *Gate) approve(ctx context.Context, call llm.ToolCall, rec *Record) error {
+	action, rule, err := g.policy.Decide(call.Name(), call.Arguments())
+	if err != nil {
+		return err
+	}
+	rec.By = "policy"
+	if rule != nil {
+		rec.Rule = rule.String()
+	}
+	switch action {
+	case Allow:
+		rec.Allowed = true
+		return nil
+	case Deny:
+		return fmt.Errorf("%w by policy: %s", ErrDenied, call.Name())
+	}
+
+	g.mu.Lock()
+	allowed := g.session[call.Name()]
+	g.mu.Unlock()
+	if allowed {
+		rec.Allowed, rec.By = true, "session"
+		return nil
+	}
+	if g.Prompt == nil {
+		rec.By = "no-prompt"
+		return fmt.Errorf("%w: %s needs approval and nobody can give it", ErrDenied, call.Name())
+	}
+
+	g.prompt.Lock()
+	defer g.prompt.Unlock()
+	g.mu.Lock() // allowed meanwhile by another prompt?
+	allowed = g.session[call.Name()]
+	g.mu.Unlock()
+	if allowed {
+		rec.Allowed, rec.By = true, "session"
+		return nil
+	}
+	rec.By = "user"
+	answer, err := g.Prompt(ctx, call)
+	if err != nil {
+		return err
+	}
+	switch answer {
+	case AllowSession:
+		g.AllowSession(call.Name())
+		fallthrough
+	case AllowOnce:
+		rec.Allowed = true
+		return nil
+	}
+	return fmt.Errorf("%w by the user: %s", ErrDenied, call.Name())
+}
+
+// JSONLog returns an Audit function writing the records to w as JSON
+// lines.
+func JSONLog(w io.Writer) func(rec *Record) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(rec *Record) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(rec)
+	}
+}
@@ -0,0 +1,158 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+type call struct {
+	name string
+	args map[string]any
+}
+
+func (c *call) ID() string                { return "call_" + c.name }
+func (c *call) Name() string              { return c.name }
+func (c *call) Arguments() map[string]any { return c.args }
+
+// toolbox records the tools it calls.
+type toolbox struct {
+	mu     sync.Mutex
+	called []string
+}
+
+func (tb *toolbox) Tools() []llm.Tool {
+	return []llm.Tool{{Name: "read_file"}, {Name: "fs_write"}, {Name: "shell"}}
+}
+
+func (tb *toolbox) CallTool(ctx context.Context, c llm.ToolCall) (any, error) {
+	tb.mu.Lock()
+	tb.called = append(tb.called, c.Name())
+	tb.mu.Unlock()
+	return "ok", nil
+}
+
+func newGate(t *testing.T, answers ...Answer) (*Gate, *toolbox, *[]string) {
+	t.Helper()
+	tb := new(toolbox)
+	g, err := New(tb, &Policy{Rules: []*Rule{
+		{Tool: "read_file", Action: Allow},
+		{Tool: "fs_*", Action: Deny},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prompted []string
+	g.Prompt = func(ctx context.Context, c llm.ToolCall) (Answer, error) {
+		prompted = append(prompted, c.Name())
+		if len(answers) == 0 {
+			return DenyOnce, errors.New("no more answers")
+		}
+		a := answers[0]
+		answers = answers[1:]
+		return a, nil
+	}
+	return g, tb, &prompted
+}
+
+func TestGate(t *testing.T) {
+	g, tb, prompted := newGate(t, DenyOnce, AllowOnce, AllowSession)
+	var log bytes.Buffer
+	g.Audit = JSONLog(&log)
+	ctx := context.Background()
+
+	var names []string
+	for _, tool := range g.Tools() {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); got != "read_file,shell" {
+		t.Errorf("Tools() = %s, want the tools not denied", got)
+	}
+
+	steps := []struct {
+		tool   string
+		denied bool
+	}{
+		{"read_file", false}, // allowed by policy
+		{"fs_write", true},   // denied by policy
+		{"shell", true},      // denied once
+		{"shell", false},     // allowed once
+		{"shell", false},     // allowed for the session
+		{"shell", false},     // without prompt
+	}
+	for i, s := range steps {
+		_, err := g.CallTool(ctx, &call{name: s.tool})
+		if denied := errors.Is(err, ErrDenied); denied != s.denied || (err != nil && !denied) {
+			t.Errorf("step %d: CallTool(%s) err = %v, want denied %v", i, s.tool, err, s.denied)
+		}
+	}
+	if got := strings.Join(*prompted, ","); got != "shell,shell,shell" {
+		t.Errorf("prompted for %s", got)
+	}
+	if got := strings.Join(tb.called, ","); got != "read_file,shell,shell,shell" {
+		t.Errorf("called %s", got)
+	}
+	if got := g.Session(); len(got) != 1 || got[0] != "shell" {
+		t.Errorf("Session() = %v", got)
+	}
+
+	var by []string
+	dec := json.NewDecoder(&log)
+	for {
+		var rec Record
+		if dec.Decode(&rec) != nil {
+			break
+		}
+		by = append(by, rec.By+":"+map[bool]string{true: "allowed", false: "denied"}[rec.Allowed])
+	}
+	want := "policy:allowed policy:denied user:denied user:allowed user:allowed session:allowed"
+	if got := strings.Join(by, " "); got != want {
+		t.Errorf("audit = %s\nwant %s", got, want)
+	}
+
+	g.ResetSession()
+	if _, err := g.Call(ctx, "shell", nil); err == nil || errors.Is(err, ErrDenied) {
+		t.Errorf("Call after ResetSession: err = %v, want the prompt error", err)
+	}
+}
+
+func TestGateNoPrompt(t *testing.T) {
+	g, tb, _ := newGate(t)
+	g.Prompt = nil
+	var rec *Record
+	g.Audit = func(r *Record) { rec = r }
+	_, err := g.CallTool(context.Background(), &call{name: "shell", args: map[string]any{"command": "ls"}})
+	if !errors.Is(err, ErrDenied) {
+		t.Errorf("err = %v, want denied", err)
+	}
+	if rec == nil || rec.By != "no-prompt" || rec.Allowed || rec.CallID != "call_shell" || rec.Arguments["command"] != "ls" {
+		t.Errorf("record = %+v", rec)
+	}
+	if len(tb.called) != 0 {
+		t.Errorf("called %v", tb.called)
+	}
+}
+
+func TestGateConcurrentPrompts(t *testing.T) {
+	g, tb, prompted := newGate(t, AllowSession)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.CallTool(context.Background(), &call{name: "shell"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(*prompted) != 1 || len(tb.called) != 4 {
+		t.Errorf("prompted %d times and called %d tools, want 1 and 4", len(*prompted), len(tb.called))
+	}
+}
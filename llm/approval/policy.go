@@ -0,0 +1,163 @@
+package approval
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sync"
+)
+
+// Action is what a policy decides for a tool call.
+type Action string
+
+const (
+	// Allow executes the call.
+	Allow Action = "allow"
+	// Ask asks the user whether to execute the call.
+	Ask Action = "ask"
+	// Deny refuses the call.
+	Deny Action = "deny"
+)
+
+// Rule decides the action for the calls of the tools it matches.
+type Rule struct {
+	// Tool is the name of the tool, or a pattern as in path.Match such as
+	// "xgo_*" or "*".
+	Tool string `json:"tool"`
+
+	// Args restricts the rule to the calls whose arguments match. Each
+	// entry maps the name of an argument to a regular expression its value,
+	// converted to a string, must match entirely.
+	Args map[string]string `json:"args,omitempty"`
+
+	Action Action `json:"action"`
+
+	args map[string]*regexp.Regexp
+}
+
+// Policy decides the action for each tool call: the first rule matching
+// the call applies, or Default if none does.
+type Policy struct {
+	Rules []*Rule `json:"rules,omitempty"`
+
+	// Default is the action when no rule matches. If empty, Ask is used.
+	Default Action `json:"default,omitempty"`
+
+	once sync.Once
+	err  error
+}
+
+// Compile checks the policy and compiles its patterns. It is called by
+// Decide, the rules must not be changed afterwards.
+func (p *Policy) Compile() error {
+	p.once.Do(func() {
+		p.err = p.compile()
+	})
+	return p.err
+}
+
+func (p *Policy) compile() error {
+	if err := p.Default.check(); err != nil {
+		return err
+	}
+	for _, r := range p.Rules {
+		if _, err := path.Match(r.Tool, ""); err != nil {
+			return fmt.Errorf("approval: invalid tool pattern %q: %v", r.Tool, err)
+		}
+		if err := r.Action.check(); err != nil || r.Action == "" {
+			return fmt.Errorf("approval: invalid action %q for tool %s", r.Action, r.Tool)
+		}
+		if len(r.Args) == 0 {
+			continue
+		}
+		args := make(map[string]*regexp.Regexp, len(r.Args))
+		for name, expr := range r.Args {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return fmt.Errorf("approval: invalid pattern for argument %s of tool %s: %v", name, r.Tool, err)
+			}
+			args[name] = re
+		}
+		r.args = args
+	}
+	return nil
+}
+
+func (a Action) check() error {
+	switch a {
+	case "", Allow, Ask, Deny:
+		return nil
+	}
+	return fmt.Errorf("approval: invalid action %q", a)
+}
+
+// Decide returns the action for a call of the tool name with args, and the
+// rule that decided it, nil for the default.
+func (p *Policy) Decide(name string, args map[string]any) (Action, *Rule, error) {
+	if err := p.Compile(); err != nil {
+		return Deny, nil, err
+	}
+	for _, r := range p.Rules {
+		if r.match(name, args) {
+			return r.Action, r, nil
+		}
+	}
+	if p.Default == "" {
+		return Ask, nil, nil
+	}
+	return p.Default, nil, nil
+}
+
+// Denied reports whether all the calls of the tool name are denied, so that
+// the tool need not be offered at all.
+func (p *Policy) Denied(name string) bool {
+	if p.Compile() != nil {
+		return false
+	}
+	for _, r := range p.Rules {
+		if ok, _ := path.Match(r.Tool, name); !ok {
+			continue
+		}
+		if len(r.Args) == 0 {
+			return r.Action == Deny
+		}
+		if r.Action != Deny {
+			return false
+		}
+	}
+	return p.Default == Deny
+}
+
+// String returns a short description of the rule.
+func (r *Rule) String() string {
+	if len(r.Args) == 0 {
+		return fmt.Sprintf("%s %s", r.Action, r.Tool)
+	}
+	args, _ := json.Marshal(r.Args)
+	return fmt.Sprintf("%s %s %s", r.Action, r.Tool, args)
+}
+
+func (r *Rule) match(name string, args map[string]any) bool {
+	if ok, _ := path.Match(r.Tool, name); !ok {
+		return false
+	}
+	for arg, re := range r.args {
+		v, ok := args[arg]
+		if !ok || !re.MatchString(argString(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+func argString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,104 @@
+package approval
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `{
+  "rules": [
+    {"tool": "read_file", "action": "allow"},
+    {"tool": "grep", "args": {"path": "src/.*"}, "action": "allow"},
+    {"tool": "grep", "action": "ask"},
+    {"tool": "xgo_run", "args": {"args": "\\[\\]"}, "action": "allow"},
+    {"tool": "fs_*", "action": "deny"},
+    {"tool": "shell", "args": {"command": "rm .*"}, "action": "deny"}
+  ],
+  "default": "deny"
+}`
+
+func TestPolicyDecide(t *testing.T) {
+	var p Policy
+	if err := json.Unmarshal([]byte(testPolicy), &p); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tool string
+		args map[string]any
+		want Action
+		rule string // rule that decided, empty for the default
+	}{
+		{"read_file", nil, Allow, "allow read_file"},
+		{"grep", map[string]any{"path": "src/main.xgo"}, Allow, `allow grep {"path":"src/.*"}`},
+		{"grep", map[string]any{"path": "docs/src/a"}, Ask, "ask grep"},
+		{"grep", nil, Ask, "ask grep"},
+		{"xgo_run", map[string]any{"args": []any{}}, Allow, `allow xgo_run {"args":"\\[\\]"}`},
+		{"xgo_run", map[string]any{"args": []any{"-x"}}, Deny, ""},
+		{"fs_write", nil, Deny, "deny fs_*"},
+		{"shell", map[string]any{"command": "rm -rf /"}, Deny, `deny shell {"command":"rm .*"}`},
+		{"shell", map[string]any{"command": "ls"}, Deny, ""},
+		{"other", nil, Deny, ""},
+	}
+	for _, tt := range tests {
+		action, rule, err := p.Decide(tt.tool, tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if rule != nil {
+			got = rule.String()
+		}
+		if action != tt.want || got != tt.rule {
+			t.Errorf("Decide(%s, %v) = %s, %q, want %s, %q", tt.tool, tt.args, action, got, tt.want, tt.rule)
+		}
+	}
+
+	if action, rule, _ := new(Policy).Decide("any", nil); action != Ask || rule != nil {
+		t.Errorf("empty policy decides %s, %v, want ask", action, rule)
+	}
+}
+
+func TestPolicyDenied(t *testing.T) {
+	var p Policy
+	if err := json.Unmarshal([]byte(testPolicy), &p); err != nil {
+		t.Fatal(err)
+	}
+	for tool, want := range map[string]bool{
+		"read_file": false,
+		"grep":      false,
+		"fs_read":   true,
+		"shell":     true, // denied by its argument rule and the default
+		"xgo_run":   false,
+		"other":     true,
+	} {
+		if got := p.Denied(tool); got != want {
+			t.Errorf("Denied(%s) = %v, want %v", tool, got, want)
+		}
+	}
+	p = Policy{Rules: []*Rule{{Tool: "shell", Args: map[string]string{"command": "rm .*"}, Action: Deny}}}
+	if p.Denied("shell") {
+		t.Error("a tool denied for some arguments only is denied")
+	}
+}
+
+func TestPolicyCompileErrors(t *testing.T) {
+	tests := []struct {
+		policy *Policy
+		want   string
+	}{
+		{&Policy{Default: "maybe"}, `invalid action "maybe"`},
+		{&Policy{Rules: []*Rule{{Tool: "[", Action: Allow}}}, `invalid tool pattern "["`},
+		{&Policy{Rules: []*Rule{{Tool: "x"}}}, `invalid action "" for tool x`},
+		{&Policy{Rules: []*Rule{{Tool: "x", Action: Allow, Args: map[string]string{"a": "("}}}}, "invalid pattern for argument a of tool x"},
+	}
+	for _, tt := range tests {
+		action, _, err := tt.policy.Decide("x", nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("err = %v, want %q", err, tt.want)
+		}
+		if action != Deny {
+			t.Errorf("invalid policy decides %s, want deny", action)
+		}
+	}
+}
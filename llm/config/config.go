@@ -0,0 +1,189 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/approval"
+	"github.com/goplus/xgowiz/llm/mcp"
+	"github.com/goplus/xgowiz/llm/usage"
+	"github.com/goplus/xgowiz/llm/window"
+)
+
+// Config is the configuration of the providers, usually read from a JSON
+// file such as:
+//
+//	{
+//	  "default": "anthropic:claude-3-5-sonnet-20240620",
+//	  "providers": {
+//	    "anthropic": {"api_key": "${ANTHROPIC_API_KEY}"},
+//	    "deepseek": {
+//	      "type": "openai",
+//	      "base_url": "https://api.deepseek.com",
+//	      "api_key": "${DEEPSEEK_API_KEY}",
+//	      "model": "deepseek-chat",
+//	      "context_window": 65536,
+//	      "defaults": {"temperature": 0.2}
+//	    }
+//	  },
+//	  "mcp_servers": {
+//	    "fs": {"command": "mcp-server-filesystem", "args": ["."]},
+//	    "docs": {"url": "https://example.com/mcp"}
+//	  },
+//	  "approval": {
+//	    "rules": [
+//	      {"tool": "read_file", "action": "allow"},
+//	      {"tool": "grep", "args": {"path": "src/.*"}, "action": "allow"},
+//	      {"tool": "fs_*", "action": "deny"}
+//	    ],
+//	    "default": "ask"
+//	  },
+//	  "usage": {
+//	    "prices": {
+//	      "claude-3-5-sonnet": {"input": 3, "output": 15, "cache_read": 0.3, "cache_write": 3.75}
+//	    },
+//	    "session": {"cost": 1},
+//	    "budget": {"tokens": 2000000}
+//	  }
+//	}
+//
+// References to environment variables of the form ${NAME} or
+// ${NAME:-default} in string values are replaced by their values.
+type Config struct {
+	// Default is the spec of the provider used if none is specified.
+	Default string `json:"default,omitempty"`
+
+	// Providers holds the configuration of each provider by name.
+	Providers map[string]*llm.ProviderConfig `json:"providers,omitempty"`
+
+	// MCPServers holds the MCP servers whose tools are made available, by
+	// name.
+	MCPServers map[string]*mcp.ServerConfig `json:"mcp_servers,omitempty"`
+
+	// Approval is the policy deciding which tool calls run without asking
+	// the user.
+	Approval *approval.Policy `json:"approval,omitempty"`
+
+	// Usage holds the prices of the models and the budgets limiting the
+	// tokens used.
+	Usage *usage.Tracker `json:"usage,omitempty"`
+}
+
+// DefaultPath returns the default location of the configuration file.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "xgowiz", "config.json"), nil
+}
+
+// Load reads the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return conf, nil
+}
+
+// Parse parses a JSON configuration and expands the environment variables
+// it references.
+func Parse(data []byte) (*Config, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	expanded, err := json.Marshal(expandAll(raw))
+	if err != nil {
+		return nil, err
+	}
+	conf := new(Config)
+	if err = json.Unmarshal(expanded, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// NewProvider creates a provider from a spec of the form "name:model" or
+// "name", using the configuration of the provider named name. If spec is
+// empty, the default provider is created.
+func (c *Config) NewProvider(ctx context.Context, spec string) (llm.Provider, error) {
+	if spec == "" {
+		if spec = c.Default; spec == "" {
+			return nil, fmt.Errorf("config: no provider specified and no default provider")
+		}
+	}
+	name, _ := llm.ParseSpec(spec)
+	return llm.New(ctx, spec, c.Providers[name])
+}
+
+// Window returns the context window of the model given by spec, as
+// NewProvider does. The size configured for the provider takes precedence
+// over the size known for the model.
+func (c *Config) Window(spec string) *window.Window {
+	if spec == "" {
+		spec = c.Default
+	}
+	name, model := llm.ParseSpec(spec)
+	pc := c.Providers[name]
+	if model == "" && pc != nil {
+		model = pc.Model
+	}
+	w := window.New(model)
+	if pc != nil && pc.ContextWindow > 0 {
+		w.Limit = pc.ContextWindow
+	}
+	return w
+}
+
+func expandAll(v any) any {
+	switch v := v.(type) {
+	case string:
+		return Expand(v)
+	case []any:
+		for i, item := range v {
+			v[i] = expandAll(item)
+		}
+	case map[string]any:
+		for k, item := range v {
+			v[k] = expandAll(item)
+		}
+	}
+	return v
+}
+
+// Expand replaces references to environment variables of the form ${NAME}
+// or ${NAME:-default} in s. Other uses of $ are left unchanged.
+func Expand(s string) string {
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(s[i+2:], '}')
+		if j < 0 {
+			break
+		}
+		sb.WriteString(s[:i])
+		name, def, hasDef := strings.Cut(s[i+2:i+2+j], ":-")
+		if val, ok := os.LookupEnv(name); ok && (val != "" || !hasDef) {
+			sb.WriteString(val)
+		} else {
+			sb.WriteString(def)
+		}
+		s = s[i+3+j:]
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+func TestExpand(t *testing.T) {
+	t.Setenv("XGOWIZ_SET", "value")
+	t.Setenv("XGOWIZ_EMPTY", "")
+	os.Unsetenv("XGOWIZ_UNSET")
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"${XGOWIZ_SET}", "value"},
+		{"key=${XGOWIZ_SET}/${XGOWIZ_SET}", "key=value/value"},
+		{"${XGOWIZ_UNSET}", ""},
+		{"${XGOWIZ_EMPTY}", ""},
+		{"${XGOWIZ_UNSET:-default}", "default"},
+		{"${XGOWIZ_EMPTY:-default}", "default"},
+		{"${XGOWIZ_SET:-default}", "value"},
+		{"${XGOWIZ_UNSET:-}", ""},
+		{"$XGOWIZ_SET and $$", "$XGOWIZ_SET and $$"},
+		{"${XGOWIZ_SET", "${XGOWIZ_SET"},
+		{"}${XGOWIZ_SET}{", "}value{"},
+	}
+	for _, tt := range tests {
+		if got := Expand(tt.in); got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("XGOWIZ_KEY", "sk-test")
+	os.Unsetenv("XGOWIZ_UNSET")
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+  "default": "${XGOWIZ_UNSET:-deepseek}:deepseek-chat",
+  "providers": {
+    "deepseek": {
+      "type": "openai",
+      "base_url": "https://api.deepseek.com",
+      "api_key": "${XGOWIZ_KEY}",
+      "context_window": 65536
+    },
+    "anthropic": {"api_key": "${XGOWIZ_UNSET}"}
+  },
+  "mcp_servers": {
+    "fs": {"command": "mcp-server-filesystem", "args": ["${XGOWIZ_UNSET:-.}"]}
+  }
+}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Default != "deepseek:deepseek-chat" {
+		t.Errorf("Default = %q", conf.Default)
+	}
+	ds := conf.Providers["deepseek"]
+	if ds == nil || ds.Type != "openai" || ds.APIKey != "sk-test" || ds.ContextWindow != 65536 {
+		t.Errorf("deepseek = %+v", ds)
+	}
+	if a := conf.Providers["anthropic"]; a == nil || a.APIKey != "" {
+		t.Errorf("anthropic = %+v", a)
+	}
+	if fs := conf.MCPServers["fs"]; fs == nil || len(fs.Args) != 1 || fs.Args[0] != "." {
+		t.Errorf("fs = %+v", fs)
+	}
+	if w := conf.Window(""); w.Limit != 65536 {
+		t.Errorf("Window = %d, want 65536", w.Limit)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"default": 1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Load(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Load of invalid config: err = %v, want one naming %s", err, path)
+	}
+	if _, err = Load(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("Load of missing config: err = %v", err)
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+	want, err := os.UserConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DefaultPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want = filepath.Join(want, "xgowiz", "config.json"); got != want {
+		t.Errorf("DefaultPath() = %s, want %s", got, want)
+	}
+}
+
+type specProvider struct {
+	llm.Provider
+	conf llm.ProviderConfig
+}
+
+func init() {
+	llm.Register("configtest", func(ctx context.Context, conf *llm.ProviderConfig) (llm.Provider, error) {
+		return &specProvider{conf: *conf}, nil
+	})
+}
+
+func TestNewProvider(t *testing.T) {
+	conf := &Config{
+		Default: "local",
+		Providers: map[string]*llm.ProviderConfig{
+			"configtest": {APIKey: "k", Model: "base"},
+			"local":      {Type: "configtest", BaseURL: "http://localhost:8080", Model: "qwen2.5:7b"},
+		},
+	}
+	tests := []struct {
+		spec  string
+		want  string // model, API key and base URL given to the factory
+		error string
+	}{
+		{"configtest", "base k ", ""},
+		{"configtest:other", "other k ", ""},
+		{"configtest:qwen2.5:7b", "qwen2.5:7b k ", ""},
+		{"", "qwen2.5:7b  http://localhost:8080", ""},
+		{"local:llama3", "llama3  http://localhost:8080", ""},
+		{"unknown:model", "", `unknown provider "unknown"`},
+	}
+	for _, tt := range tests {
+		p, err := conf.NewProvider(context.Background(), tt.spec)
+		if tt.error != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("NewProvider(%q): err = %v, want %q", tt.spec, err, tt.error)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewProvider(%q): %v", tt.spec, err)
+			continue
+		}
+		c := p.(*specProvider).conf
+		if got := c.Model + " " + c.APIKey + " " + c.BaseURL; got != tt.want {
+			t.Errorf("NewProvider(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+	if _, err := new(Config).NewProvider(context.Background(), ""); err == nil {
+		t.Error("NewProvider without default succeeded")
+	}
+}
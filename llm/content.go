@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Types of content parts.
+const (
+	PartText     = "text"
+	PartImage    = "image"
+	PartDocument = "document"
+)
+
+// Part is a part of the content of a message: a text, an image or a
+// document such as a PDF. The data of an image or a document is given
+// either by Data or by URL.
+type Part struct {
+	// Type is one of PartText, PartImage and PartDocument.
+	Type string
+
+	// Text is the text of a text part.
+	Text string
+
+	// MediaType is the media type of an image or a document, such as
+	// "image/png" or "application/pdf".
+	MediaType string
+
+	// Data is the content of an image or a document.
+	Data []byte
+
+	// URL locates an image or a document if Data is nil.
+	URL string
+
+	// Name is the file name of an image or a document if known. Some
+	// backends show the names of documents to the model.
+	Name string
+}
+
+// TextPart returns a text part.
+func TextPart(text string) Part {
+	return Part{Type: PartText, Text: text}
+}
+
+// ImagePart returns an image part holding data.
+func ImagePart(mediaType string, data []byte) Part {
+	return Part{Type: PartImage, MediaType: mediaType, Data: data}
+}
+
+// ImageURLPart returns an image part referring to url.
+func ImageURLPart(url string) Part {
+	return Part{Type: PartImage, URL: url}
+}
+
+// DocumentPart returns a document part holding data.
+func DocumentPart(name, mediaType string, data []byte) Part {
+	return Part{Type: PartDocument, Name: name, MediaType: mediaType, Data: data}
+}
+
+// FilePart reads the file at path into an image part if it is an image and
+// into a document part otherwise.
+func FilePart(path string) (Part, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Part{}, err
+	}
+	mediaType := mime.TypeByExtension(filepath.Ext(path))
+	if mediaType == "" {
+		mediaType = http.DetectContentType(data)
+	}
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	if strings.HasPrefix(mediaType, "image/") {
+		part := ImagePart(mediaType, data)
+		part.Name = filepath.Base(path)
+		return part, nil
+	}
+	if mediaType == "application/octet-stream" {
+		return Part{}, fmt.Errorf("%s: unsupported file type", path)
+	}
+	return DocumentPart(filepath.Base(path), mediaType, data), nil
+}
+
+// IsText reports whether p is a text part or a text document.
+func (p *Part) IsText() bool {
+	return p.Type == PartText || p.Type == PartDocument && p.Data != nil && strings.HasPrefix(p.MediaType, "text/")
+}
+
+// DataURL returns the data of p as a data URL, or p.URL if p has no data.
+func (p *Part) DataURL() string {
+	if p.Data == nil {
+		return p.URL
+	}
+	return "data:" + p.MediaType + ";base64," + base64.StdEncoding.EncodeToString(p.Data)
+}
+
+// MultipartMessage is implemented by messages whose content may have parts
+// other than text.
+type MultipartMessage interface {
+	Message
+
+	// Parts returns the parts of the content, excluding tool calls and
+	// tool results.
+	Parts() []Part
+}
+
+// PartsOf returns the parts of the content of msg. The content of messages
+// not implementing MultipartMessage is a single text part, if not empty.
+func PartsOf(msg Message) []Part {
+	if m, ok := msg.(MultipartMessage); ok {
+		return m.Parts()
+	}
+	if text := msg.Content(); text != "" {
+		return []Part{TextPart(text)}
+	}
+	return nil
+}
+
+// HasMedia reports whether the content of msg has parts other than text.
+func HasMedia(msg Message) bool {
+	m, ok := msg.(MultipartMessage)
+	if !ok {
+		return false
+	}
+	for _, part := range m.Parts() {
+		if part.Type != PartText {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goplus/xgowiz/llm/retry"
+)
+
+// Categories of provider failures. Use errors.Is to check the category of
+// an error returned by a Provider.
+var (
+	ErrAuth           = errors.New("authentication failed")
+	ErrRateLimit      = errors.New("rate limit exceeded")
+	ErrContextLength  = errors.New("context length exceeded")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrServer         = errors.New("server error")
+)
+
+// Error represents a failure reported by the backend of a Provider. Use
+// errors.As to inspect it.
+type Error struct {
+	// Provider is the name of the provider reporting the error.
+	Provider string
+
+	// StatusCode is the HTTP status code, or 0 if unknown.
+	StatusCode int
+
+	// Type is the error type or code reported by the backend, such as
+	// "overloaded_error" or "context_length_exceeded".
+	Type string
+
+	// Message is the error message reported by the backend.
+	Message string
+
+	// RequestID is the ID of the failed request if the backend gives one.
+	RequestID string
+
+	// Retryable reports whether the request may succeed if retried.
+	Retryable bool
+
+	// RetryAfter is the delay requested by the backend before retrying,
+	// or 0 if not given.
+	RetryAfter time.Duration
+
+	// Category is one of ErrAuth, ErrRateLimit, ErrContextLength,
+	// ErrInvalidRequest and ErrServer, or nil if unknown.
+	Category error
+
+	// Err is the underlying error if any.
+	Err error
+}
+
+// NewError creates an Error and classifies it by its status code, type and
+// message.
+func NewError(provider string, statusCode int, typ, message string) *Error {
+	e := &Error{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Type:       typ,
+		Message:    message,
+	}
+	e.Category = classify(statusCode, typ, message)
+	// An exhausted quota is reported as 429 but never clears by waiting.
+	e.Retryable = typ != "insufficient_quota" && (retry.IsRetryableStatus(statusCode) ||
+		e.Category == ErrServer || e.Category == ErrRateLimit)
+	return e
+}
+
+// NewHTTPError creates an Error from a failed HTTP response. The request ID
+// is read from requestIDHeader, and the retry delay from the standard and
+// rate limit headers.
+func NewHTTPError(provider string, resp *http.Response, requestIDHeader, typ, message string) *Error {
+	e := NewError(provider, resp.StatusCode, typ, message)
+	e.RequestID = resp.Header.Get(requestIDHeader)
+	if d, ok := retry.RetryAfter(resp.Header, time.Now()); ok {
+		e.RetryAfter = d
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Provider)
+	sb.WriteString(": ")
+	if e.Type != "" {
+		sb.WriteString(e.Type)
+		sb.WriteString(": ")
+	}
+	if e.Message != "" {
+		sb.WriteString(e.Message)
+	} else if e.Err != nil {
+		sb.WriteString(e.Err.Error())
+	} else {
+		fmt.Fprintf(&sb, "error response with status %d", e.StatusCode)
+	}
+	if e.RequestID != "" {
+		sb.WriteString(" (request id: ")
+		sb.WriteString(e.RequestID)
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+// Is reports whether target is the category of e.
+func (e *Error) Is(target error) bool {
+	return e.Category != nil && target == e.Category
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns the HTTP status code of e. With Temporary and Delay it
+// implements retry.Error.
+func (e *Error) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *Error) Temporary() bool {
+	return e.Retryable
+}
+
+// Delay returns the delay requested by the backend before retrying.
+func (e *Error) Delay() time.Duration {
+	return e.RetryAfter
+}
+
+// IsRetryable reports whether err is an Error that may succeed if retried.
+func IsRetryable(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Retryable
+}
+
+func classify(statusCode int, typ, message string) error {
+	t := strings.ToLower(typ)
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(t, "context_length") ||
+		strings.Contains(msg, "context length") ||
+		strings.Contains(msg, "context window") ||
+		strings.Contains(msg, "prompt is too long") ||
+		strings.Contains(msg, "maximum context") ||
+		strings.Contains(msg, "too many tokens"):
+		return ErrContextLength
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden ||
+		strings.Contains(t, "authentication") || strings.Contains(t, "permission") ||
+		strings.Contains(t, "api_key") || t == "unauthenticated" || t == "permission_denied":
+		return ErrAuth
+	case statusCode == http.StatusTooManyRequests ||
+		strings.Contains(t, "rate_limit") || t == "insufficient_quota" || t == "resource_exhausted":
+		return ErrRateLimit
+	case statusCode >= 500 ||
+		t == "overloaded_error" || t == "api_error" || t == "server_error" ||
+		t == "internal" || t == "unavailable":
+		return ErrServer
+	case statusCode >= 400 ||
+		strings.Contains(t, "invalid") || t == "not_found_error" || t == "request_too_large":
+		return ErrInvalidRequest
+	}
+	return nil
+}
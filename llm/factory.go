@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ProviderConfig holds the settings to create a provider.
+type ProviderConfig struct {
+	// Type is the name of the registered factory to use. If empty, the
+	// name the provider is referred to by is used. This allows to define
+	// several providers of the same type, e.g. OpenAI compatible services.
+	Type string `json:"type,omitempty"`
+
+	// APIKey is the API key. If empty, providers read it from their usual
+	// environment variable, such as ANTHROPIC_API_KEY, unless BaseURL is
+	// not their default endpoint.
+	APIKey string `json:"api_key,omitempty"`
+
+	// BaseURL is the endpoint of the API. If empty, the default endpoint
+	// of the provider is used.
+	BaseURL string `json:"base_url,omitempty"`
+
+	// Model is the model used if none is given when creating the provider.
+	Model string `json:"model,omitempty"`
+
+	// Reasoning marks Model as a reasoning model, which some APIs accept
+	// different options for. Providers detect the reasoning models they
+	// know by name; this is for the others, such as fine-tuned ones.
+	Reasoning bool `json:"reasoning,omitempty"`
+
+	// ContextWindow is the size of the context window of the model in
+	// tokens. If zero, it is looked up by the model name.
+	ContextWindow int `json:"context_window,omitempty"`
+
+	// Defaults are the default options of all requests.
+	Defaults *Options `json:"defaults,omitempty"`
+}
+
+// Factory creates a provider from its configuration.
+type Factory func(ctx context.Context, conf *ProviderConfig) (Provider, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a provider factory available by name. It is typically
+// called in the init function of the package implementing the provider.
+// Register panics if it is called twice with the same name.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, dup := factories[name]; dup {
+		panic("llm: Register called twice for provider " + name)
+	}
+	factories[name] = factory
+}
+
+// Providers returns the names of the registered provider factories.
+func Providers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	ret := make([]string, 0, len(factories))
+	for name := range factories {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ParseSpec splits a provider spec of the form "name:model" into its parts.
+// The model may contain colons itself, e.g. "ollama:qwen2.5:7b".
+func ParseSpec(spec string) (name, model string) {
+	name, model, _ = strings.Cut(spec, ":")
+	return
+}
+
+// New creates a provider from a spec of the form "name:model" or "name".
+// conf may be nil; the model of spec overrides conf.Model.
+func New(ctx context.Context, spec string, conf *ProviderConfig) (Provider, error) {
+	name, model := ParseSpec(spec)
+	var c ProviderConfig
+	if conf != nil {
+		c = *conf
+	}
+	if model != "" {
+		c.Model = model
+	}
+	typ := c.Type
+	if typ == "" {
+		typ = name
+	}
+
+	factoriesMu.RLock()
+	factory, ok := factories[typ]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("llm: unknown provider %q (forgotten import?)", typ)
+	}
+
+	p, err := factory(ctx, &c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Defaults != nil {
+		if cp, ok := p.(Configurable); ok {
+			cp.SetOptions(WithOptions(c.Defaults))
+		}
+	}
+	return p, nil
+}
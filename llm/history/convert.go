@@ -0,0 +1,80 @@
+package history
+
+import (
+	"encoding/json"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+// FromMessage converts a message of any provider into a HistoryMessage so
+// that it can be stored and later replayed to any provider.
+func FromMessage(msg llm.Message) *HistoryMessage {
+	if m, ok := msg.(*HistoryMessage); ok {
+		return m
+	}
+
+	ret := &HistoryMessage{ARole: normalizeRole(msg.Role())}
+	if u := llm.UsageOf(msg); u != (llm.Usage{}) {
+		ret.AUsage = &u
+	}
+	if toolCallID, ok := msg.ToolResponse(); ok {
+		content := msg.Content()
+		ret.ARole = "tool"
+		ret.AContent = []ContentBlock{{
+			Type:      "tool_result",
+			ToolUseID: toolCallID,
+			Text:      content,
+			Content:   content,
+		}}
+		return ret
+	}
+
+	for _, t := range llm.ThoughtsOf(msg) {
+		block := ContentBlock{Type: "thinking", Thinking: t.Text, Signature: t.Signature}
+		if t.Redacted != "" {
+			block = ContentBlock{Type: "redacted_thinking", Data: t.Redacted}
+		}
+		ret.AContent = append(ret.AContent, block)
+	}
+	for _, part := range llm.PartsOf(msg) {
+		ret.AContent = append(ret.AContent, NewBlock(part))
+	}
+	for _, call := range msg.ToolCalls() {
+		input, err := json.Marshal(call.Arguments())
+		if err != nil {
+			input = []byte("{}")
+		}
+		ret.AContent = append(ret.AContent, ContentBlock{
+			Type:  "tool_use",
+			ID:    call.ID(),
+			Name:  call.Name(),
+			Input: input,
+		})
+	}
+	return ret
+}
+
+// FromMessages converts messages of any provider into HistoryMessages.
+func FromMessages(msgs []llm.Message) []*HistoryMessage {
+	ret := make([]*HistoryMessage, len(msgs))
+	for i, msg := range msgs {
+		ret[i] = FromMessage(msg)
+	}
+	return ret
+}
+
+// ToMessages returns msgs as a slice of llm.Message.
+func ToMessages(msgs []*HistoryMessage) []llm.Message {
+	ret := make([]llm.Message, len(msgs))
+	for i, msg := range msgs {
+		ret[i] = msg
+	}
+	return ret
+}
+
+func normalizeRole(role string) string {
+	if role == "model" { // Gemini
+		return "assistant"
+	}
+	return role
+}
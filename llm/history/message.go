@@ -1,6 +1,7 @@
 package history
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"strings"
 
@@ -11,6 +12,24 @@ import (
 type HistoryMessage struct {
 	ARole    string         `json:"role"`
 	AContent []ContentBlock `json:"content"`
+	AUsage   *llm.Usage     `json:"usage,omitempty"` // of responses
+}
+
+// NewMessage creates a HistoryMessage holding parts.
+func NewMessage(role string, parts ...llm.Part) *HistoryMessage {
+	m := &HistoryMessage{ARole: role}
+	for _, part := range parts {
+		m.AContent = append(m.AContent, NewBlock(part))
+	}
+	return m
+}
+
+// NewTextMessage creates a HistoryMessage with a single text block.
+func NewTextMessage(role, text string) *HistoryMessage {
+	return &HistoryMessage{
+		ARole:    role,
+		AContent: []ContentBlock{{Type: "text", Text: text}},
+	}
 }
 
 func (m *HistoryMessage) Role() string {
@@ -28,6 +47,31 @@ func (m *HistoryMessage) Content() string {
 	return strings.TrimSpace(content)
 }
 
+// Parts implements llm.MultipartMessage.
+func (m *HistoryMessage) Parts() []llm.Part {
+	var parts []llm.Part
+	for i := range m.AContent {
+		if part, ok := m.AContent[i].Part(); ok {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// Thoughts implements llm.ReasoningMessage.
+func (m *HistoryMessage) Thoughts() []llm.Thought {
+	var thoughts []llm.Thought
+	for _, block := range m.AContent {
+		switch block.Type {
+		case "thinking":
+			thoughts = append(thoughts, llm.Thought{Text: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			thoughts = append(thoughts, llm.Thought{Redacted: block.Data})
+		}
+	}
+	return thoughts
+}
+
 func (m *HistoryMessage) ToolCalls() []llm.ToolCall {
 	var calls []llm.ToolCall
 	for _, block := range m.AContent {
@@ -52,7 +96,16 @@ func (m *HistoryMessage) ToolResponse() (id string, ok bool) {
 }
 
 func (m *HistoryMessage) StatUsage() (int, int) {
-	return 0, 0 // History doesn't track usage
+	u := m.Usage()
+	return u.InputTokens, u.OutputTokens
+}
+
+// Usage implements llm.UsageReporter.
+func (m *HistoryMessage) Usage() llm.Usage {
+	if m.AUsage == nil {
+		return llm.Usage{}
+	}
+	return *m.AUsage
 }
 
 // HistoryToolCall implements llm.ToolCall for stored tool calls
@@ -87,4 +140,63 @@ type ContentBlock struct {
 	Name      string          `json:"name,omitempty"`
 	Input     json.RawMessage `json:"input,omitempty"`
 	Content   any             `json:"content,omitempty"`
+	Source    *Source         `json:"source,omitempty"` // of image and document blocks
+	Title     string          `json:"title,omitempty"`  // of document blocks
+	Thinking  string          `json:"thinking,omitempty"`
+	Signature string          `json:"signature,omitempty"` // of thinking blocks
+	Data      string          `json:"data,omitempty"`      // of redacted_thinking blocks
+}
+
+// Source is the data of an image or a document block, in the format of
+// the Anthropic API.
+type Source struct {
+	Type      string `json:"type"` // base64, text or url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// NewBlock converts part into a ContentBlock.
+func NewBlock(part llm.Part) ContentBlock {
+	if part.Type == llm.PartText {
+		return ContentBlock{Type: "text", Text: part.Text}
+	}
+	src := &Source{MediaType: part.MediaType}
+	switch {
+	case part.Data == nil:
+		src.Type, src.URL = "url", part.URL
+	case part.IsText():
+		src.Type, src.Data = "text", string(part.Data)
+	default:
+		src.Type, src.Data = "base64", base64.StdEncoding.EncodeToString(part.Data)
+	}
+	return ContentBlock{Type: part.Type, Source: src, Title: part.Name}
+}
+
+// Part converts b into a Part. It returns false if b is not a text, image
+// or document block.
+func (b *ContentBlock) Part() (llm.Part, bool) {
+	switch b.Type {
+	case "text":
+		return llm.TextPart(b.Text), true
+	case llm.PartImage, llm.PartDocument:
+		if b.Source == nil {
+			return llm.Part{}, false
+		}
+		part := llm.Part{Type: b.Type, MediaType: b.Source.MediaType, Name: b.Title}
+		switch b.Source.Type {
+		case "url":
+			part.URL = b.Source.URL
+		case "text":
+			part.Data = []byte(b.Source.Data)
+		default:
+			data, err := base64.StdEncoding.DecodeString(b.Source.Data)
+			if err != nil {
+				return llm.Part{}, false
+			}
+			part.Data = data
+		}
+		return part, true
+	}
+	return llm.Part{}, false
 }
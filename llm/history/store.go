@@ -0,0 +1,413 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+const (
+	sessionExt = ".jsonl"
+	indexFile  = "index.json"
+)
+
+// ErrNoSession is returned when a session does not exist.
+var ErrNoSession = errors.New("history: no such session")
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// SessionInfo describes a stored conversation.
+type SessionInfo struct {
+	ID       string    `json:"id"`
+	Provider string    `json:"provider,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	Parent   string    `json:"parent,omitempty"` // ID of the session it was forked from
+	Created  time.Time `json:"created"`
+
+	// The following fields are computed when a session is loaded.
+	Title       string    `json:"-"` // text of the first user message
+	Updated     time.Time `json:"-"`
+	NumMessages int       `json:"-"`
+}
+
+// Session is a stored conversation.
+type Session struct {
+	SessionInfo
+	History []*HistoryMessage
+
+	store *Store
+}
+
+// Messages returns the messages of the session, ready to be sent to any
+// provider.
+func (s *Session) Messages() []llm.Message {
+	return ToMessages(s.History)
+}
+
+// Append converts msgs into HistoryMessages and appends them to the session.
+// They are written with a single write, so that concurrent appends to the
+// session do not interleave.
+func (s *Session) Append(msgs ...llm.Message) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	added := FromMessages(msgs)
+	for _, msg := range added {
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.store.path(s.ID), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNoSession
+		}
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	s.History = append(s.History, added...)
+	s.update()
+	return nil
+}
+
+func (s *Session) update() {
+	s.NumMessages = len(s.History)
+	s.Updated = time.Now()
+	if s.Title == "" {
+		s.Title = title(s.History)
+	}
+}
+
+// Store persists conversations on disk, as one JSONL file per session. The
+// first line of a file holds the SessionInfo and each following line holds
+// a HistoryMessage. An index file caches the title and number of messages
+// of the sessions for List.
+type Store struct {
+	dir string
+}
+
+// NewStore creates a Store keeping its sessions in dir.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Create creates a new empty session.
+func (s *Store) Create(provider, model string) (*Session, error) {
+	return s.create(SessionInfo{Provider: provider, Model: model}, nil)
+}
+
+// Load loads the session with the given id.
+func (s *Store) Load(id string) (*Session, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrNoSession
+	}
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoSession
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := &Session{store: s}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if err = dec.Decode(&ret.SessionInfo); err != nil {
+		return nil, fmt.Errorf("history: invalid session %s: %w", id, err)
+	}
+	for {
+		msg := new(HistoryMessage)
+		if err = dec.Decode(msg); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("history: invalid session %s: %w", id, err)
+		}
+		ret.History = append(ret.History, msg)
+	}
+	if fi, err := f.Stat(); err == nil {
+		ret.Updated = fi.ModTime()
+	}
+	ret.NumMessages = len(ret.History)
+	ret.Title = title(ret.History)
+	return ret, nil
+}
+
+// Resume loads the session with the given id so that the conversation can
+// be continued. If id is empty, the most recently updated session is
+// resumed.
+func (s *Store) Resume(id string) (*Session, error) {
+	if id != "" {
+		return s.Load(id)
+	}
+	sessions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, ErrNoSession
+	}
+	return s.Load(sessions[0].ID)
+}
+
+// List returns all sessions, most recently updated first. Only the first
+// line of each session file, and the messages appended since the previous
+// List, are read.
+func (s *Store) List() ([]*SessionInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	index := s.loadIndex()
+	listed := make(map[string]bool)
+	changed := false
+	var ret []*SessionInfo
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, sessionExt) {
+			continue
+		}
+		id := strings.TrimSuffix(name, sessionExt)
+		entry := index[id]
+		info, err := s.info(id, &entry)
+		if err != nil {
+			continue // skip foreign or corrupted files
+		}
+		if entry != index[id] {
+			index[id] = entry
+			changed = true
+		}
+		listed[id] = true
+		ret = append(ret, info)
+	}
+	for id := range index {
+		if !listed[id] {
+			delete(index, id)
+			changed = true
+		}
+	}
+	if changed {
+		s.saveIndex(index)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Updated.After(ret[j].Updated)
+	})
+	return ret, nil
+}
+
+// indexEntry caches the computed fields of a session, as of the first Size
+// bytes of its file.
+type indexEntry struct {
+	Size        int64  `json:"size"`
+	Title       string `json:"title,omitempty"`
+	NumMessages int    `json:"messages"`
+}
+
+// info reads the SessionInfo of the session id from the first line of its
+// file. Its title and number of messages are those of entry, updated with
+// the messages appended to the file since.
+func (s *Store) info(id string, entry *indexEntry) (*SessionInfo, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrNoSession
+	}
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(f)
+	header, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("history: invalid session %s: %w", id, err)
+	}
+	ret := new(SessionInfo)
+	if err = json.Unmarshal(header, ret); err != nil {
+		return nil, fmt.Errorf("history: invalid session %s: %w", id, err)
+	}
+
+	if entry.Size < int64(len(header)) || entry.Size > fi.Size() {
+		*entry = indexEntry{Size: int64(len(header))}
+	}
+	if entry.Size < fi.Size() {
+		if _, err = f.Seek(entry.Size, io.SeekStart); err != nil {
+			return nil, err
+		}
+		r.Reset(f)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err == io.EOF {
+				break // an incomplete last line is read again by the next List
+			} else if err != nil {
+				return nil, err
+			}
+			entry.Size += int64(len(line))
+			entry.NumMessages++
+			if entry.Title == "" {
+				msg := new(HistoryMessage)
+				if json.Unmarshal(line, msg) == nil {
+					entry.Title = title([]*HistoryMessage{msg})
+				}
+			}
+		}
+	}
+	ret.Title = entry.Title
+	ret.NumMessages = entry.NumMessages
+	ret.Updated = fi.ModTime()
+	return ret, nil
+}
+
+func (s *Store) loadIndex() map[string]indexEntry {
+	index := make(map[string]indexEntry)
+	if data, err := os.ReadFile(filepath.Join(s.dir, indexFile)); err == nil {
+		json.Unmarshal(data, &index)
+	}
+	return index
+}
+
+// saveIndex replaces the index file. The index is only a cache, so errors
+// are ignored.
+func (s *Store) saveIndex(index map[string]indexEntry) {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return
+	}
+	f, err := os.CreateTemp(s.dir, indexFile+".*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(s.dir, indexFile))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Fork creates a new session with the first n messages of the session id.
+// If n is negative, all messages are copied.
+func (s *Store) Fork(id string, n int) (*Session, error) {
+	src, err := s.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	msgs := src.History
+	if n >= 0 && n < len(msgs) {
+		msgs = msgs[:n]
+	}
+	return s.create(SessionInfo{
+		Provider: src.Provider,
+		Model:    src.Model,
+		Parent:   src.ID,
+	}, msgs)
+}
+
+// Delete deletes the session with the given id.
+func (s *Store) Delete(id string) error {
+	if !validID.MatchString(id) {
+		return ErrNoSession
+	}
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrNoSession
+	}
+	return err
+}
+
+func (s *Store) create(info SessionInfo, msgs []*HistoryMessage) (*Session, error) {
+	info.ID = newID()
+	info.Created = time.Now()
+	f, err := os.OpenFile(s.path(info.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	err = enc.Encode(&info)
+	for _, msg := range msgs {
+		if err != nil {
+			break
+		}
+		err = enc.Encode(msg)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	ret := &Session{
+		SessionInfo: info,
+		History:     append([]*HistoryMessage(nil), msgs...),
+		store:       s,
+	}
+	ret.update()
+	return ret, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+sessionExt)
+}
+
+func newID() string {
+	var b [4]byte
+	rand.Read(b[:])
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b[:])
+}
+
+func title(msgs []*HistoryMessage) string {
+	const maxTitle = 60
+	for _, msg := range msgs {
+		if msg.ARole != "user" || llm.IsToolResponse(msg) {
+			continue
+		}
+		text := strings.Join(strings.Fields(msg.Content()), " ")
+		if text == "" {
+			continue
+		}
+		if r := []rune(text); len(r) > maxTitle {
+			text = string(r[:maxTitle]) + "..."
+		}
+		return text
+	}
+	return ""
+}
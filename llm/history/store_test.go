@@ -0,0 +1,195 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func texts(msgs []*HistoryMessage) string {
+	var s []string
+	for _, msg := range msgs {
+		s = append(s, msg.Role()+":"+msg.Content())
+	}
+	return strings.Join(s, " ")
+}
+
+func TestStoreSession(t *testing.T) {
+	s := newTestStore(t)
+	sess, err := s.Create("openai", "gpt-4o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sess.Append(NewTextMessage("user", "  fix\nthe build "), NewTextMessage("assistant", "done"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sess.Append(NewTextMessage("user", "thanks")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Load(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Provider != "openai" || got.Model != "gpt-4o" || !got.Created.Equal(sess.Created) {
+		t.Errorf("info = %+v, want %+v", got.SessionInfo, sess.SessionInfo)
+	}
+	if want := "user:fix\nthe build assistant:done user:thanks"; texts(got.History) != want {
+		t.Errorf("history = %q, want %q", texts(got.History), want)
+	}
+	if got.Title != "fix the build" || got.NumMessages != 3 {
+		t.Errorf("title, messages = %q, %d", got.Title, got.NumMessages)
+	}
+	if len(got.Messages()) != 3 {
+		t.Errorf("Messages() = %d", len(got.Messages()))
+	}
+
+	fork, err := s.Fork(sess.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.Parent != sess.ID || texts(fork.History) != "user:fix\nthe build" {
+		t.Errorf("fork = %+v %s", fork.SessionInfo, texts(fork.History))
+	}
+
+	if err = s.Delete(sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Load(sess.ID); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Load after Delete: err = %v", err)
+	}
+	if err = sess.Append(NewTextMessage("user", "again")); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Append after Delete: err = %v", err)
+	}
+	for _, id := range []string{"", "../x", "a/b", "a.b"} {
+		if _, err = s.Load(id); !errors.Is(err, ErrNoSession) {
+			t.Errorf("Load(%q): err = %v", id, err)
+		}
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	s := newTestStore(t)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		sess, err := s.Create("p", "m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sess.Append(NewTextMessage("user", fmt.Sprint("question ", i))); err != nil {
+			t.Fatal(err)
+		}
+		// Make session i the i-th most recently updated one.
+		mtime := time.Now().Add(-time.Duration(i+1) * time.Hour)
+		if err = os.Chtimes(s.path(sess.ID), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, sess.ID)
+	}
+	os.WriteFile(filepath.Join(s.Dir(), "notes.jsonl"), []byte("not a session\n"), 0o600)
+	os.WriteFile(filepath.Join(s.Dir(), "bad name.jsonl"), []byte("{}\n"), 0o600)
+
+	list := func() string {
+		t.Helper()
+		infos, err := s.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ret []string
+		for _, info := range infos {
+			ret = append(ret, fmt.Sprintf("%s %q %d", info.ID, info.Title, info.NumMessages))
+		}
+		return strings.Join(ret, ", ")
+	}
+	want := fmt.Sprintf("%s %q 1, %s %q 1, %s %q 1", ids[0], "question 0", ids[1], "question 1", ids[2], "question 2")
+	if got := list(); got != want {
+		t.Errorf("List() = %s\nwant %s", got, want)
+	}
+
+	// Messages appended after a List are counted from the index.
+	sess, err := s.Load(ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sess.Append(NewTextMessage("assistant", "answer"), NewTextMessage("user", "more")); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Delete(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	want = fmt.Sprintf("%s %q 3, %s %q 1", ids[2], "question 2", ids[0], "question 0")
+	if got := list(); got != want {
+		t.Errorf("List() = %s\nwant %s", got, want)
+	}
+	index := s.loadIndex()
+	if _, ok := index[ids[1]]; ok || len(index) != 2 {
+		t.Errorf("index = %v, want the entries of %s and %s", index, ids[0], ids[2])
+	}
+
+	// A corrupted index is rebuilt.
+	os.WriteFile(filepath.Join(s.Dir(), indexFile), []byte("{"), 0o600)
+	if got := list(); got != want {
+		t.Errorf("List() with corrupted index = %s\nwant %s", got, want)
+	}
+
+	resumed, err := s.Resume("")
+	if err != nil || resumed.ID != ids[2] {
+		t.Errorf("Resume() = %v, %v, want %s", resumed, err, ids[2])
+	}
+}
+
+func TestSessionAppendConcurrent(t *testing.T) {
+	s := newTestStore(t)
+	sess, err := s.Create("p", "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each goroutine appends through its own Session, as separate
+	// processes would.
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			own, err := s.Load(sess.ID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			text := strings.Repeat(fmt.Sprint(i), 64<<10)
+			if err := own.Append(NewTextMessage("user", text), NewTextMessage("assistant", text)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, err := s.Load(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.History) != 2*n {
+		t.Fatalf("got %d messages, want %d", len(got.History), 2*n)
+	}
+	for i := 0; i < len(got.History); i += 2 {
+		if got.History[i].Content() != got.History[i+1].Content() {
+			t.Errorf("messages %d and %d of one Append are not adjacent", i, i+1)
+		}
+	}
+}
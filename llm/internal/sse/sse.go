@@ -0,0 +1,62 @@
+package sse
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Event represents a server-sent event.
+type Event struct {
+	Type string
+	Data string
+}
+
+// Reader reads server-sent events from a stream.
+type Reader struct {
+	scanner *bufio.Scanner
+}
+
+// NewReader creates a new Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next event. It returns io.EOF when the stream ends.
+func (r *Reader) Next() (*Event, error) {
+	var ev Event
+	var data []string
+	var hasData bool
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			if hasData || ev.Type != "" {
+				ev.Data = strings.Join(data, "\n")
+				return &ev, nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") { // comment
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Type = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if hasData || ev.Type != "" {
+		ev.Data = strings.Join(data, "\n")
+		return &ev, nil
+	}
+	return nil, io.EOF
+}
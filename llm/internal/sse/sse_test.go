@@ -0,0 +1,46 @@
+package sse
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []Event
+	}{
+		{"data", "data: a\n\ndata: b\n\n", []Event{{Data: "a"}, {Data: "b"}}},
+		{"type", "event: ping\ndata: {}\n\n", []Event{{Type: "ping", Data: "{}"}}},
+		{"multiline", "data: a\ndata: b\n\n", []Event{{Data: "a\nb"}}},
+		{"no space", "data:a\n\n", []Event{{Data: "a"}}},
+		{"comments", ": keep-alive\n\n: more\ndata: a\n\n", []Event{{Data: "a"}}},
+		{"unknown fields", "id: 1\nretry: 10\ndata: a\n\n", []Event{{Data: "a"}}},
+		{"blank lines", "\n\n\ndata: a\n\n\n\n", []Event{{Data: "a"}}},
+		{"no final blank line", "data: a\n\ndata: b", []Event{{Data: "a"}, {Data: "b"}}},
+		{"type only", "event: done\n\n", []Event{{Type: "done"}}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.stream))
+			var got []Event
+			for {
+				ev, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, *ev)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
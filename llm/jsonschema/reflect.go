@@ -0,0 +1,173 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON schema in its decoded JSON form.
+type Schema = map[string]any
+
+var (
+	typeTime       = reflect.TypeOf(time.Time{})
+	typeRawMessage = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// For returns the JSON schema of the Go type t.
+//
+// Struct fields are mapped to properties named by their json tags. A field
+// is required unless it is a pointer or its json tag has the omitempty
+// option. The following struct tags are also recognized:
+//
+//	desc:"..."     description of the property
+//	enum:"a,b,c"   allowed values of the property
+func For(t reflect.Type) (Schema, error) {
+	return schemaOf(t, nil)
+}
+
+// Of returns the JSON schema of the type of v.
+func Of(v any) (Schema, error) {
+	return For(reflect.TypeOf(v))
+}
+
+func schemaOf(t reflect.Type, visiting []reflect.Type) (Schema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case typeTime:
+		return Schema{"type": "string", "format": "date-time"}, nil
+	case typeRawMessage:
+		return Schema{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return Schema{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}, nil
+	case reflect.String:
+		return Schema{"type": "string"}, nil
+	case reflect.Interface:
+		return Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 { // []byte is encoded as base64
+			return Schema{"type": "string", "contentEncoding": "base64"}, nil
+		}
+		items, err := schemaOf(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return Schema{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("jsonschema: unsupported map key type %v", t.Key())
+		}
+		elem, err := schemaOf(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return Schema{"type": "object", "additionalProperties": elem}, nil
+	case reflect.Struct:
+		for _, v := range visiting {
+			if v == t {
+				return nil, fmt.Errorf("jsonschema: recursive type %v", t)
+			}
+		}
+		props := make(map[string]any)
+		required := []string{}
+		if err := structFields(t, props, &required, append(visiting, t)); err != nil {
+			return nil, err
+		}
+		return Schema{"type": "object", "properties": props, "required": required}, nil
+	}
+	return nil, fmt.Errorf("jsonschema: unsupported type %v", t)
+}
+
+func structFields(t reflect.Type, props map[string]any, required *[]string, visiting []reflect.Type) error {
+	for i, n := 0, t.NumField(); i < n; i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct { // embedded fields are promoted
+				if err := structFields(ft, props, required, visiting); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop, err := schemaOf(f.Type, visiting)
+		if err != nil {
+			return fmt.Errorf("%w (field %s.%s)", err, t.Name(), f.Name)
+		}
+		if desc := f.Tag.Get("desc"); desc != "" {
+			prop["description"] = desc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			values, err := enumValues(prop, strings.Split(enum, ","))
+			if err != nil {
+				return fmt.Errorf("%w (field %s.%s)", err, t.Name(), f.Name)
+			}
+			prop["enum"] = values
+		}
+		props[name] = prop
+
+		if f.Type.Kind() != reflect.Pointer && !hasOption(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+	return nil
+}
+
+func enumValues(prop Schema, items []string) ([]any, error) {
+	values := make([]any, len(items))
+	for i, item := range items {
+		item = strings.TrimSpace(item)
+		switch prop["type"] {
+		case "string":
+			values[i] = item
+		case "integer", "number":
+			v, err := strconv.ParseFloat(item, 64)
+			if err != nil {
+				return nil, fmt.Errorf("jsonschema: invalid enum value %q", item)
+			}
+			values[i] = v
+		default:
+			return nil, fmt.Errorf("jsonschema: enum not supported for type %v", prop["type"])
+		}
+	}
+	return values, nil
+}
+
+func hasOption(opts, name string) bool {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
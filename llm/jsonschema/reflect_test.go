@@ -0,0 +1,101 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type file struct {
+	Name string `json:"name" desc:"file name"`
+	Size int64  `json:"size,omitempty"`
+}
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type request struct {
+	base
+	Mode    string            `json:"mode" enum:"read, write"`
+	Level   int               `json:"level,omitempty" enum:"1,2,3"`
+	Files   []file            `json:"files"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Parent  *file             `json:"parent"`
+	Data    []byte            `json:"data,omitempty"`
+	When    time.Time         `json:"when,omitempty"`
+	Extra   json.RawMessage   `json:"extra,omitempty"`
+	Ignored string            `json:"-"`
+	NoTag   bool
+	private int
+}
+
+func TestFor(t *testing.T) {
+	got, err := Of(request{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileSchema := Schema{
+		"type": "object",
+		"properties": map[string]any{
+			"name": Schema{"type": "string", "description": "file name"},
+			"size": Schema{"type": "integer"},
+		},
+		"required": []string{"name"},
+	}
+	want := Schema{
+		"type": "object",
+		"properties": map[string]any{
+			"id":     Schema{"type": "string"},
+			"mode":   Schema{"type": "string", "enum": []any{"read", "write"}},
+			"level":  Schema{"type": "integer", "enum": []any{1.0, 2.0, 3.0}},
+			"files":  Schema{"type": "array", "items": fileSchema},
+			"labels": Schema{"type": "object", "additionalProperties": Schema{"type": "string"}},
+			"parent": fileSchema,
+			"data":   Schema{"type": "string", "contentEncoding": "base64"},
+			"when":   Schema{"type": "string", "format": "date-time"},
+			"extra":  Schema{},
+			"NoTag":  Schema{"type": "boolean"},
+		},
+		"required": []string{"id", "mode", "files", "NoTag"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		g, _ := json.MarshalIndent(got, "", "  ")
+		w, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("Of(request{}) =\n%s\nwant\n%s", g, w)
+	}
+}
+
+type node struct {
+	Children []node `json:"children"`
+}
+
+func TestForErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"recursive", node{}, "recursive type"},
+		{"map key", map[int]string{}, "unsupported map key type"},
+		{"channel", struct {
+			C chan int `json:"c"`
+		}{}, "unsupported type chan int"},
+		{"enum on bool", struct {
+			B bool `json:"b" enum:"true"`
+		}{}, "enum not supported"},
+		{"bad enum number", struct {
+			N int `json:"n" enum:"one"`
+		}{}, `invalid enum value "one"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Of(tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
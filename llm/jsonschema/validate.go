@@ -0,0 +1,319 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationError reports a value that does not conform to a schema.
+type ValidationError struct {
+	// Path locates the invalid value, such as "$.files[0].name".
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks that v conforms to schema. The value v is expected in its
+// decoded JSON form as produced by json.Unmarshal into an any.
+//
+// Validate supports the commonly used subset of JSON schema: type, enum,
+// const, properties, required, additionalProperties, items, anyOf, oneOf,
+// allOf, minimum, maximum, minLength, maxLength, pattern, minItems and
+// maxItems.
+func Validate(schema Schema, v any) error {
+	return validate(schema, v, "$")
+}
+
+// ValidateJSON checks that the JSON document data conforms to schema.
+func ValidateJSON(schema Schema, data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return &ValidationError{Path: "$", Message: "invalid JSON: " + err.Error()}
+	}
+	return Validate(schema, v)
+}
+
+func validate(schema Schema, v any, path string) error {
+	if len(schema) == 0 {
+		return nil
+	}
+	if t, ok := schema["type"]; ok && !matchType(t, v) {
+		return &ValidationError{path, fmt.Sprintf("expected %s, got %s", typeString(t), jsonType(v))}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if equal(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &ValidationError{path, fmt.Sprintf("value %s is not one of %s", encode(v), encode(enum))}
+		}
+	}
+	if c, ok := schema["const"]; ok && !equal(c, v) {
+		return &ValidationError{path, fmt.Sprintf("value %s is not %s", encode(v), encode(c))}
+	}
+	if err := validateCombinators(schema, v, path); err != nil {
+		return err
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		return validateObject(schema, val, path)
+	case []any:
+		return validateArray(schema, val, path)
+	case string:
+		return validateString(schema, val, path)
+	case float64:
+		return validateNumber(schema, val, path)
+	}
+	return nil
+}
+
+func validateCombinators(schema Schema, v any, path string) error {
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, s := range all {
+			if sub, ok := s.(map[string]any); ok {
+				if err := validate(sub, v, path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		var first error
+		for _, s := range anyOf {
+			if sub, ok := s.(map[string]any); ok {
+				err := validate(sub, v, path)
+				if err == nil {
+					first = nil
+					break
+				}
+				if first == nil {
+					first = err
+				}
+			}
+		}
+		if first != nil {
+			return &ValidationError{path, "value matches none of anyOf: " + first.Error()}
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		n := 0
+		for _, s := range oneOf {
+			if sub, ok := s.(map[string]any); ok && validate(sub, v, path) == nil {
+				n++
+			}
+		}
+		if n != 1 {
+			return &ValidationError{path, fmt.Sprintf("value matches %d schemas of oneOf", n)}
+		}
+	}
+	return nil
+}
+
+func validateObject(schema Schema, obj map[string]any, path string) error {
+	for _, name := range stringList(schema["required"]) {
+		if _, ok := obj[name]; !ok {
+			return &ValidationError{path, fmt.Sprintf("missing required property %q", name)}
+		}
+	}
+	props, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		val := obj[name]
+		sub := path + "." + name
+		if p, ok := props[name]; ok {
+			if ps, ok := p.(map[string]any); ok {
+				if err := validate(ps, val, sub); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		switch ap := schema["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				return &ValidationError{path, fmt.Sprintf("unexpected property %q", name)}
+			}
+		case map[string]any:
+			if err := validate(ap, val, sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateArray(schema Schema, arr []any, path string) error {
+	if n, ok := number(schema["minItems"]); ok && float64(len(arr)) < n {
+		return &ValidationError{path, fmt.Sprintf("expected at least %v items, got %d", n, len(arr))}
+	}
+	if n, ok := number(schema["maxItems"]); ok && float64(len(arr)) > n {
+		return &ValidationError{path, fmt.Sprintf("expected at most %v items, got %d", n, len(arr))}
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range arr {
+			if err := validate(items, item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateString(schema Schema, s string, path string) error {
+	n := float64(len([]rune(s)))
+	if min, ok := number(schema["minLength"]); ok && n < min {
+		return &ValidationError{path, fmt.Sprintf("expected at least %v characters", min)}
+	}
+	if max, ok := number(schema["maxLength"]); ok && n > max {
+		return &ValidationError{path, fmt.Sprintf("expected at most %v characters", max)}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err == nil && !re.MatchString(s) {
+			return &ValidationError{path, fmt.Sprintf("value %q does not match pattern %q", s, pattern)}
+		}
+	}
+	return nil
+}
+
+func validateNumber(schema Schema, f float64, path string) error {
+	if min, ok := number(schema["minimum"]); ok && f < min {
+		return &ValidationError{path, fmt.Sprintf("value %v is less than %v", f, min)}
+	}
+	if max, ok := number(schema["maximum"]); ok && f > max {
+		return &ValidationError{path, fmt.Sprintf("value %v is greater than %v", f, max)}
+	}
+	return nil
+}
+
+func matchType(t any, v any) bool {
+	switch t := t.(type) {
+	case string:
+		return matchTypeName(t, v)
+	case []any:
+		for _, name := range t {
+			if s, ok := name.(string); ok && matchTypeName(s, v) {
+				return true
+			}
+		}
+		return false
+	case []string:
+		for _, name := range t {
+			if matchTypeName(name, v) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchTypeName(name string, v any) bool {
+	actual := jsonType(v)
+	switch name {
+	case actual:
+		return true
+	case "number":
+		return actual == "integer"
+	}
+	return false
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func typeString(t any) string {
+	switch t := t.(type) {
+	case []any:
+		names := make([]string, len(t))
+		for i, name := range t {
+			names[i] = fmt.Sprint(name)
+		}
+		return strings.Join(names, " or ")
+	case []string:
+		return strings.Join(t, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []any:
+		ret := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func equal(a, b any) bool {
+	if fa, ok := number(a); ok {
+		fb, ok := number(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func encode(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,97 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	schema, err := Of(request{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		json string
+		want string // path and message of the error, empty if valid
+	}{
+		{"valid", `{"id":"a","mode":"read","files":[{"name":"x.xgo","size":3}],"NoTag":true}`, ""},
+		{"optional fields", `{"id":"a","mode":"write","files":[],"NoTag":false,"level":2,
+			"labels":{"k":"v"},"parent":{"name":"p"},"extra":[1,"x"]}`, ""},
+		{"missing required", `{"id":"a","files":[],"NoTag":true}`,
+			`$: missing required property "mode"`},
+		{"enum", `{"id":"a","mode":"delete","files":[],"NoTag":true}`,
+			`$.mode: value "delete" is not one of ["read","write"]`},
+		{"enum number", `{"id":"a","mode":"read","files":[],"NoTag":true,"level":4}`,
+			`$.level: value 4 is not one of [1,2,3]`},
+		{"integer", `{"id":"a","mode":"read","files":[{"name":"x","size":1.5}],"NoTag":true}`,
+			"$.files[0].size: expected integer, got number"},
+		{"nested required", `{"id":"a","mode":"read","files":[{"name":"x"},{"size":1}],"NoTag":true}`,
+			`$.files[1]: missing required property "name"`},
+		{"array type", `{"id":"a","mode":"read","files":{},"NoTag":true}`,
+			"$.files: expected array, got object"},
+		{"map values", `{"id":"a","mode":"read","files":[],"NoTag":true,"labels":{"k":1}}`,
+			"$.labels.k: expected string, got integer"},
+		{"root type", `[]`, "$: expected object, got array"},
+		{"invalid JSON", `{`, "$: invalid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJSON(schema, []byte(tt.json))
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("err = %v, want a ValidationError", err)
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateKeywords(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		json   string
+		valid  bool
+	}{
+		{"number accepts integer", `{"type":"number"}`, `3`, true},
+		{"type list", `{"type":["string","null"]}`, `null`, true},
+		{"type list mismatch", `{"type":["string","null"]}`, `1`, false},
+		{"const", `{"const":"x"}`, `"y"`, false},
+		{"minimum", `{"minimum":1}`, `0`, false},
+		{"maximum", `{"maximum":1}`, `1`, true},
+		{"minLength runes", `{"minLength":2}`, `"é"`, false},
+		{"maxLength", `{"maxLength":2}`, `"abc"`, false},
+		{"pattern", `{"pattern":"^[a-z]+$"}`, `"abc1"`, false},
+		{"minItems", `{"minItems":1}`, `[]`, false},
+		{"maxItems", `{"maxItems":1}`, `[1,2]`, false},
+		{"additionalProperties false", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, false},
+		{"anyOf", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `2`, true},
+		{"anyOf none", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `true`, false},
+		{"oneOf two", `{"oneOf":[{"type":"number"},{"type":"integer"}]}`, `2`, false},
+		{"allOf", `{"allOf":[{"type":"integer"},{"minimum":3}]}`, `2`, false},
+		{"empty schema", `{}`, `{"any":[1]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema Schema
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			err := ValidateJSON(schema, []byte(tt.json))
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidateJSON(%s, %s) = %v, want valid %v", tt.schema, tt.json, err, tt.valid)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package llm
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
 )
 
 // Message represents a message in the conversation.
@@ -42,6 +45,23 @@ type ToolCall interface {
 	ID() string
 }
 
+// ToolCallIDs identifies the tool calls of a message for the backends that
+// do not. The identifiers of the calls of a message share a random prefix,
+// unique to the message, and end with the index of the call.
+type ToolCallIDs string
+
+// NewToolCallIDs returns the ToolCallIDs of a new message.
+func NewToolCallIDs() ToolCallIDs {
+	var b [6]byte
+	rand.Read(b[:])
+	return ToolCallIDs("call_" + hex.EncodeToString(b[:]))
+}
+
+// ID returns the identifier of the i-th tool call of the message.
+func (ids ToolCallIDs) ID(i int) string {
+	return string(ids) + "_" + strconv.Itoa(i)
+}
+
 // Tool represents a tool definition.
 type Tool struct {
 	Name        string `json:"name"`
@@ -59,7 +79,10 @@ type Schema struct {
 // Provider defines the interface for LLM providers.
 type Provider interface {
 	// SendMessage sends a message to the LLM and returns the response.
-	SendMessage(ctx context.Context, prompt string, messages []Message, tools []Tool) (Message, error)
+	// Messages whose role is "system" are not sent as conversation turns,
+	// they are merged into the system prompt given by WithSystem and passed
+	// to the LLM by the native mechanism of the backend.
+	SendMessage(ctx context.Context, prompt string, messages []Message, tools []Tool, opts ...Option) (Message, error)
 
 	// CreateToolResponse creates a message representing a tool response.
 	CreateToolResponse(toolCallID string, content any) (Message, error)
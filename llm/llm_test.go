@@ -0,0 +1,44 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToolCallIDs(t *testing.T) {
+	tests := []struct {
+		ids  ToolCallIDs
+		i    int
+		want string
+	}{
+		{"call_1a2b", 0, "call_1a2b_0"},
+		{"call_1a2b", 1, "call_1a2b_1"},
+		{"call_1a2b", 12, "call_1a2b_12"},
+		{"call_ffff", 1, "call_ffff_1"},
+	}
+	for _, tt := range tests {
+		if got := tt.ids.ID(tt.i); got != tt.want {
+			t.Errorf("%s.ID(%d) = %s, want %s", tt.ids, tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestNewToolCallIDs(t *testing.T) {
+	seen := make(map[string]bool)
+	for n := 0; n < 100; n++ {
+		ids := NewToolCallIDs()
+		if !strings.HasPrefix(string(ids), "call_") {
+			t.Fatalf("NewToolCallIDs() = %s", ids)
+		}
+		for i := 0; i < 3; i++ {
+			id := ids.ID(i)
+			if id != ids.ID(i) {
+				t.Fatalf("%s.ID(%d) is not stable", ids, i)
+			}
+			if seen[id] {
+				t.Fatalf("duplicate id %s", id)
+			}
+			seen[id] = true
+		}
+	}
+}
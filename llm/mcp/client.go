@@ -0,0 +1,353 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/qiniu/x/log"
+)
+
+// ErrClosed is returned by calls on a closed client.
+var ErrClosed = errors.New("mcp: client closed")
+
+// ServerConfig describes how to connect to an MCP server. Either Command
+// or URL must be set.
+type ServerConfig struct {
+	// Command and Args start a server talking over stdio.
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Dir     string            `json:"dir,omitempty"`
+
+	// URL is the endpoint of a server using the streamable HTTP transport.
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Client is a connection to an MCP server.
+type Client struct {
+	t    Transport
+	info InitializeResult
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *message
+	done    chan struct{}
+	err     error // reason the client stopped, valid after done is closed
+}
+
+// Dial connects to the server described by conf. The stderr of a server
+// started by Dial is logged at debug level, and its end is added to the
+// error if the server fails to initialize.
+func Dial(ctx context.Context, conf *ServerConfig) (*Client, error) {
+	var t Transport
+	var stderr *tailWriter
+	switch {
+	case conf.Command != "":
+		cmd := exec.Command(conf.Command, conf.Args...)
+		cmd.Dir = conf.Dir
+		stderr = &tailWriter{name: conf.Command}
+		cmd.Stderr = stderr
+		if len(conf.Env) > 0 {
+			cmd.Env = os.Environ()
+			for k, v := range conf.Env {
+				cmd.Env = append(cmd.Env, k+"="+v)
+			}
+		}
+		ct, err := NewCommandTransport(cmd)
+		if err != nil {
+			return nil, err
+		}
+		t = ct
+	case conf.URL != "":
+		header := make(http.Header)
+		for k, v := range conf.Headers {
+			header.Set(k, v)
+		}
+		t = NewHTTPTransport(conf.URL, header, nil)
+	default:
+		return nil, errors.New("mcp: server has neither a command nor a url")
+	}
+	c, err := Connect(ctx, t)
+	if err != nil {
+		t.Close() // waits for the server, so that all its output is captured
+		if stderr != nil {
+			if tail := stderr.String(); tail != "" {
+				err = fmt.Errorf("%w\nstderr of %s:\n%s", err, conf.Command, tail)
+			}
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// tailWriter receives the stderr of a server. It logs each line at debug
+// level and keeps the last lines, to report why a server failed to start.
+type tailWriter struct {
+	name string
+
+	mu      sync.Mutex
+	partial []byte
+	tail    []byte
+}
+
+const maxStderrTail = 4096
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tail = append(w.tail, p...)
+	if n := len(w.tail) - maxStderrTail; n > 0 {
+		w.tail = append(w.tail[:0], w.tail[n:]...)
+	}
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		log.Debug("mcp: server stderr", "server", w.name, "line", string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	if len(w.partial) > maxStderrTail {
+		log.Debug("mcp: server stderr", "server", w.name, "line", string(w.partial))
+		w.partial = nil
+	}
+	return len(p), nil
+}
+
+func (w *tailWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return string(bytes.TrimSpace(w.tail))
+}
+
+// Connect performs the initialization handshake over t and returns the
+// client. The client owns t and closes it when it is closed.
+func Connect(ctx context.Context, t Transport) (*Client, error) {
+	c := &Client{
+		t:       t,
+		pending: make(map[string]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+
+	params := &InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: "xgowiz", Version: "0.1.0"},
+	}
+	if err := c.call(ctx, "initialize", params, &c.info); err != nil {
+		c.stop(err)
+		return nil, fmt.Errorf("mcp: initialize: %w", err)
+	}
+	if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+		c.stop(err)
+		return nil, err
+	}
+	log.Debug("mcp: connected", "server", c.info.ServerInfo.Name, "version", c.info.ProtocolVersion)
+	return c, nil
+}
+
+// ServerInfo returns the name and version of the server.
+func (c *Client) ServerInfo() Implementation {
+	return c.info.ServerInfo
+}
+
+// Instructions returns the usage instructions given by the server, if any.
+func (c *Client) Instructions() string {
+	return c.info.Instructions
+}
+
+// ListTools returns all tools published by the server.
+func (c *Client) ListTools(ctx context.Context) ([]*ToolInfo, error) {
+	var tools []*ToolInfo
+	var params ListToolsParams
+	for {
+		var res ListToolsResult
+		if err := c.call(ctx, "tools/list", &params, &res); err != nil {
+			return nil, err
+		}
+		tools = append(tools, res.Tools...)
+		if res.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = res.NextCursor
+	}
+}
+
+// CallTool calls the tool named name. A failure of the tool itself is not
+// an error: it is reported by the IsError field of the result.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (*CallToolResult, error) {
+	res := new(CallToolResult)
+	if err := c.call(ctx, "tools/call", &CallToolParams{Name: name, Arguments: args}, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Ping checks that the server is alive.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, "ping", nil, nil)
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	c.stop(ErrClosed)
+	return c.t.Close()
+}
+
+func (c *Client) stop(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+	default:
+		c.err = err
+		close(c.done)
+	}
+}
+
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	ch := make(chan *message, 1)
+	c.mu.Lock()
+	c.nextID++
+	id := strconv.FormatInt(c.nextID, 10)
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	msg := &message{JSONRPC: jsonrpcVersion, ID: json.RawMessage(id), Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+	if err := c.send(ctx, msg); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		c.notify(context.Background(), "notifications/cancelled", map[string]any{
+			"requestId": msg.ID,
+			"reason":    ctx.Err().Error(),
+		})
+		return ctx.Err()
+	}
+}
+
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+	msg := &message{JSONRPC: jsonrpcVersion, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+	return c.send(ctx, msg)
+}
+
+func (c *Client) send(ctx context.Context, msg *message) error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.t.Send(ctx, data)
+}
+
+func (c *Client) readLoop() {
+	for {
+		data, err := c.t.Recv()
+		if err != nil {
+			if err == io.EOF {
+				err = ErrClosed
+			}
+			c.stop(err)
+			return
+		}
+		msgs, err := decodeMessages(data)
+		if err != nil {
+			log.Warn("mcp: invalid message from server", "error", err)
+			continue
+		}
+		for _, msg := range msgs {
+			c.handle(msg)
+		}
+	}
+}
+
+func (c *Client) handle(msg *message) {
+	switch {
+	case msg.isResponse():
+		// The first response to a request is delivered, duplicate or late
+		// ones are dropped so they never block the read loop.
+		c.mu.Lock()
+		ch := c.pending[string(msg.ID)]
+		delete(c.pending, string(msg.ID))
+		c.mu.Unlock()
+		if ch != nil {
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	case msg.isRequest():
+		// Servers may ping clients; other requests concern capabilities
+		// this client does not declare.
+		resp := &message{JSONRPC: jsonrpcVersion, ID: msg.ID}
+		if msg.Method == "ping" {
+			resp.Result = json.RawMessage("{}")
+		} else {
+			resp.Error = &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+		}
+		go c.send(context.Background(), resp)
+	default:
+		log.Debug("mcp: notification", "method", msg.Method)
+	}
+}
+
+// decodeMessages decodes a message or a batch of messages.
+func decodeMessages(data []byte) ([]*message, error) {
+	if len(data) > 0 && data[0] == '[' {
+		var msgs []*message
+		err := json.Unmarshal(data, &msgs)
+		return msgs, err
+	}
+	msg := new(message)
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return []*message{msg}, nil
+}
@@ -0,0 +1,297 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goplus/xgowiz/llm/tool"
+)
+
+// fixtureEnv selects the behavior of the test binary when it is started as
+// an MCP server by the tests.
+const fixtureEnv = "XGOWIZ_MCP_FIXTURE"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(fixtureEnv) {
+	case "serve":
+		runFixture()
+		os.Exit(0)
+	case "fail":
+		fmt.Fprintln(os.Stderr, "fixture: missing API key")
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func fixtureConfig(mode string) *ServerConfig {
+	return &ServerConfig{Command: os.Args[0], Env: map[string]string{fixtureEnv: mode}}
+}
+
+// runFixture serves a minimal MCP server over stdio. Its tools are "echo",
+// which returns its text argument, "fail", which fails, "sleep", which
+// never answers, "repeat", which answers three times, and "exit", which
+// exits the server. tools/list returns them in two pages.
+func runFixture() {
+	out := json.NewEncoder(os.Stdout)
+	reply := func(id json.RawMessage, result any, err *RPCError) {
+		resp := map[string]any{"jsonrpc": "2.0", "id": id}
+		if err != nil {
+			resp["error"] = err
+		} else {
+			resp["result"] = result
+		}
+		out.Encode(resp)
+	}
+	tools := []*ToolInfo{
+		{Name: "echo", Description: "Echo the text.", InputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"text": map[string]any{"type": "string"}},
+			"required":   []string{"text"},
+		}},
+		{Name: "fail", InputSchema: map[string]any{"type": "object"}},
+		{Name: "sleep", InputSchema: map[string]any{"type": "object"}},
+		{Name: "repeat", InputSchema: map[string]any{"type": "object"}},
+		{Name: "exit", InputSchema: map[string]any{"type": "object"}},
+	}
+
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		var msg message
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			reply(json.RawMessage("null"), nil, &RPCError{Code: CodeParseError, Message: err.Error()})
+			continue
+		}
+		if !msg.isRequest() {
+			continue
+		}
+		switch msg.Method {
+		case "initialize":
+			// Notifications sent before a response are ignored by clients.
+			out.Encode(map[string]any{"jsonrpc": "2.0", "method": "notifications/message",
+				"params": map[string]any{"level": "info", "data": "starting"}})
+			reply(msg.ID, &InitializeResult{
+				ProtocolVersion: ProtocolVersion,
+				Capabilities:    map[string]any{"tools": map[string]any{}},
+				ServerInfo:      Implementation{Name: "fixture", Version: "1.0"},
+				Instructions:    "Call echo.",
+			}, nil)
+		case "ping":
+			reply(msg.ID, struct{}{}, nil)
+		case "tools/list":
+			var p ListToolsParams
+			json.Unmarshal(msg.Params, &p)
+			if p.Cursor == "" {
+				reply(msg.ID, &ListToolsResult{Tools: tools[:2], NextCursor: "2"}, nil)
+			} else {
+				reply(msg.ID, &ListToolsResult{Tools: tools[2:]}, nil)
+			}
+		case "tools/call":
+			var p CallToolParams
+			json.Unmarshal(msg.Params, &p)
+			switch p.Name {
+			case "echo":
+				text, _ := p.Arguments["text"].(string)
+				reply(msg.ID, &CallToolResult{Content: []*Content{TextContent(text)}}, nil)
+			case "fail":
+				reply(msg.ID, &CallToolResult{Content: []*Content{TextContent("boom")}, IsError: true}, nil)
+			case "sleep":
+			case "repeat":
+				for i := 0; i < 3; i++ {
+					reply(msg.ID, &CallToolResult{Content: []*Content{TextContent(fmt.Sprint(i))}}, nil)
+				}
+			case "exit":
+				return
+			default:
+				reply(msg.ID, nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool: " + p.Name})
+			}
+		default:
+			reply(msg.ID, nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method})
+		}
+	}
+}
+
+func dialFixture(t *testing.T) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, fixtureConfig("serve"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := dialFixture(t)
+	ctx := context.Background()
+
+	if info := c.ServerInfo(); info.Name != "fixture" || info.Version != "1.0" {
+		t.Errorf("ServerInfo = %+v", info)
+	}
+	if got := c.Instructions(); got != "Call echo." {
+		t.Errorf("Instructions = %q", got)
+	}
+	if err := c.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	infos, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	if got := strings.Join(names, ","); got != "echo,fail,sleep,repeat,exit" {
+		t.Errorf("ListTools = %s", got)
+	}
+
+	res, err := c.CallTool(ctx, "echo", map[string]any{"text": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IsError || res.Text() != "hello" {
+		t.Errorf("CallTool(echo) = %+v", res)
+	}
+
+	res, err = c.CallTool(ctx, "fail", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || res.Text() != "boom" {
+		t.Errorf("CallTool(fail) = %+v", res)
+	}
+
+	_, err = c.CallTool(ctx, "missing", nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeInvalidParams {
+		t.Errorf("CallTool(missing) error = %v", err)
+	}
+
+	err = c.call(ctx, "resources/list", nil, nil)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeMethodNotFound {
+		t.Errorf("resources/list error = %v", err)
+	}
+}
+
+func TestClientRegister(t *testing.T) {
+	c := dialFixture(t)
+	ctx := context.Background()
+
+	r := tool.NewRegistry()
+	names, err := c.Register(ctx, r, "fx_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "fx_echo,fx_fail,fx_sleep,fx_repeat,fx_exit" {
+		t.Errorf("Register = %s", got)
+	}
+	echo, _, ok := r.Lookup("fx_echo")
+	if !ok {
+		t.Fatal("fx_echo not registered")
+	}
+	if echo.Description != "Echo the text." || len(echo.InputSchema.Required) != 1 ||
+		echo.InputSchema.Properties["text"] == nil {
+		t.Errorf("fx_echo = %+v", echo)
+	}
+
+	out, err := r.Call(ctx, "fx_echo", map[string]any{"text": "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{map[string]any{"type": "text", "text": "hi"}}
+	if got, _ := json.Marshal(out); string(got) != mustJSON(want) {
+		t.Errorf("fx_echo = %s", got)
+	}
+	if _, err = r.Call(ctx, "fx_fail", nil); err == nil || err.Error() != "boom" {
+		t.Errorf("fx_fail error = %v", err)
+	}
+}
+
+func mustJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func TestClientCancel(t *testing.T) {
+	c := dialFixture(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.CallTool(ctx, "sleep", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CallTool(sleep) error = %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("Ping after cancel: %v", err)
+	}
+}
+
+func TestClientDuplicateResponse(t *testing.T) {
+	c := dialFixture(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := c.CallTool(ctx, "repeat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Text() != "0" {
+		t.Errorf("CallTool(repeat) = %q, want the first response", res.Text())
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.Ping(ctx); err != nil {
+			t.Fatalf("Ping after duplicate responses: %v", err)
+		}
+	}
+}
+
+func TestClientServerExit(t *testing.T) {
+	c := dialFixture(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := c.CallTool(ctx, "exit", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("CallTool(exit) error = %v", err)
+	}
+	if err := c.Ping(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Ping after exit error = %v", err)
+	}
+}
+
+func TestDialError(t *testing.T) {
+	tests := []struct {
+		name string
+		conf *ServerConfig
+		want string
+	}{
+		{"start failure", fixtureConfig("fail"), "fixture: missing API key"},
+		{"no command", &ServerConfig{Command: "xgowiz-no-such-command"}, "xgowiz-no-such-command"},
+		{"empty", &ServerConfig{}, "neither a command nor a url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			c, err := Dial(ctx, tt.conf)
+			if err == nil {
+				c.Close()
+				t.Fatal("Dial succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Dial error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion is the version of the Model Context Protocol implemented.
+const ProtocolVersion = "2025-03-26"
+
+const jsonrpcVersion = "2.0"
+
+// JSON-RPC error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// message is a JSON-RPC request, notification or response. Requests have
+// a method and an id, notifications only a method and responses only an
+// id.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+func (m *message) isRequest() bool {
+	return m.Method != "" && m.ID != nil
+}
+
+func (m *message) isResponse() bool {
+	return m.Method == "" && m.ID != nil
+}
+
+// RPCError is an error returned by the peer of a JSON-RPC call.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp: %s (code %d)", e.Message, e.Code)
+}
+
+// Implementation describes an MCP client or server.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeParams are the parameters of the initialize request.
+type InitializeParams struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ClientInfo      Implementation `json:"clientInfo"`
+}
+
+// InitializeResult is the result of the initialize request.
+type InitializeResult struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ServerInfo      Implementation `json:"serverInfo"`
+	Instructions    string         `json:"instructions,omitempty"`
+}
+
+// ToolInfo describes a tool published by a server.
+type ToolInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// ListToolsParams are the parameters of the tools/list request.
+type ListToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// ListToolsResult is the result of the tools/list request.
+type ListToolsResult struct {
+	Tools      []*ToolInfo `json:"tools"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// CallToolParams are the parameters of the tools/call request.
+type CallToolParams struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
+
+// CallToolResult is the result of the tools/call request.
+type CallToolResult struct {
+	Content           []*Content `json:"content"`
+	StructuredContent any        `json:"structuredContent,omitempty"`
+	IsError           bool       `json:"isError,omitempty"`
+}
+
+// Text returns the concatenated text of the text content blocks.
+func (r *CallToolResult) Text() string {
+	var text string
+	for _, c := range r.Content {
+		if c.Type == "text" {
+			if text != "" {
+				text += "\n"
+			}
+			text += c.Text
+		}
+	}
+	return text
+}
+
+// Content is a content block of a tool result. Its type is "text",
+// "image", "audio" or "resource".
+type Content struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	Data     string    `json:"data,omitempty"`     // base64 encoded, for images and audio
+	MimeType string    `json:"mimeType,omitempty"` // for images and audio
+	Resource *Resource `json:"resource,omitempty"`
+}
+
+// Resource is the content of an embedded resource.
+type Resource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// TextContent returns a text content block.
+func TextContent(text string) *Content {
+	return &Content{Type: "text", Text: text}
+}
@@ -0,0 +1,364 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/goplus/xgowiz/llm/tool"
+	"github.com/qiniu/x/log"
+)
+
+// Server publishes the tools of a registry to MCP clients.
+type Server struct {
+	info         Implementation
+	tools        *tool.Registry
+	instructions string
+
+	origins map[string]bool // allowed origins of HTTP requests besides local ones
+
+	mu       sync.Mutex
+	sessions map[string]bool // sessions of the HTTP transport
+}
+
+// NewServer creates a server named name publishing the tools of r.
+func NewServer(name, version string, r *tool.Registry) *Server {
+	return &Server{
+		info:     Implementation{Name: name, Version: version},
+		tools:    r,
+		sessions: make(map[string]bool),
+	}
+}
+
+// SetInstructions sets the usage instructions sent to clients.
+func (s *Server) SetInstructions(instructions string) {
+	s.instructions = instructions
+}
+
+// SetAllowedOrigins sets the origins, such as "https://example.com", of the
+// web pages allowed to call the HTTP transport in addition to the local
+// ones. Requests from other origins are rejected, so that a web page
+// cannot reach a local server by DNS rebinding.
+func (s *Server) SetAllowedOrigins(origins ...string) {
+	s.origins = make(map[string]bool, len(origins))
+	for _, o := range origins {
+		s.origins[strings.TrimSuffix(o, "/")] = true
+	}
+}
+
+// allowOrigin reports whether a request with the Origin header origin may
+// be served. Requests without an origin do not come from browsers.
+func (s *Server) allowOrigin(origin string) bool {
+	if origin == "" || s.origins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Serve serves a client over t until the client disconnects or ctx is
+// done. Requests are handled concurrently.
+func (s *Server) Serve(ctx context.Context, t Transport) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		t.Close()
+	}()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inflight := make(map[string]context.CancelFunc)
+	defer wg.Wait()
+	for {
+		data, err := t.Recv()
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		msgs, err := decodeMessages(data)
+		if err != nil {
+			s.reply(ctx, t, &message{JSONRPC: jsonrpcVersion, ID: json.RawMessage("null"),
+				Error: &RPCError{Code: CodeParseError, Message: err.Error()}})
+			continue
+		}
+		for _, msg := range msgs {
+			if msg.Method == "notifications/cancelled" {
+				var params struct {
+					RequestID json.RawMessage `json:"requestId"`
+				}
+				if json.Unmarshal(msg.Params, &params) == nil {
+					mu.Lock()
+					if cancel := inflight[string(params.RequestID)]; cancel != nil {
+						cancel()
+					}
+					mu.Unlock()
+				}
+				continue
+			}
+			if !msg.isRequest() {
+				continue
+			}
+			id := string(msg.ID)
+			reqCtx, reqCancel := context.WithCancel(ctx)
+			mu.Lock()
+			inflight[id] = reqCancel
+			mu.Unlock()
+			wg.Add(1)
+			go func(msg *message) {
+				defer wg.Done()
+				resp := s.handle(reqCtx, msg)
+				mu.Lock()
+				delete(inflight, id)
+				mu.Unlock()
+				reqCancel()
+				s.reply(ctx, t, resp)
+			}(msg)
+		}
+	}
+}
+
+func (s *Server) reply(ctx context.Context, t Transport, resp *message) {
+	data, err := json.Marshal(resp)
+	if err == nil {
+		err = t.Send(ctx, data)
+	}
+	if err != nil {
+		log.Warn("mcp: sending response", "error", err)
+	}
+}
+
+// ServeHTTP implements the streamable HTTP transport. Each POSTed request
+// is answered with a JSON response; the server does not send requests or
+// notifications of its own. Requests from web pages of origins that are
+// neither local nor allowed by SetAllowedOrigins are forbidden.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !s.allowOrigin(req.Header.Get("Origin")) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	switch req.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, req.Header.Get("Mcp-Session-Id"))
+		s.mu.Unlock()
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(req.Body, 16<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data = bytes.TrimSpace(data)
+	msgs, err := decodeMessages(data)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, &message{JSONRPC: jsonrpcVersion, ID: json.RawMessage("null"),
+			Error: &RPCError{Code: CodeParseError, Message: err.Error()}})
+		return
+	}
+
+	session := req.Header.Get("Mcp-Session-Id")
+	initialize := len(msgs) == 1 && msgs[0].Method == "initialize"
+	if initialize {
+		session = newSessionID()
+		s.mu.Lock()
+		s.sessions[session] = true
+		s.mu.Unlock()
+		w.Header().Set("Mcp-Session-Id", session)
+	} else if session != "" {
+		s.mu.Lock()
+		ok := s.sessions[session]
+		s.mu.Unlock()
+		if !ok {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+
+	var resps []*message
+	for _, msg := range msgs {
+		if msg.isRequest() {
+			resps = append(resps, s.handle(req.Context(), msg))
+		}
+	}
+	switch {
+	case len(resps) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case len(resps) == 1 && data[0] != '[':
+		writeJSON(w, http.StatusOK, resps[0])
+	default:
+		writeJSON(w, http.StatusOK, resps)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newSessionID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// handle answers a request.
+func (s *Server) handle(ctx context.Context, req *message) *message {
+	resp := &message{JSONRPC: jsonrpcVersion, ID: req.ID}
+	result, err := s.dispatch(ctx, req.Method, req.Params)
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+		return resp
+	}
+	if resp.Result, err = json.Marshal(result); err != nil {
+		resp.Error = &RPCError{Code: CodeInternalError, Message: err.Error()}
+	}
+	return resp
+}
+
+func (s *Server) dispatch(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		var p InitializeParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		return &InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]any{"tools": map[string]any{}},
+			ServerInfo:      s.info,
+			Instructions:    s.instructions,
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		tools := s.tools.Tools()
+		res := &ListToolsResult{Tools: make([]*ToolInfo, len(tools))}
+		for i, t := range tools {
+			required := t.InputSchema.Required
+			if required == nil {
+				required = []string{}
+			}
+			properties := t.InputSchema.Properties
+			if properties == nil {
+				properties = map[string]any{}
+			}
+			res.Tools[i] = &ToolInfo{
+				Name:        t.Name,
+				Description: t.Description,
+				InputSchema: map[string]any{
+					"type":       "object",
+					"properties": properties,
+					"required":   required,
+				},
+			}
+		}
+		return res, nil
+	case "tools/call":
+		var p CallToolParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		if _, _, ok := s.tools.Lookup(p.Name); !ok {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool: " + p.Name}
+		}
+		if p.Arguments == nil {
+			p.Arguments = map[string]any{}
+		}
+		out, err := s.tools.Call(ctx, p.Name, p.Arguments)
+		if err != nil {
+			return &CallToolResult{Content: []*Content{TextContent(err.Error())}, IsError: true}, nil
+		}
+		return toolResult(out), nil
+	}
+	return nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + method}
+}
+
+func unmarshalParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// toolResult converts the output of a tool handler into a tool result.
+// Strings become text content, lists of content blocks are kept as is and
+// other values are encoded as JSON, and also returned as structured content
+// if they are objects.
+func toolResult(out any) *CallToolResult {
+	switch v := out.(type) {
+	case *CallToolResult:
+		return v
+	case string:
+		return &CallToolResult{Content: []*Content{TextContent(v)}}
+	case []byte:
+		return &CallToolResult{Content: []*Content{TextContent(string(v))}}
+	case []*Content:
+		return &CallToolResult{Content: v}
+	case []any:
+		if content, ok := contentBlocks(v); ok {
+			return &CallToolResult{Content: content}
+		}
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return &CallToolResult{Content: []*Content{TextContent(fmt.Sprint(out))}}
+	}
+	res := &CallToolResult{Content: []*Content{TextContent(string(data))}}
+	if len(data) > 0 && data[0] == '{' { // structured content must be an object
+		res.StructuredContent = json.RawMessage(data)
+	}
+	return res
+}
+
+// contentBlocks converts a list of {"type": "text", "text": ...} blocks,
+// as returned by the tools of a Client.
+func contentBlocks(v []any) ([]*Content, bool) {
+	content := make([]*Content, 0, len(v))
+	for _, item := range v {
+		block, ok := item.(map[string]any)
+		if !ok || block["type"] != "text" {
+			return nil, false
+		}
+		text, ok := block["text"].(string)
+		if !ok {
+			return nil, false
+		}
+		content = append(content, TextContent(text))
+	}
+	return content, true
+}
@@ -0,0 +1,93 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goplus/xgowiz/llm/tool"
+)
+
+type echoArgs struct {
+	Text string `json:"text"`
+}
+
+func newTestServer(t *testing.T, origins ...string) *httptest.Server {
+	t.Helper()
+	r := tool.NewRegistry()
+	err := tool.Register(r, "echo", "Echo the text.", func(ctx context.Context, args echoArgs) (string, error) {
+		return args.Text, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("test", "1.0", r)
+	if origins != nil {
+		s.SetAllowedOrigins(origins...)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestServerHTTP(t *testing.T) {
+	srv := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, err := Connect(ctx, NewHTTPTransport(srv.URL, nil, srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if info := c.ServerInfo(); info.Name != "test" {
+		t.Errorf("ServerInfo = %+v", info)
+	}
+	res, err := c.CallTool(ctx, "echo", map[string]any{"text": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IsError || res.Text() != "hello" {
+		t.Errorf("CallTool = %+v", res)
+	}
+}
+
+func TestServerOrigin(t *testing.T) {
+	srv := newTestServer(t, "https://app.example.com/")
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusOK},
+		{"http://localhost:3000", http.StatusOK},
+		{"http://127.0.0.1", http.StatusOK},
+		{"http://[::1]:8080", http.StatusOK},
+		{"https://app.example.com", http.StatusOK},
+		{"http://evil.example.com", http.StatusForbidden},
+		{"http://localhost.evil.example.com", http.StatusForbidden},
+		{"http://127.0.0.1.nip.io", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	const body = `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("Origin %q: status = %d, want %d", tt.origin, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/tool"
+)
+
+// ToTool converts the description of a server tool into an llm.Tool named
+// name.
+func ToTool(name string, info *ToolInfo) llm.Tool {
+	schema := llm.Schema{Type: "object", Properties: map[string]any{}}
+	if props, ok := info.InputSchema["properties"].(map[string]any); ok {
+		schema.Properties = props
+	}
+	switch req := info.InputSchema["required"].(type) {
+	case []string:
+		schema.Required = req
+	case []any:
+		for _, v := range req {
+			if s, ok := v.(string); ok {
+				schema.Required = append(schema.Required, s)
+			}
+		}
+	}
+	return llm.Tool{
+		Name:        name,
+		Description: info.Description,
+		InputSchema: schema,
+	}
+}
+
+// ToolContent converts the result of a tool call into the content given to
+// CreateToolResponse: a list of {"type": "text", "text": ...} blocks. If the
+// tool failed, its text is returned as an error.
+func ToolContent(res *CallToolResult) (any, error) {
+	if res.IsError {
+		return nil, errors.New(res.Text())
+	}
+	blocks := make([]any, 0, len(res.Content))
+	for _, c := range res.Content {
+		var text string
+		switch c.Type {
+		case "text":
+			text = c.Text
+		case "resource":
+			if c.Resource == nil {
+				continue
+			}
+			if text = c.Resource.Text; text == "" {
+				text = fmt.Sprintf("[resource %s (%s)]", c.Resource.URI, c.Resource.MimeType)
+			}
+		default:
+			text = fmt.Sprintf("[%s content (%s)]", c.Type, c.MimeType)
+		}
+		blocks = append(blocks, map[string]any{"type": "text", "text": text})
+	}
+	return blocks, nil
+}
+
+// Register adds the tools of the server to r, their names prefixed by
+// prefix, so that the tool calls of the LLM are routed to the server. It
+// returns the names of the tools added.
+func (c *Client) Register(ctx context.Context, r *tool.Registry, prefix string) ([]string, error) {
+	infos, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name
+		handler := func(ctx context.Context, args map[string]any) (any, error) {
+			res, err := c.CallTool(ctx, name, args)
+			if err != nil {
+				return nil, err
+			}
+			return ToolContent(res)
+		}
+		if err = r.Add(ToTool(prefix+name, info), handler); err != nil {
+			return names, err
+		}
+		names = append(names, prefix+name)
+	}
+	return names, nil
+}
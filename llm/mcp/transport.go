@@ -0,0 +1,273 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/goplus/xgowiz/llm/internal/sse"
+)
+
+// Transport carries JSON-RPC messages between a client and a server.
+type Transport interface {
+	// Send sends a message to the peer.
+	Send(ctx context.Context, msg []byte) error
+
+	// Recv returns the next message received from the peer. It returns
+	// io.EOF once the transport is closed.
+	Recv() ([]byte, error)
+
+	// Close closes the transport.
+	Close() error
+}
+
+// -----------------------------------------------------------------------------
+
+// StreamTransport exchanges newline-delimited messages over a pair of
+// streams, as the stdio transport does.
+type StreamTransport struct {
+	r      *bufio.Reader
+	w      io.Writer
+	closer io.Closer
+	mu     sync.Mutex // serializes writes
+}
+
+// NewStreamTransport creates a transport reading messages from r and
+// writing them to w. If closer is not nil, it is called by Close.
+func NewStreamTransport(r io.Reader, w io.Writer, closer io.Closer) *StreamTransport {
+	return &StreamTransport{r: bufio.NewReaderSize(r, 64*1024), w: w, closer: closer}
+}
+
+func (t *StreamTransport) Send(ctx context.Context, msg []byte) error {
+	if bytes.IndexByte(msg, '\n') >= 0 {
+		return errors.New("mcp: message contains a newline")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.w.Write(append(msg[:len(msg):len(msg)], '\n'))
+	return err
+}
+
+func (t *StreamTransport) Recv() ([]byte, error) {
+	for {
+		line, err := t.r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *StreamTransport) Close() error {
+	if t.closer != nil {
+		return t.closer.Close()
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// CommandTransport runs a server as a subprocess and talks to it over its
+// stdin and stdout.
+type CommandTransport struct {
+	*StreamTransport
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// NewCommandTransport starts cmd and returns a transport talking to it.
+// The stderr of cmd is left as configured by the caller.
+func NewCommandTransport(cmd *exec.Cmd) (*CommandTransport, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("mcp: starting %s: %w", cmd.Path, err)
+	}
+	return &CommandTransport{
+		StreamTransport: NewStreamTransport(stdout, stdin, nil),
+		cmd:             cmd,
+		stdin:           stdin,
+	}, nil
+}
+
+// Close closes the stdin of the server and waits for it to exit, killing
+// it if it does not exit in time.
+func (t *CommandTransport) Close() error {
+	t.stdin.Close()
+	done := make(chan error, 1)
+	go func() { done <- t.cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.cmd.Process.Kill()
+		return <-done
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// HTTPTransport implements the streamable HTTP transport: each message is
+// POSTed to the endpoint, which answers with a JSON message or a stream of
+// server-sent events.
+type HTTPTransport struct {
+	url    string
+	client *http.Client
+	header http.Header
+
+	mu      sync.Mutex
+	session string // Mcp-Session-Id assigned by the server
+
+	incoming  chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewHTTPTransport creates a transport for the MCP endpoint at url. header
+// holds extra headers sent with every request, such as Authorization. If
+// client is nil, http.DefaultClient is used.
+func NewHTTPTransport(url string, header http.Header, client *http.Client) *HTTPTransport {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPTransport{
+		url:      url,
+		client:   client,
+		header:   header,
+		incoming: make(chan []byte, 16),
+		done:     make(chan struct{}),
+	}
+}
+
+func (t *HTTPTransport) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("MCP-Protocol-Version", ProtocolVersion)
+	t.mu.Lock()
+	if t.session != "" {
+		req.Header.Set("Mcp-Session-Id", t.session)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+func (t *HTTPTransport) Send(ctx context.Context, msg []byte) error {
+	req, err := t.newRequest(ctx, http.MethodPost, msg)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.session = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("mcp: %s: %s: %s", t.url, resp.Status, bytes.TrimSpace(body))
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		resp.Body.Close()
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		// The stream may stay open while the server sends requests and
+		// notifications before the response, so it is read in background.
+		go t.readEvents(resp.Body)
+		return nil
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if data = bytes.TrimSpace(data); len(data) > 0 {
+		t.deliver(data)
+	}
+	return nil
+}
+
+func (t *HTTPTransport) readEvents(body io.ReadCloser) {
+	defer body.Close()
+	r := sse.NewReader(body)
+	for {
+		ev, err := r.Next()
+		if err != nil {
+			return
+		}
+		if (ev.Type == "" || ev.Type == "message") && ev.Data != "" {
+			if !t.deliver([]byte(ev.Data)) {
+				return
+			}
+		}
+	}
+}
+
+func (t *HTTPTransport) deliver(msg []byte) bool {
+	select {
+	case t.incoming <- msg:
+		return true
+	case <-t.done:
+		return false
+	}
+}
+
+func (t *HTTPTransport) Recv() ([]byte, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+// Close terminates the session, if the server assigned one.
+func (t *HTTPTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.mu.Lock()
+		session := t.session
+		t.mu.Unlock()
+		if session == "" {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if req, err := t.newRequest(ctx, http.MethodDelete, nil); err == nil {
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	})
+	return nil
+}
@@ -5,14 +5,35 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/internal/sse"
+	"github.com/goplus/xgowiz/llm/retry"
 )
 
 type Client struct {
 	apiKey  string
 	baseURL string
 	client  *http.Client
+	retry   *retry.Policy
+}
+
+const defaultBaseURL = "https://api.openai.com/v1"
+
+// endpoint returns the URL of the API at baseURL, which may omit the /v1
+// suffix, or the default URL if baseURL is empty.
+func endpoint(baseURL string) string {
+	if baseURL == "" {
+		return defaultBaseURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !strings.HasSuffix(baseURL, "/v1") {
+		baseURL += "/v1"
+	}
+	return baseURL
 }
 
 func NewClient(apiKey string, baseURL string, client *http.Client) *Client {
@@ -20,63 +41,182 @@ func NewClient(apiKey string, baseURL string, client *http.Client) *Client {
 }
 
 func (c *Client) Init(apiKey string, baseURL string, client *http.Client) *Client {
-	if baseURL == "" {
-		baseURL = "https://api.openai.com/v1"
-	} else if !strings.HasSuffix(baseURL, "/v1") {
-		baseURL = strings.TrimSuffix(baseURL, "/") + "/v1"
-	}
+	baseURL = endpoint(baseURL)
 	if client == nil {
 		client = http.DefaultClient
 	}
 	c.apiKey = apiKey
 	c.baseURL = baseURL
 	c.client = client
+	c.retry = retry.Default()
 	return c
 }
 
+// SetRetryPolicy sets the policy to retry requests failed with transient
+// errors. A nil policy disables retries.
+func (c *Client) SetRetryPolicy(policy *retry.Policy) {
+	c.retry = policy
+}
+
 func (c *Client) CreateChatCompletion(ctx context.Context, req CreateRequest) (*APIResponse, error) {
-	body, err := json.Marshal(req)
+	resp, err := c.post(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling request: %w", err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	httpReq, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		fmt.Sprintf("%s/chat/completions", c.baseURL),
-		bytes.NewReader(body),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+	var response APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	return &response, nil
+}
 
-	resp, err := c.client.Do(httpReq)
+// StreamChatCompletion sends a streaming request and calls fn for each chunk
+// received. It returns the response assembled from all chunks.
+func (c *Client) StreamChatCompletion(ctx context.Context, req CreateRequest, fn func(chunk *StreamResponse) error) (*APIResponse, error) {
+	req.Stream = true
+	req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	resp, err := c.post(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		var errResp struct {
-			Error struct {
-				Message string `json:"message"`
-				Type    string `json:"type"`
-				Code    string `json:"code"`
-			} `json:"error"`
+	var response APIResponse
+	var content, reasoning []string
+	r := sse.NewReader(resp.Body)
+	for {
+		e, err := r.Next()
+		if err != nil {
+			if err == io.EOF { // the stream ends with [DONE]
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("error reading stream: %w", err)
+		}
+		if e.Data == "[DONE]" {
+			break
+		}
+		if e.Data == "" {
+			continue
+		}
+		var chunk StreamResponse
+		if err := json.Unmarshal([]byte(e.Data), &chunk); err != nil {
+			return nil, fmt.Errorf("error decoding stream chunk: %w", err)
+		}
+		response.ID, response.Object = chunk.ID, "chat.completion"
+		response.Created, response.Model = chunk.Created, chunk.Model
+		if chunk.Usage != nil {
+			response.Usage = *chunk.Usage
+		}
+		for _, sc := range chunk.Choices {
+			if sc.Index != 0 { // only the first choice is assembled
+				continue
+			}
+			if len(response.Choices) == 0 {
+				response.Choices = []Choice{{Message: MessageParam{Role: "assistant"}}}
+			}
+			choice := &response.Choices[0]
+			if sc.Delta.Role != "" {
+				choice.Message.Role = sc.Delta.Role
+			}
+			if sc.Delta.Content != "" {
+				content = append(content, sc.Delta.Content)
+			}
+			if sc.Delta.ReasoningContent != "" {
+				reasoning = append(reasoning, sc.Delta.ReasoningContent)
+			}
+			for _, tc := range sc.Delta.ToolCalls {
+				for len(choice.Message.ToolCalls) <= tc.Index {
+					choice.Message.ToolCalls = append(choice.Message.ToolCalls, ToolCall{Type: "function"})
+				}
+				call := &choice.Message.ToolCalls[tc.Index]
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				if tc.Type != "" {
+					call.Type = tc.Type
+				}
+				call.Function.Name += tc.Function.Name
+				call.Function.Arguments += tc.Function.Arguments
+			}
+			if sc.FinishReason != nil {
+				choice.FinishReason = *sc.FinishReason
+			}
+		}
+		if err := fn(&chunk); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(response.Choices) > 0 {
+		msg := &response.Choices[0].Message
+		if len(content) > 0 {
+			text := strings.Join(content, "")
+			msg.Content = &text
 		}
-		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-			return nil, fmt.Errorf("error response with status %d", resp.StatusCode)
+		if len(reasoning) > 0 {
+			text := strings.Join(reasoning, "")
+			msg.ReasoningContent = &text
 		}
-		return nil, fmt.Errorf("%s: %s", errResp.Error.Type, errResp.Error.Message)
 	}
+	return &response, nil
+}
 
-	var response APIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("error decoding response: %w", err)
+func (c *Client) post(ctx context.Context, req CreateRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	return &response, nil
+	return c.retry.Do(ctx, func() (*http.Response, error) {
+		httpReq, err := http.NewRequestWithContext(
+			ctx,
+			"POST",
+			fmt.Sprintf("%s/chat/completions", c.baseURL),
+			bytes.NewReader(body),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+		if req.Stream {
+			httpReq.Header.Set("Accept", "text/event-stream")
+		}
+
+		resp, err := c.client.Do(httpReq)
+		if err != nil {
+			return nil, fmt.Errorf("error making request: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, responseError(resp)
+		}
+		return resp, nil
+	})
+}
+
+// responseError decodes the error of a failed response. It is returned
+// from within the retry loop, so that the policy sees whether the error
+// is worth retrying.
+func responseError(resp *http.Response) error {
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    any    `json:"code"`
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&errResp)
+
+	// The code is more specific than the type, e.g. context_length_exceeded
+	// vs. invalid_request_error.
+	typ := errResp.Error.Type
+	if code, ok := errResp.Error.Code.(string); ok && code != "" {
+		typ = code
+	}
+	return llm.NewHTTPError("openai", resp, "x-request-id", typ, errResp.Error.Message)
 }
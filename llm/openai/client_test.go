@@ -0,0 +1,95 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/retry"
+)
+
+func TestClientRetry(t *testing.T) {
+	const ok = `{"id":"1","choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`
+	tests := []struct {
+		name      string
+		status    int
+		header    http.Header
+		body      string
+		requests  int
+		category  error // nil if the request succeeds
+		retryable bool
+	}{
+		{"rate limit", 429, http.Header{"Retry-After": {"0.01"}},
+			`{"error":{"type":"requests","code":"rate_limit_exceeded","message":"slow down"}}`, 2, nil, false},
+		{"server error", 500, nil,
+			`{"error":{"type":"server_error","message":"oops"}}`, 2, nil, false},
+		{"quota", 429, nil,
+			`{"error":{"type":"insufficient_quota","code":"insufficient_quota","message":"no credit"}}`, 1, llm.ErrRateLimit, false},
+		{"bad request", 400, nil,
+			`{"error":{"type":"invalid_request_error","message":"bad"}}`, 1, llm.ErrInvalidRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n++
+				if n > 1 {
+					w.Write([]byte(ok))
+					return
+				}
+				for k, v := range tt.header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := NewClient("key", srv.URL, srv.Client())
+			c.SetRetryPolicy(&retry.Policy{MaxRetries: 3, BaseDelay: time.Millisecond})
+			resp, err := c.CreateChatCompletion(context.Background(), CreateRequest{Model: "m"})
+			if n != tt.requests {
+				t.Errorf("requests = %d, want %d", n, tt.requests)
+			}
+			if tt.category == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(resp.Choices) != 1 || *resp.Choices[0].Message.Content != "hi" {
+					t.Errorf("response = %+v", resp)
+				}
+				return
+			}
+			var e *llm.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("err = %v, want *llm.Error", err)
+			}
+			if !errors.Is(err, tt.category) || e.Retryable != tt.retryable || e.StatusCode != tt.status {
+				t.Errorf("err = %+v", e)
+			}
+		})
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewClient("key", srv.URL, srv.Client())
+	c.SetRetryPolicy(&retry.Policy{
+		MaxRetries: 3,
+		OnRetry:    func(*retry.Attempt) { cancel() },
+	})
+	_, err := c.CreateChatCompletion(ctx, CreateRequest{Model: "m"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context canceled", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"reflect"
 	"strings"
 
@@ -14,12 +15,47 @@ import (
 )
 
 var (
-	_ llm.Provider = (*Provider)(nil)
+	_ llm.Provider          = (*Provider)(nil)
+	_ llm.StreamingProvider = (*Provider)(nil)
+	_ llm.Configurable      = (*Provider)(nil)
 )
 
+func init() {
+	llm.Register("openai", func(ctx context.Context, conf *llm.ProviderConfig) (llm.Provider, error) {
+		apiKey := conf.APIKey
+		if apiKey == "" {
+			// The key of OpenAI is not sent to other services
+			if endpoint(conf.BaseURL) != defaultBaseURL {
+				return nil, fmt.Errorf("openai: no API key for %s", conf.BaseURL)
+			}
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		if conf.Model == "" {
+			conf.Model = "gpt-4o"
+		}
+		p := NewProvider(apiKey, conf.BaseURL, nil, conf.Model)
+		p.reasoning = p.reasoning || conf.Reasoning
+		return p, nil
+	})
+}
+
 type Provider struct {
-	client Client
-	model  string
+	client    Client
+	model     string
+	reasoning bool // model is a reasoning model
+	opts      []llm.Option
+}
+
+// isReasoningModel reports whether model is a reasoning model of OpenAI,
+// possibly prefixed by a vendor as in "openai/o3-mini".
+func isReasoningModel(model string) bool {
+	model = model[strings.LastIndexByte(model, '/')+1:]
+	for _, family := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if rest, ok := strings.CutPrefix(model, family); ok && (rest == "" || rest[0] == '-') {
+			return !strings.HasPrefix(rest, "-chat")
+		}
+	}
+	return false
 }
 
 func convertSchema(schema llm.Schema) map[string]any {
@@ -38,19 +74,104 @@ func convertSchema(schema llm.Schema) map[string]any {
 
 func NewProvider(apiKey string, baseURL string, client *http.Client, model string) *Provider {
 	ret := &Provider{
-		model: model,
+		model:     model,
+		reasoning: isReasoningModel(model),
 	}
 	ret.client.Init(apiKey, baseURL, client)
 	return ret
 }
 
-func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool) (llm.Message, error) {
+func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool, opts ...llm.Option) (llm.Message, error) {
+	req, err := p.createRequest(prompt, messages, tools, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make the API call
+	resp, err := p.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	return &Message{Resp: resp, Choice: &resp.Choices[0]}, nil
+}
+
+func (p *Provider) StreamMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool, handler llm.StreamHandler, opts ...llm.Option) (llm.Message, error) {
+	req, err := p.createRequest(prompt, messages, tools, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.StreamChatCompletion(ctx, req, func(chunk *StreamResponse) error {
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.Delta.ReasoningContent != "" {
+				if err := handler(&llm.Chunk{Kind: llm.ChunkReasoning, Text: choice.Delta.ReasoningContent}); err != nil {
+					return err
+				}
+			}
+			if choice.Delta.Content != "" {
+				if err := handler(&llm.Chunk{Kind: llm.ChunkText, Text: choice.Delta.Content}); err != nil {
+					return err
+				}
+			}
+			for _, tc := range choice.Delta.ToolCalls {
+				err := handler(&llm.Chunk{
+					Kind:      llm.ChunkToolCall,
+					Index:     tc.Index,
+					ID:        tc.ID,
+					Name:      tc.Function.Name,
+					Arguments: tc.Function.Arguments,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	err = handler(&llm.Chunk{
+		Kind:         llm.ChunkUsage,
+		InputTokens:  resp.Usage.PromptTokens,
+		OutputTokens: resp.Usage.CompletionTokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Resp: resp, Choice: &resp.Choices[0]}, nil
+}
+
+func (p *Provider) createRequest(prompt string, messages []llm.Message, tools []llm.Tool, opts []llm.Option) (req CreateRequest, err error) {
 	log.Debug("creating message",
 		"prompt", prompt,
 		"num_messages", len(messages),
 		"num_tools", len(tools))
 
-	openaiMessages := make([]MessageParam, 0, len(messages))
+	o := p.options(opts)
+	system, messages := llm.SystemPrompt(o, messages)
+	openaiMessages := make([]MessageParam, 0, len(messages)+1)
+
+	// OpenAI takes the system prompt as the first message
+	if system != "" {
+		openaiMessages = append(openaiMessages, MessageParam{
+			Role:    "system",
+			Content: &system,
+		})
+	}
 
 	// Convert previous messages
 	for _, msg := range messages {
@@ -66,6 +187,9 @@ func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []ll
 		if content := msg.Content(); content != "" {
 			param.Content = &content
 		}
+		if llm.HasMedia(msg) && !llm.IsToolResponse(msg) {
+			param.Parts = contentParts(llm.PartsOf(msg))
+		}
 
 		// Handle function/tool calls
 		toolCalls := msg.ToolCalls()
@@ -77,7 +201,7 @@ func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []ll
 			for i, call := range toolCalls {
 				args, err := json.Marshal(call.Arguments())
 				if err != nil {
-					return nil, fmt.Errorf(
+					return req, fmt.Errorf(
 						"error marshaling function arguments: %w",
 						err,
 					)
@@ -167,23 +291,111 @@ func (p *Provider) SendMessage(ctx context.Context, prompt string, messages []ll
 		}
 	}
 
-	// Make the API call
-	resp, err := p.client.CreateChatCompletion(ctx, CreateRequest{
-		Model:       p.model,
-		Messages:    openaiMessages,
-		Tools:       openaiTools,
-		MaxTokens:   4096,
-		Temperature: 0.7,
-	})
-	if err != nil {
-		return nil, err
+	maxTokens := o.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 4096
+	}
+	temperature := o.Temperature
+	if temperature == nil {
+		t := 0.7
+		temperature = &t
+	}
+	if o.TopK != nil {
+		llm.WarnUnsupported("openai", "top_k")
 	}
 
-	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("no choices in response")
+	req = CreateRequest{
+		Model:            p.model,
+		Messages:         openaiMessages,
+		Tools:            openaiTools,
+		MaxTokens:        maxTokens,
+		Temperature:      temperature,
+		TopP:             o.TopP,
+		Stop:             o.Stop,
+		Seed:             o.Seed,
+		PresencePenalty:  o.PresencePenalty,
+		FrequencyPenalty: o.FrequencyPenalty,
+	}
+	if len(openaiTools) > 0 {
+		// Both are rejected by the API when no tools are given
+		if tc := o.ToolChoice; tc != nil {
+			req.ToolChoice = string(tc.Mode)
+			if tc.Mode == llm.ToolChoiceTool {
+				req.ToolChoice = ToolChoice{Type: "function", Function: ToolFunction{Name: tc.Name}}
+			}
+		}
+		req.ParallelToolCalls = o.ParallelToolCalls
+	}
+	if o.Thinking > 0 || p.reasoning {
+		reason(&req, o)
+	}
+	if f := o.ResponseFormat; f != nil {
+		req.ResponseFormat = &ResponseFormat{Type: "json_object"}
+		if f.Schema != nil {
+			req.ResponseFormat = &ResponseFormat{
+				Type: "json_schema",
+				JSONSchema: &JSONSchema{
+					Name:        f.Name,
+					Description: f.Description,
+					Schema:      f.Schema,
+				},
+			}
+		}
 	}
+	return
+}
 
-	return &Message{Resp: resp, Choice: &resp.Choices[0]}, nil
+// reason converts req for a reasoning model and sets the reasoning effort
+// for the thinking budget, if any. Reasoning models reject max_tokens,
+// which is replaced by max_completion_tokens, and the sampling options.
+func reason(req *CreateRequest, o *llm.Options) {
+	if o.Thinking > 0 {
+		req.ReasoningEffort = llm.ReasoningEffort(o.Thinking)
+	}
+	req.MaxCompletionTokens, req.MaxTokens = req.MaxTokens, 0
+	if o.Temperature != nil || o.TopP != nil || o.PresencePenalty != nil || o.FrequencyPenalty != nil {
+		log.Warn("temperature, top_p and penalties ignored when reasoning", "provider", "openai")
+	}
+	req.Temperature, req.TopP = nil, nil
+	req.PresencePenalty, req.FrequencyPenalty = nil, nil
+}
+
+// contentParts converts the parts of a message. Text documents are sent as
+// text, other documents as files.
+func contentParts(parts []llm.Part) []ContentPart {
+	ret := make([]ContentPart, 0, len(parts))
+	for _, part := range parts {
+		switch {
+		case part.IsText():
+			text := part.Text
+			if part.Type == llm.PartDocument {
+				text = fmt.Sprintf("%s:\n%s", part.Name, part.Data)
+			}
+			ret = append(ret, ContentPart{Type: "text", Text: text})
+		case part.Type == llm.PartImage:
+			ret = append(ret, ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: part.DataURL()}})
+		case part.Data == nil:
+			llm.WarnUnsupported("openai", "document URL")
+		default:
+			ret = append(ret, ContentPart{Type: "file", File: &File{Filename: part.Name, FileData: part.DataURL()}})
+		}
+	}
+	return ret
+}
+
+// SetOptions sets the default options of all requests.
+func (p *Provider) SetOptions(opts ...llm.Option) {
+	p.opts = opts
+}
+
+func (p *Provider) options(opts []llm.Option) *llm.Options {
+	return llm.NewOptions(append(p.opts[:len(p.opts):len(p.opts)], opts...)...)
+}
+
+// Client returns the underlying API client, e.g. to configure its retry
+// policy.
+func (p *Provider) Client() *Client {
+	return &p.client
 }
 
 func (p *Provider) SupportsTools() bool {
@@ -310,10 +522,32 @@ func (m *Message) ToolResponse() (id string, ok bool) {
 	return
 }
 
+// Thoughts implements llm.ReasoningMessage with the reasoning_content
+// returned by reasoning models such as DeepSeek's.
+func (m *Message) Thoughts() []llm.Thought {
+	if rc := m.Choice.Message.ReasoningContent; rc != nil && *rc != "" {
+		return []llm.Thought{{Text: *rc}}
+	}
+	return nil
+}
+
 func (m *Message) StatUsage() (int, int) {
 	return m.Resp.Usage.PromptTokens, m.Resp.Usage.CompletionTokens
 }
 
+// Usage implements llm.UsageReporter.
+func (m *Message) Usage() llm.Usage {
+	u := m.Resp.Usage
+	ret := llm.Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+	if u.PromptTokensDetails != nil {
+		ret.CacheReadTokens = u.PromptTokensDetails.CachedTokens
+	}
+	if u.CompletionTokensDetails != nil {
+		ret.ReasoningTokens = u.CompletionTokensDetails.ReasoningTokens
+	}
+	return ret
+}
+
 // ToolCallWrapper implements llm.ToolCall
 type ToolCallWrapper struct {
 	Call ToolCall
@@ -0,0 +1,267 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+func TestCreateRequestReasoning(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		opts  []llm.Option
+		want  map[string]any // expected fields, nil for absent ones
+	}{
+		{"default", "gpt-4o", nil, map[string]any{
+			"max_tokens":            4096.0,
+			"temperature":           0.7,
+			"max_completion_tokens": nil,
+			"reasoning_effort":      nil,
+		}},
+		{"thinking", "gpt-4o", []llm.Option{llm.WithThinking(8000)}, map[string]any{
+			"max_tokens":            nil,
+			"temperature":           nil,
+			"max_completion_tokens": 4096.0,
+			"reasoning_effort":      llm.ReasoningEffort(8000),
+		}},
+		{"reasoning model", "o3-mini", []llm.Option{llm.WithTemperature(0.2)}, map[string]any{
+			"max_tokens":            nil,
+			"temperature":           nil,
+			"max_completion_tokens": 4096.0,
+			"reasoning_effort":      nil,
+		}},
+		{"thinking with sampling", "o3-mini", []llm.Option{
+			llm.WithThinking(2000), llm.WithMaxTokens(1000), llm.WithTemperature(0.2), llm.WithTopP(0.9),
+		}, map[string]any{
+			"max_tokens":            nil,
+			"temperature":           nil,
+			"top_p":                 nil,
+			"max_completion_tokens": 1000.0,
+			"reasoning_effort":      llm.ReasoningEffort(2000),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProvider("key", "", nil, tt.model)
+			req, err := p.createRequest("hello", nil, nil, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			for k, want := range tt.want {
+				if v, ok := got[k]; want == nil && ok {
+					t.Errorf("%s = %v, want none", k, v)
+				} else if want != nil && v != want {
+					t.Errorf("%s = %v, want %v", k, v, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsReasoningModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"o1", true},
+		{"o1-mini", true},
+		{"o3-mini-2025-01-31", true},
+		{"o4-mini", true},
+		{"openai/o3", true},
+		{"gpt-5", true},
+		{"gpt-5-mini", true},
+		{"gpt-5-chat-latest", false},
+		{"gpt-4o", false},
+		{"o10", false},
+		{"deepseek-reasoner", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isReasoningModel(tt.model); got != tt.want {
+			t.Errorf("isReasoningModel(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+const (
+	blockingResponse = `{"id":"c1","object":"chat.completion","model":"m",
+"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"Hello, world",
+"tool_calls":[{"id":"call_1","type":"function","function":{"name":"read","arguments":"{\"path\":\"a.xgo\"}"}},
+{"id":"call_2","type":"function","function":{"name":"build","arguments":"{}"}}]}}],
+"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+
+	streamResponse = `data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{"role":"assistant"}}]}
+
+data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{"content":"Hello"}}]}
+
+data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{"content":", world"}}]}
+
+data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read","arguments":"{\"pa"}}]}}]}
+
+data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\"a.x"}}]}}]}
+
+data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"go\"}"}}]}}]}
+
+data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"build","arguments":""}}]}}]}
+
+data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"{}"}}]}}]}
+
+data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}
+
+data: {"id":"c1","model":"m","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}
+
+`
+)
+
+// newStreamServer serves the blocking response to blocking requests, and
+// stream followed by [DONE] if done is set to streaming ones.
+func newStreamServer(t *testing.T, stream string, done bool) *Provider {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, blockingResponse)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, stream)
+		if done {
+			io.WriteString(w, "data: [DONE]\n\n")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return NewProvider("key", srv.URL, srv.Client(), "m")
+}
+
+func TestStreamMessage(t *testing.T) {
+	p := newStreamServer(t, streamResponse, true)
+	ctx := context.Background()
+	want, err := p.SendMessage(ctx, "hello", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text strings.Builder
+	args := make(map[int]string)
+	var usage *llm.Chunk
+	got, err := p.StreamMessage(ctx, "hello", nil, nil, func(c *llm.Chunk) error {
+		switch c.Kind {
+		case llm.ChunkText:
+			text.WriteString(c.Text)
+		case llm.ChunkToolCall:
+			args[c.Index] += c.Arguments
+		case llm.ChunkUsage:
+			usage = c
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Role() != want.Role() || got.Content() != want.Content() {
+		t.Errorf("message = %s %q, want %s %q", got.Role(), got.Content(), want.Role(), want.Content())
+	}
+	if text.String() != want.Content() {
+		t.Errorf("streamed text = %q, want %q", text.String(), want.Content())
+	}
+	gotCalls, wantCalls := got.ToolCalls(), want.ToolCalls()
+	if len(gotCalls) != len(wantCalls) {
+		t.Fatalf("got %d tool calls, want %d", len(gotCalls), len(wantCalls))
+	}
+	for i, w := range wantCalls {
+		g := gotCalls[i]
+		if g.ID() != w.ID() || g.Name() != w.Name() || !reflect.DeepEqual(g.Arguments(), w.Arguments()) {
+			t.Errorf("call %d = %s %s %v, want %s %s %v", i, g.ID(), g.Name(), g.Arguments(), w.ID(), w.Name(), w.Arguments())
+		}
+		if args[i] != wantCalls[i].(*ToolCallWrapper).Call.Function.Arguments {
+			t.Errorf("streamed arguments of call %d = %q", i, args[i])
+		}
+	}
+	gi, gout := got.StatUsage()
+	wi, wo := want.StatUsage()
+	if gi != wi || gout != wo {
+		t.Errorf("usage = %d/%d, want %d/%d", gi, gout, wi, wo)
+	}
+	if usage == nil || usage.InputTokens != wi || usage.OutputTokens != wo {
+		t.Errorf("usage chunk = %+v", usage)
+	}
+}
+
+func TestStreamMessageTruncated(t *testing.T) {
+	p := newStreamServer(t, streamResponse, false)
+	_, err := p.StreamMessage(context.Background(), "hello", nil, nil, func(*llm.Chunk) error { return nil })
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("err = %v, want unexpected EOF", err)
+	}
+}
+
+func TestFactoryAPIKey(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	tests := []struct {
+		conf llm.ProviderConfig
+		want string // API key used, empty for an error
+	}{
+		{llm.ProviderConfig{}, "sk-env"},
+		{llm.ProviderConfig{BaseURL: "https://api.openai.com"}, "sk-env"},
+		{llm.ProviderConfig{BaseURL: "https://api.openai.com/v1/"}, "sk-env"},
+		{llm.ProviderConfig{BaseURL: "https://api.deepseek.com"}, ""},
+		{llm.ProviderConfig{BaseURL: "https://api.deepseek.com", APIKey: "sk-conf"}, "sk-conf"},
+	}
+	for _, tt := range tests {
+		p, err := llm.New(context.Background(), "openai", &tt.conf)
+		if tt.want == "" {
+			if err == nil || !strings.Contains(err.Error(), "no API key") {
+				t.Errorf("%+v: err = %v, want no API key", tt.conf, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", tt.conf, err)
+			continue
+		}
+		if got := p.(*Provider).client.apiKey; got != tt.want {
+			t.Errorf("%+v: API key = %q, want %q", tt.conf, got, tt.want)
+		}
+	}
+}
+
+func TestFactoryReasoning(t *testing.T) {
+	tests := []struct {
+		conf llm.ProviderConfig
+		want bool
+	}{
+		{llm.ProviderConfig{APIKey: "k"}, false},
+		{llm.ProviderConfig{APIKey: "k", Model: "o3-mini"}, true},
+		{llm.ProviderConfig{APIKey: "k", Model: "ft:my-reasoner", Reasoning: true}, true},
+	}
+	for _, tt := range tests {
+		p, err := llm.New(context.Background(), "openai", &tt.conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.(*Provider).reasoning; got != tt.want {
+			t.Errorf("%+v: reasoning = %v, want %v", tt.conf, got, tt.want)
+		}
+	}
+}
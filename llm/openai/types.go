@@ -1,11 +1,56 @@
 package openai
 
+import "encoding/json"
+
 type CreateRequest struct {
 	Model       string         `json:"model"`
 	Messages    []MessageParam `json:"messages"`
 	Tools       []Tool         `json:"tools,omitempty"`
 	MaxTokens   int            `json:"max_tokens,omitempty"`
-	Temperature float32        `json:"temperature,omitempty"`
+	Temperature *float64       `json:"temperature,omitempty"`
+
+	TopP             *float64 `json:"top_p,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
+	ToolChoice        any   `json:"tool_choice,omitempty"` // auto, none, required or a ToolChoice
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+
+	// Reasoning models take max_completion_tokens instead of max_tokens.
+	MaxCompletionTokens int    `json:"max_completion_tokens,omitempty"`
+	ReasoningEffort     string `json:"reasoning_effort,omitempty"` // low, medium or high
+}
+
+type ToolChoice struct {
+	Type     string       `json:"type"` // function
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name string `json:"name"`
+}
+
+type ResponseFormat struct {
+	Type       string      `json:"type"` // text, json_object or json_schema
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+type JSONSchema struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      bool           `json:"strict,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type MessageParam struct {
@@ -16,6 +61,38 @@ type MessageParam struct {
 	ToolCalls        []ToolCall    `json:"tool_calls,omitempty"`
 	Name             string        `json:"name,omitempty"`
 	ToolCallID       string        `json:"tool_call_id,omitempty"`
+
+	// Parts replaces Content when sending content other than text.
+	Parts []ContentPart `json:"-"`
+}
+
+// MarshalJSON encodes Parts, if any, as the content of the message.
+func (m MessageParam) MarshalJSON() ([]byte, error) {
+	type param MessageParam
+	if len(m.Parts) == 0 {
+		return json.Marshal(param(m))
+	}
+	return json.Marshal(struct {
+		param
+		Content []ContentPart `json:"content"`
+	}{param(m), m.Parts})
+}
+
+// ContentPart is a part of the content of a message.
+type ContentPart struct {
+	Type     string    `json:"type"` // text, image_url or file
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+	File     *File     `json:"file,omitempty"`
+}
+
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+type File struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data"` // data URL
 }
 
 type ToolCall struct {
@@ -56,7 +133,47 @@ type Choice struct {
 }
 
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// StreamResponse represents a chunk of a streaming response.
+type StreamResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Usage   *Usage         `json:"usage,omitempty"`
+	Choices []StreamChoice `json:"choices"`
+}
+
+type StreamChoice struct {
+	Index        int          `json:"index"`
+	Delta        MessageDelta `json:"delta"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+type MessageDelta struct {
+	Role             string          `json:"role,omitempty"`
+	Content          string          `json:"content,omitempty"`
+	ReasoningContent string          `json:"reasoning_content,omitempty"`
+	ToolCalls        []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+type ToolCallDelta struct {
+	Index    int          `json:"index"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
 }
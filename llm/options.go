@@ -0,0 +1,334 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/qiniu/x/log"
+)
+
+// Options holds the settings of a request sent by Provider.SendMessage.
+// Generation parameters left unset use the defaults of the provider or its
+// backend. Providers ignore the parameters their backend does not support
+// with a warning.
+type Options struct {
+	// System is the system prompt of the conversation.
+	System string `json:"system,omitempty"`
+
+	// MaxTokens is the maximum number of tokens to generate.
+	MaxTokens int `json:"max_tokens,omitempty"`
+
+	// Temperature controls the randomness of the output.
+	Temperature *float64 `json:"temperature,omitempty"`
+
+	// TopP is the cumulative probability of nucleus sampling.
+	TopP *float64 `json:"top_p,omitempty"`
+
+	// TopK limits sampling to the K most likely tokens.
+	TopK *int `json:"top_k,omitempty"`
+
+	// Stop lists the sequences that stop the generation.
+	Stop []string `json:"stop,omitempty"`
+
+	// Seed makes the sampling deterministic where supported.
+	Seed *int `json:"seed,omitempty"`
+
+	// PresencePenalty and FrequencyPenalty penalize tokens that already
+	// appeared in the output.
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+
+	// ResponseFormat asks for a JSON response.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
+	// ToolChoice controls whether the model calls tools. If nil, the model
+	// decides.
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+
+	// ParallelToolCalls allows or forbids several tool calls in a response.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+
+	// Thinking is the number of tokens the model may spend reasoning before
+	// answering, for the models supporting it. Backends taking a reasoning
+	// effort rather than a budget map it to low, medium or high. If
+	// negative, reasoning is disabled where possible.
+	Thinking int `json:"thinking,omitempty"`
+
+	// NoCache disables the caching of the prompt prefix by the backends
+	// caching only on request, such as Anthropic.
+	NoCache bool `json:"no_cache,omitempty"`
+}
+
+// ReasoningEffort maps a Thinking budget to the reasoning efforts low,
+// medium and high.
+func ReasoningEffort(budget int) string {
+	switch {
+	case budget <= 2048:
+		return "low"
+	case budget <= 8192:
+		return "medium"
+	}
+	return "high"
+}
+
+// ToolChoiceMode is the mode of a ToolChoice.
+type ToolChoiceMode string
+
+const (
+	// ToolChoiceAuto lets the model decide whether to call tools.
+	ToolChoiceAuto ToolChoiceMode = "auto"
+	// ToolChoiceNone forbids tool calls.
+	ToolChoiceNone ToolChoiceMode = "none"
+	// ToolChoiceRequired forces the model to call at least one tool.
+	ToolChoiceRequired ToolChoiceMode = "required"
+	// ToolChoiceTool forces the model to call the tool named by
+	// ToolChoice.Name.
+	ToolChoiceTool ToolChoiceMode = "tool"
+)
+
+// ToolChoice controls whether the model calls tools.
+type ToolChoice struct {
+	Mode ToolChoiceMode `json:"mode"`
+
+	// Name is the name of the tool to call in mode ToolChoiceTool.
+	Name string `json:"name,omitempty"`
+}
+
+// ResponseFormat describes the JSON response expected. Providers use the
+// native mechanism of their backend to enforce it, such as a JSON schema
+// response format or a forced tool call. The response must still be
+// validated: see package structured.
+type ResponseFormat struct {
+	// Name identifies the format, such as "refactor_suggestions". It must
+	// be a valid tool name.
+	Name string `json:"name"`
+
+	// Description describes the response.
+	Description string `json:"description,omitempty"`
+
+	// Schema is the JSON schema of the response, which must be an object.
+	// If nil, any JSON object is accepted.
+	Schema map[string]any `json:"schema,omitempty"`
+}
+
+// Option configures the Options of a request.
+type Option func(opts *Options)
+
+// WithSystem sets the system prompt of a request.
+func WithSystem(system string) Option {
+	return func(opts *Options) {
+		opts.System = system
+	}
+}
+
+// WithMaxTokens sets the maximum number of tokens to generate.
+func WithMaxTokens(n int) Option {
+	return func(opts *Options) {
+		opts.MaxTokens = n
+	}
+}
+
+// WithTemperature sets the sampling temperature.
+func WithTemperature(t float64) Option {
+	return func(opts *Options) {
+		opts.Temperature = &t
+	}
+}
+
+// WithTopP sets the cumulative probability of nucleus sampling.
+func WithTopP(p float64) Option {
+	return func(opts *Options) {
+		opts.TopP = &p
+	}
+}
+
+// WithTopK limits sampling to the k most likely tokens.
+func WithTopK(k int) Option {
+	return func(opts *Options) {
+		opts.TopK = &k
+	}
+}
+
+// WithStop sets the sequences that stop the generation.
+func WithStop(stop ...string) Option {
+	return func(opts *Options) {
+		opts.Stop = stop
+	}
+}
+
+// WithSeed sets the seed of the sampling.
+func WithSeed(seed int) Option {
+	return func(opts *Options) {
+		opts.Seed = &seed
+	}
+}
+
+// WithPresencePenalty sets the presence penalty.
+func WithPresencePenalty(penalty float64) Option {
+	return func(opts *Options) {
+		opts.PresencePenalty = &penalty
+	}
+}
+
+// WithFrequencyPenalty sets the frequency penalty.
+func WithFrequencyPenalty(penalty float64) Option {
+	return func(opts *Options) {
+		opts.FrequencyPenalty = &penalty
+	}
+}
+
+// WithResponseFormat asks for a JSON response conforming to format.
+func WithResponseFormat(format *ResponseFormat) Option {
+	return func(opts *Options) {
+		opts.ResponseFormat = format
+	}
+}
+
+// WithToolChoice sets whether the model calls tools. Use WithTool to force
+// the call of a given tool.
+func WithToolChoice(mode ToolChoiceMode) Option {
+	return func(opts *Options) {
+		opts.ToolChoice = &ToolChoice{Mode: mode}
+	}
+}
+
+// WithTool forces the model to call the tool name.
+func WithTool(name string) Option {
+	return func(opts *Options) {
+		opts.ToolChoice = &ToolChoice{Mode: ToolChoiceTool, Name: name}
+	}
+}
+
+// WithParallelToolCalls allows or forbids several tool calls in a response.
+func WithParallelToolCalls(parallel bool) Option {
+	return func(opts *Options) {
+		opts.ParallelToolCalls = &parallel
+	}
+}
+
+// WithThinking sets the number of tokens the model may spend reasoning
+// before answering.
+func WithThinking(budget int) Option {
+	return func(opts *Options) {
+		opts.Thinking = budget
+	}
+}
+
+// WithCache enables or disables the caching of the prompt prefix, enabled
+// by default.
+func WithCache(enabled bool) Option {
+	return func(opts *Options) {
+		opts.NoCache = !enabled
+	}
+}
+
+// ResponseText returns the JSON document of a response to a request with
+// format: the arguments of the tool call named after the format if any,
+// the text of the response otherwise, without Markdown code fences.
+func ResponseText(msg Message, format *ResponseFormat) string {
+	for _, call := range msg.ToolCalls() {
+		if call.Name() == format.Name {
+			data, _ := json.Marshal(call.Arguments())
+			return string(data)
+		}
+	}
+	text := strings.TrimSpace(msg.Content())
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text[3:], "json")
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+	return text
+}
+
+// WithOptions applies the settings of o that are set, leaving the others
+// unchanged. It is used to apply defaults read from a configuration file.
+func WithOptions(o *Options) Option {
+	return func(opts *Options) {
+		if o.System != "" {
+			opts.System = o.System
+		}
+		if o.MaxTokens > 0 {
+			opts.MaxTokens = o.MaxTokens
+		}
+		if o.Temperature != nil {
+			opts.Temperature = o.Temperature
+		}
+		if o.TopP != nil {
+			opts.TopP = o.TopP
+		}
+		if o.TopK != nil {
+			opts.TopK = o.TopK
+		}
+		if o.Stop != nil {
+			opts.Stop = o.Stop
+		}
+		if o.Seed != nil {
+			opts.Seed = o.Seed
+		}
+		if o.PresencePenalty != nil {
+			opts.PresencePenalty = o.PresencePenalty
+		}
+		if o.FrequencyPenalty != nil {
+			opts.FrequencyPenalty = o.FrequencyPenalty
+		}
+		if o.ResponseFormat != nil {
+			opts.ResponseFormat = o.ResponseFormat
+		}
+		if o.ToolChoice != nil {
+			opts.ToolChoice = o.ToolChoice
+		}
+		if o.ParallelToolCalls != nil {
+			opts.ParallelToolCalls = o.ParallelToolCalls
+		}
+		if o.Thinking != 0 {
+			opts.Thinking = o.Thinking
+		}
+		if o.NoCache {
+			opts.NoCache = true
+		}
+	}
+}
+
+// Configurable is implemented by providers accepting default options.
+type Configurable interface {
+	// SetOptions sets the default options of all requests. Options given
+	// to a single request are applied after them.
+	SetOptions(opts ...Option)
+}
+
+// WarnUnsupported logs a warning that the provider ignores an option.
+func WarnUnsupported(provider, option string) {
+	log.Warn("option not supported, ignored",
+		"provider", provider,
+		"option", option)
+}
+
+// NewOptions creates Options by applying opts in order.
+func NewOptions(opts ...Option) *Options {
+	ret := new(Options)
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// SystemPrompt returns the system prompt of a request and the messages
+// without system messages. The system prompt consists of opts.System and
+// the contents of all messages whose role is "system".
+func SystemPrompt(opts *Options, messages []Message) (system string, rest []Message) {
+	var parts []string
+	if opts.System != "" {
+		parts = append(parts, opts.System)
+	}
+	rest = make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role() == "system" {
+			if text := strings.TrimSpace(msg.Content()); text != "" {
+				parts = append(parts, text)
+			}
+			continue
+		}
+		rest = append(rest, msg)
+	}
+	return strings.Join(parts, "\n\n"), rest
+}
@@ -0,0 +1,58 @@
+package llm
+
+import "strings"
+
+// Thought is a piece of the reasoning of a model before its answer.
+type Thought struct {
+	// Text is the reasoning text.
+	Text string `json:"text,omitempty"`
+
+	// Signature authenticates Text for the backend that produced it, which
+	// may require the thought back unchanged in the next turn.
+	Signature string `json:"signature,omitempty"`
+
+	// Redacted is the encrypted reasoning the backend did not reveal.
+	Redacted string `json:"redacted,omitempty"`
+}
+
+// ReasoningMessage is implemented by messages exposing the reasoning of the
+// model.
+type ReasoningMessage interface {
+	Message
+
+	// Thoughts returns the reasoning of the model, in order.
+	Thoughts() []Thought
+}
+
+// ThoughtsOf returns the reasoning of msg if it exposes it.
+func ThoughtsOf(msg Message) []Thought {
+	if m, ok := msg.(ReasoningMessage); ok {
+		return m.Thoughts()
+	}
+	return nil
+}
+
+// ReasoningOf returns the reasoning text of msg, or "" if it exposes none.
+func ReasoningOf(msg Message) string {
+	var texts []string
+	for _, t := range ThoughtsOf(msg) {
+		if t.Text != "" {
+			texts = append(texts, t.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// SplitThink separates the reasoning enclosed in <think> tags at the start
+// of text, as produced by open reasoning models, from the answer.
+func SplitThink(text string) (reasoning, answer string) {
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+	if !strings.HasPrefix(trimmed, "<think>") {
+		return "", text
+	}
+	reasoning, answer, found := strings.Cut(trimmed[len("<think>"):], "</think>")
+	if !found { // cut off while thinking
+		return strings.TrimSpace(reasoning), ""
+	}
+	return strings.TrimSpace(reasoning), strings.TrimLeft(answer, " \t\r\n")
+}
@@ -0,0 +1,237 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attempt describes a failed attempt that is about to be retried.
+type Attempt struct {
+	// N is the number of the retry, starting from 1.
+	N int
+
+	// Delay is the time to wait before the retry.
+	Delay time.Duration
+
+	// StatusCode is the HTTP status of the failed attempt, or 0 if the
+	// request failed without a response.
+	StatusCode int
+
+	// Err is the error of the failed attempt, or nil if it returned a
+	// response with a retryable status.
+	Err error
+}
+
+// Error is implemented by errors describing a failed response, such as
+// *llm.Error. When send returns one, Do relies on it rather than on the
+// status code alone, so that a permanent failure reported with a
+// transient status, like an exhausted quota, is not retried.
+type Error interface {
+	error
+
+	// HTTPStatus returns the HTTP status of the failed response.
+	HTTPStatus() int
+
+	// Temporary reports whether the request may succeed if retried.
+	Temporary() bool
+
+	// Delay returns the delay requested by the server before retrying,
+	// or 0 if not given.
+	Delay() time.Duration
+}
+
+// Policy configures how failed requests are retried.
+type Policy struct {
+	// MaxRetries is the maximum number of retries after the first attempt.
+	MaxRetries int
+
+	// BaseDelay is the delay before the first retry. It doubles on each
+	// following retry.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between two attempts, including delays
+	// requested by the server.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction of the delay, between 0 and 1, that is
+	// randomized to avoid retrying in lockstep with other clients.
+	Jitter float64
+
+	// OnRetry is called before each retry if not nil.
+	OnRetry func(a *Attempt)
+}
+
+// Default returns the default retry policy.
+func Default() *Policy {
+	return &Policy{
+		MaxRetries: 3,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   60 * time.Second,
+		Jitter:     0.2,
+	}
+}
+
+// IsRetryableStatus reports whether a request failed with the HTTP status
+// code is worth retrying.
+func IsRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		529: // Anthropic overloaded_error
+		return true
+	}
+	return false
+}
+
+// Do calls send until it succeeds, fails with a non retryable error or the
+// retries are exhausted. Besides errors implementing Error, only network
+// and I/O failures of send, such as a reset connection, are retried. The
+// last response or error is returned as is, so the caller handles it like
+// that of a single attempt. send must create a new request on each call. A
+// nil Policy makes a single attempt.
+func (p *Policy) Do(ctx context.Context, send func() (*http.Response, error)) (*http.Response, error) {
+	for n := 1; ; n++ {
+		resp, err := send()
+		if p == nil || n > p.MaxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		a := &Attempt{N: n, Err: err, Delay: p.backoff(n)}
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return resp, err
+			}
+			var e Error
+			if errors.As(err, &e) {
+				if !e.Temporary() {
+					return resp, err
+				}
+				a.StatusCode = e.HTTPStatus()
+				if d := e.Delay(); d > 0 {
+					a.Delay = d
+				}
+			} else if !isTransportError(err) {
+				return resp, err
+			}
+		} else {
+			if !IsRetryableStatus(resp.StatusCode) {
+				return resp, err
+			}
+			a.StatusCode = resp.StatusCode
+			if d, ok := RetryAfter(resp.Header, time.Now()); ok {
+				a.Delay = d
+			}
+		}
+		if p.MaxDelay > 0 && a.Delay > p.MaxDelay {
+			a.Delay = p.MaxDelay
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < a.Delay {
+			return resp, err // no time left for another attempt
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(a)
+		}
+
+		t := time.NewTimer(a.Delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// isTransportError reports whether err is a network or I/O failure, as
+// opposed to an error like an invalid request that would fail again.
+func isTransportError(err error) bool {
+	var ue *url.Error
+	if errors.As(err, &ue) { // *url.Error is a net.Error whatever its cause
+		err = ue.Err
+	}
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (p *Policy) backoff(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.Jitter > 0 {
+		j := float64(d) * p.Jitter
+		d += time.Duration(j*rand.Float64()*2 - j)
+	}
+	return d
+}
+
+// RetryAfter returns the delay requested by the server in the headers of a
+// failed response. It understands the standard Retry-After header, the
+// retry-after-ms header, and the rate limit headers of Anthropic
+// (anthropic-ratelimit-*-reset) and OpenAI (x-ratelimit-reset-*).
+func RetryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	if v := h.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+			return time.Duration(secs * float64(time.Second)), true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return nonNegative(t.Sub(now)), true
+		}
+	}
+
+	// Wait for the reset of the exhausted rate limits.
+	var delay time.Duration
+	var found bool
+	for key, values := range h {
+		if len(values) == 0 {
+			continue
+		}
+		key = strings.ToLower(key)
+		var remaining string
+		var d time.Duration
+		var ok bool
+		switch {
+		case strings.HasPrefix(key, "anthropic-ratelimit-") && strings.HasSuffix(key, "-reset"):
+			// anthropic-ratelimit-requests-reset: 2024-01-01T00:00:00Z
+			remaining = strings.TrimSuffix(key, "-reset") + "-remaining"
+			if t, err := time.Parse(time.RFC3339, values[0]); err == nil {
+				d, ok = nonNegative(t.Sub(now)), true
+			}
+		case strings.HasPrefix(key, "x-ratelimit-reset-"):
+			// x-ratelimit-reset-requests: 6m0s
+			remaining = "x-ratelimit-remaining-" + strings.TrimPrefix(key, "x-ratelimit-reset-")
+			if v, err := time.ParseDuration(values[0]); err == nil {
+				d, ok = nonNegative(v), true
+			}
+		}
+		if ok && h.Get(remaining) == "0" && d >= delay {
+			delay, found = d, true
+		}
+	}
+	return delay, found
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
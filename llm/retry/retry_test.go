@@ -0,0 +1,190 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// serve starts a server replying with the statuses in turn, repeating the
+// last one, and returns a send function posting to it with the number of
+// requests received.
+func serve(t *testing.T, header http.Header, statuses ...int) (func() (*http.Response, error), *int32) {
+	t.Helper()
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&n, 1)) - 1
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+		if statuses[i] != http.StatusOK {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+		}
+		w.WriteHeader(statuses[i])
+	}))
+	t.Cleanup(srv.Close)
+	send := func() (*http.Response, error) {
+		return http.Post(srv.URL, "application/json", nil)
+	}
+	return send, &n
+}
+
+func testPolicy(attempts *[]Attempt) *Policy {
+	return &Policy{
+		MaxRetries: 3,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   time.Second,
+		OnRetry: func(a *Attempt) {
+			*attempts = append(*attempts, *a)
+		},
+	}
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		statuses []int
+		want     int // final status
+		requests int32
+		delay    time.Duration // delay of the first retry if not 0
+	}{
+		{"ok", nil, []int{200}, 200, 1, 0},
+		{"bad request", nil, []int{400}, 400, 1, 0},
+		{"server errors", nil, []int{500, 502, 200}, 200, 3, 0},
+		{"overloaded", nil, []int{529, 200}, 200, 2, 0},
+		{"exhausted", nil, []int{503}, 503, 4, 0},
+		{"retry after", http.Header{"Retry-After": {"0.05"}}, []int{429, 200}, 200, 2, 50 * time.Millisecond},
+		{"retry after ms", http.Header{"Retry-After-Ms": {"20"}}, []int{429, 200}, 200, 2, 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send, n := serve(t, tt.header, tt.statuses...)
+			var attempts []Attempt
+			resp, err := testPolicy(&attempts).Do(context.Background(), send)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if got := atomic.LoadInt32(n); got != tt.requests {
+				t.Errorf("requests = %d, want %d", got, tt.requests)
+			}
+			if len(attempts) != int(tt.requests)-1 {
+				t.Fatalf("retries = %d, want %d", len(attempts), tt.requests-1)
+			}
+			for i, a := range attempts {
+				want := tt.statuses[len(tt.statuses)-1]
+				if i < len(tt.statuses) {
+					want = tt.statuses[i]
+				}
+				if a.N != i+1 || a.StatusCode != want {
+					t.Errorf("attempt %d = %+v", i, a)
+				}
+			}
+			if tt.delay != 0 && attempts[0].Delay != tt.delay {
+				t.Errorf("delay = %v, want %v", attempts[0].Delay, tt.delay)
+			}
+		})
+	}
+}
+
+type testError struct {
+	status    int
+	temporary bool
+	delay     time.Duration
+}
+
+func (e *testError) Error() string        { return http.StatusText(e.status) }
+func (e *testError) HTTPStatus() int      { return e.status }
+func (e *testError) Temporary() bool      { return e.temporary }
+func (e *testError) Delay() time.Duration { return e.delay }
+
+func TestDoError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		requests int
+	}{
+		{"quota", &testError{status: 429}, 1},
+		{"rate limit", &testError{status: 429, temporary: true, delay: time.Millisecond}, 4},
+		{"transport", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, 4},
+		{"url transport", &url.Error{Op: "Post", URL: "http://x", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, 4},
+		{"unexpected EOF", fmt.Errorf("reading response: %w", io.ErrUnexpectedEOF), 4},
+		{"request", errors.New("error creating request"), 1},
+		{"url request", &url.Error{Op: "Post", URL: "x://y", Err: errors.New("unsupported protocol scheme")}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts []Attempt
+			n := 0
+			_, err := testPolicy(&attempts).Do(context.Background(), func() (*http.Response, error) {
+				n++
+				return nil, tt.err
+			})
+			if err != tt.err {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			if n != tt.requests {
+				t.Errorf("requests = %d, want %d", n, tt.requests)
+			}
+			if e, ok := tt.err.(*testError); ok && len(attempts) > 0 {
+				if a := attempts[0]; a.StatusCode != e.status || a.Delay != e.delay {
+					t.Errorf("attempt = %+v", a)
+				}
+			}
+		})
+	}
+}
+
+func TestDoCancel(t *testing.T) {
+	send, n := serve(t, http.Header{"Retry-After": {"10"}}, 503)
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Policy{
+		MaxRetries: 3,
+		MaxDelay:   time.Minute,
+		OnRetry:    func(*Attempt) { cancel() },
+	}
+	start := time.Now()
+	resp, err := p.Do(ctx, send)
+	if !errors.Is(err, context.Canceled) || resp != nil {
+		t.Fatalf("Do = %v, %v, want context canceled", resp, err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Do returned after %v", d)
+	}
+	if got := atomic.LoadInt32(n); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestDoDeadline(t *testing.T) {
+	send, n := serve(t, http.Header{"Retry-After": {"10"}}, 503)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	p := &Policy{MaxRetries: 3, MaxDelay: time.Minute}
+	resp, err := p.Do(ctx, send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Errorf("status = %d, want 503", resp.StatusCode)
+	}
+	if got := atomic.LoadInt32(n); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
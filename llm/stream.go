@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ChunkKind identifies the kind of a streamed Chunk.
+type ChunkKind int
+
+const (
+	// ChunkText carries an incremental piece of the assistant's text.
+	ChunkText ChunkKind = iota
+
+	// ChunkToolCall carries a tool call or a fragment of its arguments.
+	ChunkToolCall
+
+	// ChunkUsage carries the final token usage of the response.
+	ChunkUsage
+
+	// ChunkReasoning carries an incremental piece of the reasoning of the
+	// model before its answer.
+	ChunkReasoning
+)
+
+// Chunk represents an incremental piece of a streamed response.
+type Chunk struct {
+	Kind ChunkKind
+
+	// Text is the text delta of a ChunkText or a ChunkReasoning.
+	Text string
+
+	// Index is the position of the tool call within the message for a
+	// ChunkToolCall. Fragments of the same tool call share the same Index.
+	Index int
+
+	// ID and Name identify the tool call for a ChunkToolCall. They are
+	// only set on the first fragment of a tool call, and ID may be empty
+	// if the backend does not assign IDs while streaming.
+	ID   string
+	Name string
+
+	// Arguments is a fragment of the JSON encoded tool arguments for a
+	// ChunkToolCall. Concatenating all fragments of the same Index yields
+	// the complete arguments.
+	Arguments string
+
+	// InputTokens and OutputTokens are the token usage of a ChunkUsage.
+	InputTokens  int
+	OutputTokens int
+}
+
+// StreamHandler is called for each chunk of a streamed response. Returning
+// an error aborts the stream, and the error is returned by StreamMessage.
+type StreamHandler func(chunk *Chunk) error
+
+// StreamingProvider is implemented by providers that can stream responses.
+type StreamingProvider interface {
+	Provider
+
+	// StreamMessage is like SendMessage but calls handler for each chunk
+	// of the response as it arrives. The returned message is the same as
+	// the one SendMessage would return.
+	StreamMessage(ctx context.Context, prompt string, messages []Message, tools []Tool, handler StreamHandler, opts ...Option) (Message, error)
+}
+
+// StreamMessage sends a message to the LLM and calls handler for each chunk
+// of the response. If p does not implement StreamingProvider, the response
+// is fetched by SendMessage and then delivered to handler as a whole.
+func StreamMessage(ctx context.Context, p Provider, prompt string, messages []Message, tools []Tool, handler StreamHandler, opts ...Option) (Message, error) {
+	if sp, ok := p.(StreamingProvider); ok {
+		return sp.StreamMessage(ctx, prompt, messages, tools, handler, opts...)
+	}
+	msg, err := p.SendMessage(ctx, prompt, messages, tools, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = EmitMessage(msg, handler); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// EmitMessage delivers a complete message to handler as a sequence of
+// chunks: its reasoning, its text, its tool calls and its usage.
+func EmitMessage(msg Message, handler StreamHandler) error {
+	if text := ReasoningOf(msg); text != "" {
+		if err := handler(&Chunk{Kind: ChunkReasoning, Text: text}); err != nil {
+			return err
+		}
+	}
+	if text := msg.Content(); text != "" {
+		if err := handler(&Chunk{Kind: ChunkText, Text: text}); err != nil {
+			return err
+		}
+	}
+	for i, call := range msg.ToolCalls() {
+		args, err := json.Marshal(call.Arguments())
+		if err != nil {
+			return err
+		}
+		err = handler(&Chunk{
+			Kind:      ChunkToolCall,
+			Index:     i,
+			ID:        call.ID(),
+			Name:      call.Name(),
+			Arguments: string(args),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	input, output := msg.StatUsage()
+	return handler(&Chunk{Kind: ChunkUsage, InputTokens: input, OutputTokens: output})
+}
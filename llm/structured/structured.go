@@ -0,0 +1,181 @@
+// Package structured asks LLMs for machine-readable responses: it requests
+// a JSON response conforming to a JSON schema with the native mechanism of
+// each backend, validates the response and, if it is invalid, asks again
+// with the validation error.
+package structured
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/history"
+	"github.com/goplus/xgowiz/llm/jsonschema"
+)
+
+// DefaultMaxRetries is the default number of times an invalid response is
+// asked again.
+const DefaultMaxRetries = 2
+
+// wrapKey is the property holding the response when the schema is not an
+// object, since most backends only accept object schemas.
+const wrapKey = "result"
+
+// InvalidError is returned when the responses are still invalid after all
+// retries.
+type InvalidError struct {
+	// Response is the text of the last response.
+	Response string
+
+	// Err is the validation error of the last response.
+	Err error
+}
+
+func (e *InvalidError) Error() string {
+	return "structured: invalid response: " + e.Err.Error()
+}
+
+func (e *InvalidError) Unwrap() error {
+	return e.Err
+}
+
+// Format is the format of a structured response.
+type Format struct {
+	// Name identifies the format, such as "refactor_suggestions".
+	Name string
+
+	// Description describes the response to the model.
+	Description string
+
+	// Schema is the JSON schema of the response. If nil, any JSON object
+	// is accepted.
+	Schema jsonschema.Schema
+
+	// MaxRetries is the number of times an invalid response is asked again.
+	// If zero, DefaultMaxRetries is used; if negative, none is.
+	MaxRetries int
+}
+
+// For returns the Format of responses decoded into values of type T. See
+// jsonschema.For for the struct tags recognized.
+func For[T any](name, description string) (*Format, error) {
+	schema, err := jsonschema.For(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	return &Format{Name: name, Description: description, Schema: schema}, nil
+}
+
+// Send sends prompt and returns the JSON response, validated against the
+// schema. The messages exchanged are not returned.
+func (f *Format) Send(ctx context.Context, p llm.Provider, prompt string, messages []llm.Message, opts ...llm.Option) (json.RawMessage, error) {
+	rf, wrapped := f.responseFormat()
+	hint := "Respond with a JSON object."
+	if rf.Schema != nil {
+		schema, err := json.Marshal(rf.Schema)
+		if err != nil {
+			return nil, err
+		}
+		hint = fmt.Sprintf("Respond with a JSON object conforming to this JSON schema:\n%s", schema)
+	}
+	msgs := append(messages[:len(messages):len(messages)], history.NewTextMessage("system", hint))
+	if prompt != "" {
+		msgs = append(msgs, history.NewTextMessage("user", prompt))
+	}
+	opts = append(opts[:len(opts):len(opts)], llm.WithResponseFormat(rf))
+
+	retries := f.MaxRetries
+	if retries == 0 {
+		retries = DefaultMaxRetries
+	}
+	for i := 0; ; i++ {
+		msg, err := p.SendMessage(ctx, "", msgs, nil, opts...)
+		if err != nil {
+			return nil, err
+		}
+		text := llm.ResponseText(msg, rf)
+		data, err := f.validate(text, wrapped)
+		if err == nil {
+			return data, nil
+		}
+		if i >= retries {
+			return nil, &InvalidError{Response: text, Err: err}
+		}
+		if msgs, err = retry(p, msgs, msg, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// responseFormat returns the format asked to the provider, whose schema
+// wraps f.Schema in an object if it is not one.
+func (f *Format) responseFormat() (rf *llm.ResponseFormat, wrapped bool) {
+	rf = &llm.ResponseFormat{Name: f.Name, Description: f.Description, Schema: f.Schema}
+	if f.Schema != nil && f.Schema["type"] != "object" {
+		rf.Schema = jsonschema.Schema{
+			"type":       "object",
+			"properties": map[string]any{wrapKey: f.Schema},
+			"required":   []string{wrapKey},
+		}
+		wrapped = true
+	}
+	return
+}
+
+func (f *Format) validate(text string, wrapped bool) (json.RawMessage, error) {
+	var v any
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return nil, &jsonschema.ValidationError{Path: "$", Message: "invalid JSON: " + err.Error()}
+	}
+	if wrapped {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, &jsonschema.ValidationError{Path: "$", Message: "expected an object with a " + wrapKey + " property"}
+		}
+		v = obj[wrapKey]
+	}
+	if f.Schema != nil {
+		if err := jsonschema.Validate(f.Schema, v); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(v)
+}
+
+// retry appends the invalid response and the validation error to msgs. A
+// forced tool call gets the error as its result.
+func retry(p llm.Provider, msgs []llm.Message, resp llm.Message, err error) ([]llm.Message, error) {
+	feedback := fmt.Sprintf("The response is invalid: %v. Respond again with JSON conforming to the schema.", err)
+	msgs = append(msgs, resp)
+	calls := resp.ToolCalls()
+	if len(calls) == 0 {
+		return append(msgs, history.NewTextMessage("user", feedback)), nil
+	}
+	for _, call := range calls {
+		tr, e := p.CreateToolResponse(call.ID(), "Error: "+feedback)
+		if e != nil {
+			return nil, e
+		}
+		if tr == nil {
+			return nil, fmt.Errorf("structured: provider %s cannot create tool responses", p.Name())
+		}
+		msgs = append(msgs, tr)
+	}
+	return msgs, nil
+}
+
+// Generate sends prompt and decodes the response into a value of type T.
+func Generate[T any](ctx context.Context, p llm.Provider, prompt string, messages []llm.Message, opts ...llm.Option) (ret T, err error) {
+	f, err := For[T]("response", "")
+	if err != nil {
+		return
+	}
+	data, err := f.Send(ctx, p, prompt, messages, opts...)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &ret)
+	return
+}
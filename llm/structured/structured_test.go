@@ -0,0 +1,270 @@
+package structured
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/history"
+	"github.com/goplus/xgowiz/llm/jsonschema"
+)
+
+type suggestion struct {
+	File  string `json:"file" desc:"file to change"`
+	Kind  string `json:"kind" enum:"rename,extract"`
+	Notes string `json:"notes,omitempty"`
+}
+
+type call struct {
+	id, name string
+	args     map[string]any
+}
+
+func (c *call) ID() string                { return c.id }
+func (c *call) Name() string              { return c.name }
+func (c *call) Arguments() map[string]any { return c.args }
+
+// message is an assistant message, or the response to the tool call
+// toolCallID if set.
+type message struct {
+	content    string
+	calls      []llm.ToolCall
+	toolCallID string
+}
+
+func (m *message) Role() string {
+	if m.toolCallID != "" {
+		return "tool"
+	}
+	return "assistant"
+}
+
+func (m *message) Content() string              { return m.content }
+func (m *message) ToolCalls() []llm.ToolCall    { return m.calls }
+func (m *message) StatUsage() (int, int)        { return 0, 0 }
+func (m *message) ToolResponse() (string, bool) { return m.toolCallID, m.toolCallID != "" }
+
+type request struct {
+	messages []llm.Message
+	opts     *llm.Options
+}
+
+// provider answers the requests with the responses in order.
+type provider struct {
+	responses []llm.Message
+	requests  []request
+	noTools   bool
+}
+
+func (p *provider) SendMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool, opts ...llm.Option) (llm.Message, error) {
+	if prompt != "" {
+		return nil, errors.New("unexpected prompt")
+	}
+	p.requests = append(p.requests, request{messages, llm.NewOptions(opts...)})
+	if len(p.requests) > len(p.responses) {
+		return nil, errors.New("no more responses")
+	}
+	return p.responses[len(p.requests)-1], nil
+}
+
+func (p *provider) CreateToolResponse(id string, content any) (llm.Message, error) {
+	if p.noTools {
+		return nil, nil
+	}
+	return &message{content: content.(string), toolCallID: id}, nil
+}
+
+func (p *provider) SupportsTools() bool { return true }
+func (p *provider) Name() string        { return "fake" }
+
+func texts(responses ...string) []llm.Message {
+	ret := make([]llm.Message, len(responses))
+	for i, r := range responses {
+		ret[i] = &message{content: r}
+	}
+	return ret
+}
+
+func TestFor(t *testing.T) {
+	f, err := For[suggestion]("suggestion", "a refactoring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := jsonschema.For(reflect.TypeOf(suggestion{}))
+	if f.Name != "suggestion" || f.Description != "a refactoring" || !reflect.DeepEqual(f.Schema, want) {
+		t.Errorf("For = %+v", f)
+	}
+	props := f.Schema["properties"].(map[string]any)
+	if kind := props["kind"].(jsonschema.Schema); !reflect.DeepEqual(kind["enum"], []any{"rename", "extract"}) {
+		t.Errorf("kind = %v", kind)
+	}
+	if _, err = For[chan int]("c", ""); err == nil {
+		t.Error("For[chan int] succeeded")
+	}
+}
+
+func TestSendRequest(t *testing.T) {
+	f, err := For[suggestion]("suggestion", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &provider{responses: texts(`{"file": "a.xgo", "kind": "rename"}`)}
+	earlier := []llm.Message{history.NewTextMessage("user", "earlier")}
+	data, err := f.Send(context.Background(), p, "suggest", earlier, llm.WithTemperature(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"file":"a.xgo","kind":"rename"}` {
+		t.Errorf("Send = %s", data)
+	}
+	if len(earlier) != 1 {
+		t.Errorf("messages changed: %d", len(earlier))
+	}
+
+	req := p.requests[0]
+	if rf := req.opts.ResponseFormat; rf == nil || rf.Name != "suggestion" || !reflect.DeepEqual(rf.Schema, f.Schema) {
+		t.Errorf("response format = %+v", rf)
+	}
+	if req.opts.Temperature == nil || *req.opts.Temperature != 0 {
+		t.Errorf("options not passed: %+v", req.opts)
+	}
+	if len(req.messages) != 3 {
+		t.Fatalf("%d messages, want 3", len(req.messages))
+	}
+	schema, _ := json.Marshal(f.Schema)
+	if hint := req.messages[1]; hint.Role() != "system" || !strings.Contains(hint.Content(), string(schema)) {
+		t.Errorf("hint = %s: %s", hint.Role(), hint.Content())
+	}
+	if prompt := req.messages[2]; prompt.Role() != "user" || prompt.Content() != "suggest" {
+		t.Errorf("prompt = %s: %s", prompt.Role(), prompt.Content())
+	}
+}
+
+func TestSendWrapped(t *testing.T) {
+	f, err := For[[]string]("names", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &provider{responses: texts("```json\n{\"result\": [\"a\", \"b\"]}\n```")}
+	data, err := f.Send(context.Background(), p, "names?", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["a","b"]` {
+		t.Errorf("Send = %s", data)
+	}
+	rf := p.requests[0].opts.ResponseFormat
+	if rf.Schema["type"] != "object" || !reflect.DeepEqual(rf.Schema["properties"], map[string]any{"result": f.Schema}) {
+		t.Errorf("wrapped schema = %v", rf.Schema)
+	}
+}
+
+func TestSendRetry(t *testing.T) {
+	f, err := For[suggestion]("suggestion", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &provider{responses: texts(
+		"not json",
+		`{"file": "a.xgo", "kind": "inline"}`,
+		`{"file": "a.xgo", "kind": "extract", "notes": "ok"}`,
+	)}
+	data, err := f.Send(context.Background(), p, "suggest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"file":"a.xgo","kind":"extract","notes":"ok"}` {
+		t.Errorf("Send = %s", data)
+	}
+	if len(p.requests) != 3 {
+		t.Fatalf("%d requests, want 3", len(p.requests))
+	}
+	// Each retry sees the invalid response and the validation error.
+	msgs := p.requests[2].messages
+	if len(msgs) != 6 {
+		t.Fatalf("%d messages, want 6", len(msgs))
+	}
+	if msgs[2] != p.responses[0] || msgs[4] != p.responses[1] {
+		t.Error("invalid responses not resent")
+	}
+	if fb := msgs[3].Content(); !strings.Contains(fb, "invalid JSON") {
+		t.Errorf("feedback = %s", fb)
+	}
+	if fb := msgs[5].Content(); msgs[5].Role() != "user" || !strings.Contains(fb, "kind") {
+		t.Errorf("feedback = %s", fb)
+	}
+}
+
+func TestSendInvalid(t *testing.T) {
+	tests := []struct {
+		maxRetries, requests int
+	}{
+		{0, DefaultMaxRetries + 1},
+		{-1, 1},
+		{1, 2},
+	}
+	for _, tt := range tests {
+		f := &Format{Name: "n", Schema: jsonschema.Schema{"type": "integer"}, MaxRetries: tt.maxRetries}
+		p := &provider{responses: texts(`{"result": "x"}`, `{"result": "y"}`, `{"result": "z"}`)}
+		_, err := f.Send(context.Background(), p, "n?", nil)
+		var invalid *InvalidError
+		if !errors.As(err, &invalid) {
+			t.Errorf("MaxRetries %d: err = %v, want InvalidError", tt.maxRetries, err)
+			continue
+		}
+		if len(p.requests) != tt.requests || invalid.Response != p.responses[tt.requests-1].Content() {
+			t.Errorf("MaxRetries %d: %d requests, response %s", tt.maxRetries, len(p.requests), invalid.Response)
+		}
+		var verr *jsonschema.ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("MaxRetries %d: err = %v, want a ValidationError", tt.maxRetries, err)
+		}
+	}
+}
+
+func TestSendToolCall(t *testing.T) {
+	f, err := For[suggestion]("suggestion", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &provider{responses: []llm.Message{
+		&message{calls: []llm.ToolCall{&call{"c1", "suggestion", map[string]any{"file": "a.xgo"}}}},
+		&message{calls: []llm.ToolCall{&call{"c2", "suggestion", map[string]any{"file": "a.xgo", "kind": "rename"}}}},
+	}}
+	data, err := f.Send(context.Background(), p, "suggest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"file":"a.xgo","kind":"rename"}` {
+		t.Errorf("Send = %s", data)
+	}
+	// The forced tool call gets the error as its result.
+	msgs := p.requests[1].messages
+	id, ok := msgs[len(msgs)-1].ToolResponse()
+	if !ok || id != "c1" || !strings.Contains(msgs[len(msgs)-1].Content(), "Error: The response is invalid") {
+		t.Errorf("retry ends with %s: %s", msgs[len(msgs)-1].Role(), msgs[len(msgs)-1].Content())
+	}
+
+	p = &provider{responses: p.responses, noTools: true}
+	if _, err = f.Send(context.Background(), p, "suggest", nil); err == nil || !strings.Contains(err.Error(), "cannot create tool responses") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	p := &provider{responses: texts(`{"file": "b.xgo", "kind": "extract"}`)}
+	got, err := Generate[suggestion](context.Background(), p, "suggest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (suggestion{File: "b.xgo", Kind: "extract"}) {
+		t.Errorf("Generate = %+v", got)
+	}
+	if _, err = Generate[suggestion](context.Background(), p, "suggest", nil); err == nil {
+		t.Error("Generate succeeded without response")
+	}
+}
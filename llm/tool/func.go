@@ -0,0 +1,106 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/jsonschema"
+)
+
+// ArgumentError reports invalid arguments of a tool call. Its message is
+// meant to be sent back to the LLM so that it can correct the call.
+type ArgumentError struct {
+	Tool string
+	Err  error
+}
+
+func (e *ArgumentError) Error() string {
+	return fmt.Sprintf("invalid arguments for tool %s: %v", e.Tool, e.Err)
+}
+
+func (e *ArgumentError) Unwrap() error {
+	return e.Err
+}
+
+// Schema derives the input schema of a tool from the struct type t. See
+// jsonschema.For for the struct tags recognized.
+func Schema(t reflect.Type) (llm.Schema, error) {
+	s, err := jsonschema.For(t)
+	if err != nil {
+		return llm.Schema{}, err
+	}
+	if s["type"] != "object" || s["properties"] == nil {
+		return llm.Schema{}, fmt.Errorf("tool: arguments type %v is not a struct", t)
+	}
+	return llm.Schema{
+		Type:       "object",
+		Properties: s["properties"].(map[string]any),
+		Required:   s["required"].([]string),
+	}, nil
+}
+
+// Func creates a tool from a function taking its arguments as a struct of
+// type T. The input schema of the tool is derived from T, and the arguments
+// of each call are validated against it before being decoded into T.
+func Func[T any, R any](name, description string, fn func(ctx context.Context, args T) (R, error)) (llm.Tool, Handler, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	full, err := jsonschema.For(t)
+	if err != nil {
+		return llm.Tool{}, nil, err
+	}
+	schema, err := Schema(t)
+	if err != nil {
+		return llm.Tool{}, nil, err
+	}
+	tool := llm.Tool{
+		Name:        name,
+		Description: description,
+		InputSchema: schema,
+	}
+	handler := func(ctx context.Context, args map[string]any) (any, error) {
+		var in T
+		if err := decode(full, args, &in); err != nil {
+			return nil, &ArgumentError{Tool: name, Err: err}
+		}
+		return fn(ctx, in)
+	}
+	return tool, handler, nil
+}
+
+// Register adds a tool created by Func to r.
+func Register[T any, R any](r *Registry, name, description string, fn func(ctx context.Context, args T) (R, error)) error {
+	tool, handler, err := Func(name, description, fn)
+	if err != nil {
+		return err
+	}
+	return r.Add(tool, handler)
+}
+
+// MustRegister is like Register but panics on error.
+func MustRegister[T any, R any](r *Registry, name, description string, fn func(ctx context.Context, args T) (R, error)) {
+	if err := Register(r, name, description, fn); err != nil {
+		panic(err)
+	}
+}
+
+func decode(schema jsonschema.Schema, args map[string]any, ret any) error {
+	if args == nil {
+		args = map[string]any{}
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	// Normalize the arguments to their decoded JSON form before validation.
+	var v any
+	if err = json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err = jsonschema.Validate(schema, v); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, ret)
+}
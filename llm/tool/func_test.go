@@ -0,0 +1,117 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type option struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+type buildArgs struct {
+	Package string            `json:"package" desc:"package to build"`
+	Mode    string            `json:"mode,omitempty" enum:"debug,release"`
+	Options []option          `json:"options,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Output  *string           `json:"output"`
+}
+
+type call struct {
+	name string
+	args map[string]any
+}
+
+func (c call) ID() string                { return "call_0" }
+func (c call) Name() string              { return c.name }
+func (c call) Arguments() map[string]any { return c.args }
+
+func TestFunc(t *testing.T) {
+	var got buildArgs
+	tool, handler, err := Func("build", "Build a package.", func(ctx context.Context, args buildArgs) (string, error) {
+		got = args
+		return "ok " + args.Package, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool.Name != "build" || tool.Description != "Build a package." || tool.InputSchema.Type != "object" {
+		t.Errorf("tool = %+v", tool)
+	}
+	if want := []string{"package"}; !reflect.DeepEqual(tool.InputSchema.Required, want) {
+		t.Errorf("required = %v, want %v", tool.InputSchema.Required, want)
+	}
+	if len(tool.InputSchema.Properties) != 5 {
+		t.Errorf("properties = %v", tool.InputSchema.Properties)
+	}
+
+	res, err := handler(context.Background(), map[string]any{
+		"package": "./cmd",
+		"mode":    "release",
+		"options": []any{map[string]any{"key": "tags", "value": "netgo"}},
+		"env":     map[string]any{"GOOS": "linux"},
+		"output":  "bin/cmd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "ok ./cmd" {
+		t.Errorf("result = %v", res)
+	}
+	out := "bin/cmd"
+	want := buildArgs{
+		Package: "./cmd",
+		Mode:    "release",
+		Options: []option{{"tags", "netgo"}},
+		Env:     map[string]string{"GOOS": "linux"},
+		Output:  &out,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("args = %+v, want %+v", got, want)
+	}
+}
+
+func TestFuncInvalidArguments(t *testing.T) {
+	_, handler, err := Func("build", "", func(ctx context.Context, args buildArgs) (string, error) {
+		t.Error("handler called with invalid arguments")
+		return "", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{"nil", nil, `missing required property "package"`},
+		{"type", map[string]any{"package": 1}, "$.package: expected string, got integer"},
+		{"enum", map[string]any{"package": "a", "mode": "fast"}, `$.mode: value "fast" is not one of`},
+		{"nested", map[string]any{"package": "a", "options": []any{map[string]any{"value": "v"}}},
+			`$.options[0]: missing required property "key"`},
+		{"map", map[string]any{"package": "a", "env": map[string]any{"X": true}}, "$.env.X: expected string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := handler(context.Background(), tt.args)
+			var ae *ArgumentError
+			if !errors.As(err, &ae) || ae.Tool != "build" {
+				t.Fatalf("err = %v, want an ArgumentError", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuncNotStruct(t *testing.T) {
+	_, _, err := Func("f", "", func(ctx context.Context, args []string) (string, error) { return "", nil })
+	if err == nil || !strings.Contains(err.Error(), "is not a struct") {
+		t.Errorf("err = %v, want not a struct", err)
+	}
+}
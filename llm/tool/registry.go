@@ -0,0 +1,100 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/agent"
+)
+
+var (
+	_ agent.Toolbox = (*Registry)(nil)
+)
+
+// Handler executes a tool with the arguments of a tool call.
+type Handler func(ctx context.Context, args map[string]any) (any, error)
+
+// Registry holds tools and dispatches tool calls to their handlers.
+// It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	tools []llm.Tool
+	index map[string]int
+	funcs []Handler
+}
+
+// NewRegistry creates a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{index: make(map[string]int)}
+}
+
+// Add registers a tool with its handler.
+func (r *Registry) Add(tool llm.Tool, handler Handler) error {
+	if tool.Name == "" {
+		return fmt.Errorf("tool: empty tool name")
+	}
+	if handler == nil {
+		return fmt.Errorf("tool: nil handler for tool %s", tool.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.index[tool.Name]; ok {
+		return fmt.Errorf("tool: tool %s already registered", tool.Name)
+	}
+	r.index[tool.Name] = len(r.tools)
+	r.tools = append(r.tools, tool)
+	r.funcs = append(r.funcs, handler)
+	return nil
+}
+
+// Remove unregisters the tool named name. It returns false if no such tool
+// is registered.
+func (r *Registry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, ok := r.index[name]
+	if !ok {
+		return false
+	}
+	r.tools = append(r.tools[:i], r.tools[i+1:]...)
+	r.funcs = append(r.funcs[:i], r.funcs[i+1:]...)
+	delete(r.index, name)
+	for j := i; j < len(r.tools); j++ {
+		r.index[r.tools[j].Name] = j
+	}
+	return true
+}
+
+// Lookup returns the tool named name and its handler.
+func (r *Registry) Lookup(name string) (tool llm.Tool, handler Handler, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	i, ok := r.index[name]
+	if !ok {
+		return
+	}
+	return r.tools[i], r.funcs[i], true
+}
+
+// Tools returns the definitions of all tools in registration order.
+func (r *Registry) Tools() []llm.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]llm.Tool(nil), r.tools...)
+}
+
+// Call executes the tool named name with args.
+func (r *Registry) Call(ctx context.Context, name string, args map[string]any) (any, error) {
+	_, handler, ok := r.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("tool %s not found", name)
+	}
+	return handler(ctx, args)
+}
+
+// CallTool executes a tool call requested by the LLM.
+func (r *Registry) CallTool(ctx context.Context, call llm.ToolCall) (any, error) {
+	return r.Call(ctx, call.Name(), call.Arguments())
+}
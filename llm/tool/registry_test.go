@@ -0,0 +1,50 @@
+package tool
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	echo := func(ctx context.Context, args option) (string, error) { return args.Key, nil }
+	for _, name := range []string{"a", "b", "c"} {
+		if err := Register(r, name, "", echo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Register(r, "b", "", echo); err == nil {
+		t.Error("duplicate tool registered")
+	}
+	if err := r.Add(llm.Tool{Name: "d"}, nil); err == nil {
+		t.Error("nil handler registered")
+	}
+	if err := r.Add(llm.Tool{}, func(context.Context, map[string]any) (any, error) { return nil, nil }); err == nil {
+		t.Error("empty name registered")
+	}
+
+	if !r.Remove("b") || r.Remove("b") {
+		t.Error("Remove(b) should succeed once")
+	}
+	var names []string
+	for _, tool := range r.Tools() {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); got != "a,c" {
+		t.Errorf("tools = %s, want a,c", got)
+	}
+	if tool, _, ok := r.Lookup("c"); !ok || tool.Name != "c" {
+		t.Errorf("Lookup(c) = %+v, %v", tool, ok)
+	}
+
+	res, err := r.CallTool(context.Background(), call{"c", map[string]any{"key": "k"}})
+	if err != nil || res != "k" {
+		t.Errorf("CallTool(c) = %v, %v", res, err)
+	}
+	if _, err := r.Call(context.Background(), "b", nil); err == nil || err.Error() != "tool b not found" {
+		t.Errorf("Call(b) err = %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package llm
+
+// Usage is the token usage of a response.
+type Usage struct {
+	// InputTokens is the number of tokens of the request, including the
+	// tokens read from or written to the prompt cache.
+	InputTokens int `json:"input_tokens"`
+
+	// OutputTokens is the number of tokens generated, including the
+	// reasoning tokens.
+	OutputTokens int `json:"output_tokens"`
+
+	// CacheReadTokens is the number of input tokens read from the prompt
+	// cache.
+	CacheReadTokens int `json:"cache_read_tokens,omitempty"`
+
+	// CacheWriteTokens is the number of input tokens written to the prompt
+	// cache.
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+
+	// ReasoningTokens is the number of output tokens spent reasoning
+	// before answering.
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+}
+
+// Add adds the tokens of v to u.
+func (u *Usage) Add(v Usage) {
+	u.InputTokens += v.InputTokens
+	u.OutputTokens += v.OutputTokens
+	u.CacheReadTokens += v.CacheReadTokens
+	u.CacheWriteTokens += v.CacheWriteTokens
+	u.ReasoningTokens += v.ReasoningTokens
+}
+
+// Total returns the number of input and output tokens.
+func (u Usage) Total() int {
+	return u.InputTokens + u.OutputTokens
+}
+
+// UsageReporter is implemented by messages reporting more than the input
+// and output tokens returned by Message.StatUsage.
+type UsageReporter interface {
+	Usage() Usage
+}
+
+// UsageOf returns the token usage of msg.
+func UsageOf(msg Message) Usage {
+	if r, ok := msg.(UsageReporter); ok {
+		return r.Usage()
+	}
+	input, output := msg.StatUsage()
+	return Usage{InputTokens: input, OutputTokens: output}
+}
@@ -0,0 +1,275 @@
+// Package usage accounts for the tokens used by LLM requests: a Tracker
+// sums them by session, provider and model, prices them and enforces
+// budgets.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+// ErrBudgetExceeded is wrapped by the errors of requests exceeding a
+// budget.
+var ErrBudgetExceeded = errors.New("usage budget exceeded")
+
+// Price is the price of a model in dollars per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+
+	// CacheRead and CacheWrite are the prices of the input tokens read from
+	// and written to the prompt cache. If zero, Input is used.
+	CacheRead  float64 `json:"cache_read,omitempty"`
+	CacheWrite float64 `json:"cache_write,omitempty"`
+}
+
+// Cost returns the price of u.
+func (p Price) Cost(u llm.Usage) float64 {
+	cacheRead, cacheWrite := p.CacheRead, p.CacheWrite
+	if cacheRead == 0 {
+		cacheRead = p.Input
+	}
+	if cacheWrite == 0 {
+		cacheWrite = p.Input
+	}
+	input := u.InputTokens - u.CacheReadTokens - u.CacheWriteTokens
+	cost := float64(input)*p.Input + float64(u.CacheReadTokens)*cacheRead +
+		float64(u.CacheWriteTokens)*cacheWrite + float64(u.OutputTokens)*p.Output
+	return cost / 1e6
+}
+
+// Prices is a price table by model name prefix. The longest matching prefix
+// applies.
+type Prices map[string]Price
+
+// Lookup returns the price of model.
+func (ps Prices) Lookup(model string) (Price, bool) {
+	best, found := "", false
+	for prefix := range ps {
+		if strings.HasPrefix(model, prefix) && (!found || len(prefix) > len(best)) {
+			best, found = prefix, true
+		}
+	}
+	return ps[best], found
+}
+
+// Budget limits the usage. Zero values mean no limit.
+type Budget struct {
+	// Tokens is the maximum number of input and output tokens.
+	Tokens int `json:"tokens,omitempty"`
+
+	// Cost is the maximum cost in dollars.
+	Cost float64 `json:"cost,omitempty"`
+}
+
+func (b *Budget) check(what string, t *Total) error {
+	if b.Tokens > 0 && t.Total() >= b.Tokens {
+		return fmt.Errorf("%w: %s used %d tokens of %d", ErrBudgetExceeded, what, t.Total(), b.Tokens)
+	}
+	if b.Cost > 0 && t.Cost >= b.Cost {
+		return fmt.Errorf("%w: %s cost $%.4f of $%.4f", ErrBudgetExceeded, what, t.Cost, b.Cost)
+	}
+	return nil
+}
+
+// Key identifies what the usage is accounted for.
+type Key struct {
+	Session  string `json:"session,omitempty"`
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`
+}
+
+// Total is the accumulated usage of a Key.
+type Total struct {
+	llm.Usage
+	Requests int     `json:"requests"`
+	Cost     float64 `json:"cost"` // of the requests with a known price
+}
+
+func (t *Total) add(u llm.Usage, cost float64) {
+	t.Usage.Add(u)
+	t.Requests++
+	t.Cost += cost
+}
+
+// Entry is the record of a response written to the Log of a Tracker.
+type Entry struct {
+	Time time.Time `json:"time"`
+	Key
+	llm.Usage
+	Cost float64 `json:"cost,omitempty"`
+}
+
+// Tracker accumulates the usage of responses. It is safe for concurrent
+// use.
+type Tracker struct {
+	// Prices is the price table. The cost of models without a price is 0.
+	Prices Prices `json:"prices,omitempty"`
+
+	// Session limits the usage of each session.
+	Session Budget `json:"session,omitempty"`
+
+	// Budget limits the usage of all sessions together.
+	Budget Budget `json:"budget,omitempty"`
+
+	// Log is called with the entry of every response if not nil.
+	Log func(e *Entry) `json:"-"`
+
+	mu     sync.Mutex
+	totals map[Key]*Total
+}
+
+// Add accounts for the usage u of a request of key and returns its cost.
+func (t *Tracker) Add(key Key, u llm.Usage) float64 {
+	var cost float64
+	if p, ok := t.Prices.Lookup(key.Model); ok {
+		cost = p.Cost(u)
+	}
+	t.add(key, u, cost)
+	if t.Log != nil {
+		t.Log(&Entry{Time: time.Now(), Key: key, Usage: u, Cost: cost})
+	}
+	return cost
+}
+
+func (t *Tracker) add(key Key, u llm.Usage, cost float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.totals == nil {
+		t.totals = make(map[Key]*Total)
+	}
+	total := t.totals[key]
+	if total == nil {
+		total = new(Total)
+		t.totals[key] = total
+	}
+	total.add(u, cost)
+}
+
+// Sum returns the total usage of the keys for which match returns true, or
+// of all keys if match is nil.
+func (t *Tracker) Sum(match func(key Key) bool) Total {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ret Total
+	for key, total := range t.totals {
+		if match == nil || match(key) {
+			ret.Usage.Add(total.Usage)
+			ret.Requests += total.Requests
+			ret.Cost += total.Cost
+		}
+	}
+	return ret
+}
+
+// Totals returns the usage of each key.
+func (t *Tracker) Totals() map[Key]Total {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ret := make(map[Key]Total, len(t.totals))
+	for key, total := range t.totals {
+		ret[key] = *total
+	}
+	return ret
+}
+
+// Keys returns the keys with usage, sorted by session, provider and model.
+func (t *Tracker) Keys() []Key {
+	t.mu.Lock()
+	keys := make([]Key, 0, len(t.totals))
+	for key := range t.totals {
+		keys = append(keys, key)
+	}
+	t.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Session != b.Session {
+			return a.Session < b.Session
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.Model < b.Model
+	})
+	return keys
+}
+
+// Check returns an error wrapping ErrBudgetExceeded if session or all
+// sessions together have used up their budget.
+func (t *Tracker) Check(session string) error {
+	all := t.Sum(nil)
+	if err := t.Budget.check("all sessions", &all); err != nil {
+		return err
+	}
+	s := t.Sum(func(key Key) bool { return key.Session == session })
+	return t.Session.check("the session", &s)
+}
+
+// Reset forgets the usage.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	t.totals = nil
+	t.mu.Unlock()
+}
+
+// Meter returns the meter accounting for the responses of key, to be set
+// as the Meter of an agent.Runner.
+func (t *Tracker) Meter(key Key) *Meter {
+	return &Meter{t: t, key: key}
+}
+
+// Meter accounts for the responses of a session with a model.
+type Meter struct {
+	t   *Tracker
+	key Key
+}
+
+// Allow returns an error wrapping ErrBudgetExceeded if the budget is used
+// up.
+func (m *Meter) Allow() error {
+	return m.t.Check(m.key.Session)
+}
+
+// Record accounts for the usage of msg. It returns an error wrapping
+// ErrBudgetExceeded if the budget is used up afterwards.
+func (m *Meter) Record(msg llm.Message) error {
+	m.t.Add(m.key, llm.UsageOf(msg))
+	return m.Allow()
+}
+
+// JSONLog returns a Log function writing the entries to w as JSON lines.
+func JSONLog(w io.Writer) func(e *Entry) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e *Entry) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(e)
+	}
+}
+
+// Replay adds the usage of the entries written by JSONLog to r since the
+// given time. The costs recorded are kept even if the prices changed.
+func (t *Tracker) Replay(r io.Reader, since time.Time) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // a line cut by a crash
+		}
+		if !e.Time.Before(since) {
+			t.add(e.Key, e.Usage, e.Cost)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,217 @@
+package usage
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-12
+}
+
+func TestPriceCost(t *testing.T) {
+	tests := []struct {
+		price Price
+		usage llm.Usage
+		want  float64
+	}{
+		{Price{Input: 3, Output: 15}, llm.Usage{InputTokens: 1e6, OutputTokens: 1e6}, 18},
+		{Price{Input: 3, Output: 15}, llm.Usage{InputTokens: 1000, OutputTokens: 200}, 0.006},
+		// Cached tokens are priced at the input price by default.
+		{Price{Input: 3, Output: 15}, llm.Usage{InputTokens: 1000, CacheReadTokens: 400, CacheWriteTokens: 100}, 0.003},
+		{
+			Price{Input: 3, Output: 15, CacheRead: 0.3, CacheWrite: 3.75},
+			llm.Usage{InputTokens: 1000, OutputTokens: 200, CacheReadTokens: 400, CacheWriteTokens: 100},
+			(500*3 + 400*0.3 + 100*3.75 + 200*15) / 1e6,
+		},
+		{Price{}, llm.Usage{InputTokens: 1000, OutputTokens: 200}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.price.Cost(tt.usage); !near(got, tt.want) {
+			t.Errorf("%+v.Cost(%+v) = %v, want %v", tt.price, tt.usage, got, tt.want)
+		}
+	}
+}
+
+func TestPricesLookup(t *testing.T) {
+	ps := Prices{
+		"gpt-4o":      {Input: 2.5},
+		"gpt-4o-mini": {Input: 0.15},
+		"claude":      {Input: 3},
+	}
+	tests := []struct {
+		model string
+		want  float64 // input price, or -1 if none
+	}{
+		{"gpt-4o", 2.5},
+		{"gpt-4o-2024-08-06", 2.5},
+		{"gpt-4o-mini-2024-07-18", 0.15},
+		{"claude-3-5-sonnet-latest", 3},
+		{"gpt-4", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		got := -1.0
+		if p, ok := ps.Lookup(tt.model); ok {
+			got = p.Input
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	var entries []*Entry
+	tr := &Tracker{
+		Prices: Prices{"m": {Input: 1, Output: 2}},
+		Log:    func(e *Entry) { entries = append(entries, e) },
+	}
+	a := Key{Session: "a", Provider: "p", Model: "m"}
+	b := Key{Session: "b", Provider: "p", Model: "m"}
+	free := Key{Session: "a", Provider: "p", Model: "free"}
+	u := llm.Usage{InputTokens: 1e6, OutputTokens: 5e5}
+	if cost := tr.Add(a, u); !near(cost, 2) {
+		t.Errorf("Add = %v, want 2", cost)
+	}
+	tr.Add(a, u)
+	tr.Add(b, u)
+	if cost := tr.Add(free, u); cost != 0 {
+		t.Errorf("Add without price = %v, want 0", cost)
+	}
+
+	totals := tr.Totals()
+	if got := totals[a]; got.Requests != 2 || got.InputTokens != 2e6 || got.OutputTokens != 1e6 || !near(got.Cost, 4) {
+		t.Errorf("total of a = %+v", got)
+	}
+	all := tr.Sum(nil)
+	if all.Requests != 4 || all.Total() != 6e6 || !near(all.Cost, 6) {
+		t.Errorf("Sum(nil) = %+v", all)
+	}
+	s := tr.Sum(func(key Key) bool { return key.Session == "a" })
+	if s.Requests != 3 || !near(s.Cost, 4) {
+		t.Errorf("Sum of session a = %+v", s)
+	}
+	if keys := tr.Keys(); len(keys) != 3 || keys[0] != free || keys[1] != a || keys[2] != b {
+		t.Errorf("Keys = %v", keys)
+	}
+	if len(entries) != 4 || entries[0].Key != a || !near(entries[0].Cost, 2) || entries[3].Cost != 0 {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	tr.Reset()
+	if all = tr.Sum(nil); all.Requests != 0 || len(tr.Keys()) != 0 {
+		t.Errorf("Sum after Reset = %+v", all)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		session Budget
+		budget  Budget
+		want    string // error checking session a, or ""
+	}{
+		{"no limit", Budget{}, Budget{}, ""},
+		{"session tokens", Budget{Tokens: 300}, Budget{}, "the session used 300 tokens of 300"},
+		{"session tokens left", Budget{Tokens: 301}, Budget{}, ""},
+		{"session cost", Budget{Cost: 0.0002}, Budget{}, "the session cost $0.0003 of $0.0002"},
+		{"all tokens", Budget{Tokens: 1000}, Budget{Tokens: 500}, "all sessions used 500 tokens of 500"},
+		{"all cost", Budget{}, Budget{Cost: 0.0004}, "all sessions cost $0.0005 of $0.0004"},
+		{"all left", Budget{}, Budget{Tokens: 501, Cost: 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &Tracker{Prices: Prices{"m": {Input: 1, Output: 1}}, Session: tt.session, Budget: tt.budget}
+			tr.Add(Key{Session: "a", Provider: "p", Model: "m"}, llm.Usage{InputTokens: 200, OutputTokens: 100})
+			tr.Add(Key{Session: "b", Provider: "p", Model: "m"}, llm.Usage{InputTokens: 200})
+			err := tr.Check("a")
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Check: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrBudgetExceeded) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Check: err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+type usageMessage struct {
+	llm.Message
+	usage llm.Usage
+}
+
+func (m *usageMessage) Usage() llm.Usage { return m.usage }
+
+func TestMeter(t *testing.T) {
+	tr := &Tracker{Session: Budget{Tokens: 250}}
+	m := tr.Meter(Key{Session: "s", Provider: "p"})
+	if err := m.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	msg := &usageMessage{usage: llm.Usage{InputTokens: 100, OutputTokens: 50, CacheReadTokens: 80}}
+	if err := m.Record(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Record(msg); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Record over budget: err = %v", err)
+	}
+	if err := m.Allow(); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Allow over budget: err = %v", err)
+	}
+	if got := tr.Sum(nil); got.Requests != 2 || got.CacheReadTokens != 160 {
+		t.Errorf("Sum = %+v", got)
+	}
+	// Other sessions have their own budget.
+	if err := tr.Meter(Key{Session: "other", Provider: "p"}).Allow(); err != nil {
+		t.Errorf("Allow of another session: %v", err)
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	tr := new(Tracker)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tr.Add(Key{Provider: "p"}, llm.Usage{InputTokens: 1})
+			}
+		}()
+	}
+	wg.Wait()
+	if got := tr.Sum(nil); got.Requests != 800 || got.InputTokens != 800 {
+		t.Errorf("Sum = %+v", got)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	tr := &Tracker{Prices: Prices{"m": {Input: 1}}, Log: JSONLog(&buf)}
+	key := Key{Session: "s", Provider: "p", Model: "m"}
+	tr.Add(key, llm.Usage{InputTokens: 1e6})
+	since := time.Now()
+	time.Sleep(time.Millisecond)
+	tr.Add(key, llm.Usage{InputTokens: 2e6})
+	buf.WriteString(`{"time": "2030-01-0`) // cut by a crash
+
+	// Costs are replayed as logged, whatever the current prices.
+	replayed := &Tracker{Prices: Prices{"m": {Input: 100}}}
+	if err := replayed.Replay(&buf, since); err != nil {
+		t.Fatal(err)
+	}
+	if got := replayed.Totals()[key]; got.Requests != 1 || got.InputTokens != 2e6 || !near(got.Cost, 2) {
+		t.Errorf("replayed = %+v", got)
+	}
+}
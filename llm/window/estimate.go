@@ -0,0 +1,108 @@
+package window
+
+import (
+	"encoding/json"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+const (
+	messageOverhead = 4  // role and delimiters of a message
+	toolOverhead    = 10 // framing of a tool definition or call
+)
+
+// Estimator estimates the number of tokens of messages.
+type Estimator interface {
+	// Tokens returns the estimated number of tokens of messages.
+	Tokens(messages []llm.Message) int
+
+	// ToolTokens returns the estimated number of tokens of tool
+	// definitions.
+	ToolTokens(tools []llm.Tool) int
+}
+
+// Heuristic estimates the number of tokens from the text of the messages:
+// about four ASCII characters per token and one token per CJK character.
+// When the messages contain the token counts reported by the provider, the
+// estimate is raised to match them.
+type Heuristic struct{}
+
+// Tokens implements Estimator.
+func (Heuristic) Tokens(messages []llm.Message) int {
+	n := 0
+	for _, msg := range messages {
+		n += MessageTokens(msg)
+	}
+
+	// The input and output counts of the last response cover the whole
+	// request up to it; scale the estimate by their ratio. The counts
+	// include the system prompt and tools, and the request may have been
+	// truncated, so the estimate is only ever scaled up.
+	for i := len(messages) - 1; i >= 0; i-- {
+		in, out := messages[i].StatUsage()
+		if in+out == 0 {
+			continue
+		}
+		known := 0
+		for _, msg := range messages[:i+1] {
+			known += MessageTokens(msg)
+		}
+		if known == 0 {
+			break
+		}
+		ratio := float64(in+out) / float64(known)
+		if ratio < 1 {
+			break
+		} else if ratio > 2 {
+			ratio = 2
+		}
+		return int(float64(n)*ratio + 0.5)
+	}
+	return n
+}
+
+// ToolTokens implements Estimator.
+func (Heuristic) ToolTokens(tools []llm.Tool) int {
+	n := 0
+	for _, t := range tools {
+		schema, _ := json.Marshal(t.InputSchema)
+		n += toolOverhead + TextTokens(t.Name) + TextTokens(t.Description) + TextTokens(string(schema))
+	}
+	return n
+}
+
+// MessageTokens returns the heuristic number of tokens of msg.
+func MessageTokens(msg llm.Message) int {
+	n := messageOverhead + TextTokens(msg.Content())
+	for _, call := range msg.ToolCalls() {
+		args, _ := json.Marshal(call.Arguments())
+		n += toolOverhead + TextTokens(call.Name()) + TextTokens(string(args))
+	}
+	if llm.IsToolResponse(msg) && msg.Content() == "" {
+		// The result is not exposed as text, count its encoding.
+		if b, err := json.Marshal(msg); err == nil {
+			n += TextTokens(string(b))
+		}
+	}
+	return n
+}
+
+// TextTokens returns the heuristic number of tokens of s.
+func TextTokens(s string) int {
+	ascii, wide := 0, 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		switch {
+		case r < utf8.RuneSelf:
+			ascii++
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			wide++
+		default:
+			ascii += 2 // other scripts take more tokens per character
+		}
+	}
+	return (ascii+3)/4 + wide
+}
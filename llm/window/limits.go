@@ -0,0 +1,89 @@
+package window
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultLimit is the context window assumed for unknown models.
+const DefaultLimit = 8192
+
+var (
+	limitsMu sync.RWMutex
+	limits   = map[string]int{
+		// Anthropic
+		"claude-":    200000,
+		"claude-2.0": 100000,
+
+		// OpenAI
+		"gpt-4o":        128000,
+		"gpt-4.1":       1047576,
+		"gpt-4-turbo":   128000,
+		"gpt-4-":        128000, // previews
+		"gpt-4":         8192,
+		"gpt-4-32k":     32768,
+		"gpt-3.5-turbo": 16385,
+		"o1":            200000,
+		"o1-mini":       128000,
+		"o3":            200000,
+		"o4-mini":       200000,
+
+		// Google
+		"gemini-1.5-pro": 2097152,
+		"gemini-1.5-":    1048576,
+		"gemini-2.":      1048576,
+		"gemini-1.0-pro": 32760,
+
+		// Open models, usually served by ollama
+		"llama3.1":      131072,
+		"llama3.2":      131072,
+		"llama3.3":      131072,
+		"llama3":        8192,
+		"qwen2.5":       32768,
+		"qwen3":         40960,
+		"mistral":       32768,
+		"deepseek-":     65536,
+		"deepseek-r1":   131072,
+		"gemma2":        8192,
+		"gemma3":        131072,
+		"phi4":          16384,
+		"codellama":     16384,
+		"qwen2.5-coder": 32768,
+	}
+)
+
+// SetLimit sets the context window in tokens of the models whose names
+// start with prefix. The longest matching prefix applies.
+func SetLimit(prefix string, tokens int) {
+	limitsMu.Lock()
+	limits[prefix] = tokens
+	limitsMu.Unlock()
+}
+
+// Limit returns the context window in tokens of model, or DefaultLimit if
+// the model is unknown. Tags such as in "qwen2.5:7b" and provider prefixes
+// such as in "models/gemini-2.0-flash" are ignored.
+func Limit(model string) int {
+	if i := strings.LastIndexByte(model, '/'); i >= 0 {
+		model = model[i+1:]
+	}
+	model, _, _ = strings.Cut(model, ":")
+	model = strings.ToLower(model)
+
+	limitsMu.RLock()
+	defer limitsMu.RUnlock()
+	prefixes := make([]string, 0, len(limits))
+	for prefix := range limits {
+		if strings.HasPrefix(model, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return DefaultLimit
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+	return limits[prefixes[0]]
+}
@@ -0,0 +1,229 @@
+package window
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/history"
+)
+
+// Strategy shortens a conversation that does not fit in the context window.
+type Strategy interface {
+	// Truncate returns messages shortened so that their estimated number of
+	// tokens is at most budget, if possible. System messages are kept, and
+	// a tool call is never separated from its response.
+	Truncate(ctx context.Context, messages []llm.Message, budget int, est Estimator) ([]llm.Message, error)
+}
+
+// A turn is a user message followed by the answers of the assistant and the
+// tool responses up to the next user message. Its messages after the first
+// form steps: an assistant message with the responses to its tool calls.
+type turn struct {
+	msgs  []llm.Message
+	steps [][]llm.Message
+}
+
+// split separates the system messages from the turns of a conversation.
+// Messages before the first user message form a turn of their own.
+func split(messages []llm.Message) (system []llm.Message, turns []*turn) {
+	var cur *turn
+	for _, msg := range messages {
+		switch {
+		case msg.Role() == "system":
+			system = append(system, msg)
+			continue
+		case cur == nil || msg.Role() == "user" && !llm.IsToolResponse(msg):
+			cur = &turn{msgs: []llm.Message{msg}}
+			turns = append(turns, cur)
+			continue
+		}
+		cur.msgs = append(cur.msgs, msg)
+		if n := len(cur.steps); n > 0 && llm.IsToolResponse(msg) {
+			cur.steps[n-1] = append(cur.steps[n-1], msg)
+		} else {
+			cur.steps = append(cur.steps, []llm.Message{msg})
+		}
+	}
+	return
+}
+
+func join(system []llm.Message, turns []*turn) []llm.Message {
+	ret := append([]llm.Message(nil), system...)
+	for _, t := range turns {
+		ret = append(ret, t.msgs...)
+	}
+	return ret
+}
+
+// DropOldest drops the oldest turns of the conversation until it fits. If
+// the last turn alone does not fit, its oldest steps are dropped too, but
+// its first message is kept.
+type DropOldest struct{}
+
+// Truncate implements Strategy.
+func (DropOldest) Truncate(ctx context.Context, messages []llm.Message, budget int, est Estimator) ([]llm.Message, error) {
+	system, turns := split(messages)
+	for len(turns) > 1 && est.Tokens(join(system, turns)) > budget {
+		turns = turns[1:]
+	}
+	ret := join(system, turns)
+	if len(turns) == 0 || est.Tokens(ret) <= budget {
+		return ret, nil
+	}
+
+	last := turns[0]
+	steps := last.steps
+	for len(steps) > 1 {
+		steps = steps[1:]
+		msgs := []llm.Message{last.msgs[0]}
+		for _, step := range steps {
+			msgs = append(msgs, step...)
+		}
+		ret = join(system, []*turn{{msgs: msgs}})
+		if est.Tokens(ret) <= budget {
+			break
+		}
+	}
+	return ret, nil
+}
+
+// KeepLastN keeps the system messages and the last N turns of the
+// conversation, dropping older ones even if they fit. If the result is
+// still too long, DropOldest applies.
+type KeepLastN struct {
+	N int
+}
+
+// Truncate implements Strategy.
+func (s KeepLastN) Truncate(ctx context.Context, messages []llm.Message, budget int, est Estimator) ([]llm.Message, error) {
+	system, turns := split(messages)
+	if n := s.N; n > 0 && len(turns) > n {
+		turns = turns[len(turns)-n:]
+	}
+	return DropOldest{}.Truncate(ctx, join(system, turns), budget, est)
+}
+
+// DefaultSummaryPrompt is the instruction given to the model summarizing
+// the older turns of a conversation.
+const DefaultSummaryPrompt = `Summarize the conversation below for an assistant who will continue it without seeing it. Keep the facts, decisions, file names, code identifiers and open questions; drop greetings and repetitions. Answer with the summary only.`
+
+// Summarize replaces the older turns of a conversation that does not fit by
+// a summary written by a model. The summary is inserted as a system
+// message after the other system messages. The summary is reused, and
+// extended, while the conversation grows, so a Summarize must not be
+// shared by several conversations at once.
+type Summarize struct {
+	// Provider writes the summaries.
+	Provider llm.Provider
+
+	// KeepLast is the number of last turns kept verbatim. If zero, the last
+	// two turns are kept. Fewer turns are kept if needed to fit.
+	KeepLast int
+
+	// Prompt is the instruction to summarize. If empty,
+	// DefaultSummaryPrompt is used.
+	Prompt string
+
+	// Options are passed to Provider.SendMessage.
+	Options []llm.Option
+
+	mu      sync.Mutex
+	n       int         // number of messages summarized
+	last    llm.Message // last message summarized
+	summary string
+}
+
+// Truncate implements Strategy.
+func (s *Summarize) Truncate(ctx context.Context, messages []llm.Message, budget int, est Estimator) ([]llm.Message, error) {
+	if est.Tokens(messages) <= budget {
+		return messages, nil
+	}
+	system, turns := split(messages)
+	keep := s.KeepLast
+	if keep <= 0 {
+		keep = 2
+	}
+	if keep > len(turns)-1 {
+		keep = len(turns) - 1
+	}
+	if keep < 1 { // nothing older than the last turn
+		return DropOldest{}.Truncate(ctx, messages, budget, est)
+	}
+
+	older := join(nil, turns[:len(turns)-keep])
+	summary, err := s.summarize(ctx, older)
+	if err != nil {
+		return nil, err
+	}
+	system = append(system, history.NewTextMessage("system", "Summary of the earlier conversation:\n"+summary))
+
+	turns = turns[len(turns)-keep:]
+	for len(turns) > 1 && est.Tokens(join(system, turns)) > budget {
+		turns = turns[1:]
+	}
+	return DropOldest{}.Truncate(ctx, join(system, turns), budget, est)
+}
+
+// summarize returns the summary of older, extending the previous summary
+// if older continues the conversation it summarized.
+func (s *Summarize) summarize(ctx context.Context, older []llm.Message) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start, prev := 0, ""
+	if s.n > 0 && s.n <= len(older) && sameMessage(older[s.n-1], s.last) {
+		if s.n == len(older) {
+			return s.summary, nil
+		}
+		start, prev = s.n, s.summary
+	}
+
+	var b strings.Builder
+	if prev != "" {
+		fmt.Fprintf(&b, "Summary of the conversation so far:\n%s\n\nContinuation:\n", prev)
+	}
+	for _, msg := range older[start:] {
+		writeTranscript(&b, msg)
+	}
+	prompt := s.Prompt
+	if prompt == "" {
+		prompt = DefaultSummaryPrompt
+	}
+	opts := append([]llm.Option{llm.WithSystem(prompt)}, s.Options...)
+	resp, err := s.Provider.SendMessage(ctx, b.String(), nil, nil, opts...)
+	if err != nil {
+		return "", fmt.Errorf("summarize conversation: %w", err)
+	}
+	s.n, s.last, s.summary = len(older), older[len(older)-1], strings.TrimSpace(resp.Content())
+	return s.summary, nil
+}
+
+func writeTranscript(b *strings.Builder, msg llm.Message) {
+	if llm.IsToolResponse(msg) {
+		text := msg.Content()
+		if text == "" {
+			data, _ := json.Marshal(msg)
+			text = string(data)
+		}
+		fmt.Fprintf(b, "[tool result] %s\n\n", text)
+		return
+	}
+	if text := msg.Content(); text != "" {
+		fmt.Fprintf(b, "[%s] %s\n\n", msg.Role(), text)
+	}
+	for _, call := range msg.ToolCalls() {
+		args, _ := json.Marshal(call.Arguments())
+		fmt.Fprintf(b, "[tool call] %s %s\n\n", call.Name(), args)
+	}
+}
+
+func sameMessage(a, b llm.Message) bool {
+	if a == nil || b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
@@ -0,0 +1,236 @@
+package window
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/goplus/xgowiz/llm"
+)
+
+type call struct{ id string }
+
+func (c *call) ID() string                { return c.id }
+func (c *call) Name() string              { return "tool" }
+func (c *call) Arguments() map[string]any { return nil }
+
+// msg is a message named by its text: u1 is a user message, a1 an
+// assistant message, "a1 c1 c2" one calling c1 and c2, t:c1 the response
+// to c1 and s a system message.
+type msg struct {
+	text  string
+	calls []llm.ToolCall
+}
+
+func (m *msg) Role() string {
+	switch m.text[0] {
+	case 'u', 't':
+		return "user"
+	case 's':
+		return "system"
+	}
+	return "assistant"
+}
+
+func (m *msg) Content() string              { return m.text }
+func (m *msg) ToolCalls() []llm.ToolCall    { return m.calls }
+func (m *msg) StatUsage() (int, int)        { return 0, 0 }
+func (m *msg) ToolResponse() (string, bool) { return strings.CutPrefix(m.text, "t:") }
+
+func conversation(texts ...string) []llm.Message {
+	ret := make([]llm.Message, len(texts))
+	for i, text := range texts {
+		fields := strings.Fields(text)
+		m := &msg{text: fields[0]}
+		for _, id := range fields[1:] {
+			m.calls = append(m.calls, &call{id})
+		}
+		ret[i] = m
+	}
+	return ret
+}
+
+func names(messages []llm.Message) string {
+	var s []string
+	for _, m := range messages {
+		s = append(s, m.Content())
+	}
+	return strings.Join(s, " ")
+}
+
+// checkPairs checks that the response to each tool call directly follows
+// the call or another response to the same message.
+func checkPairs(t *testing.T, messages []llm.Message) {
+	t.Helper()
+	var pending []string
+	for _, m := range messages {
+		if id, ok := m.ToolResponse(); ok {
+			if len(pending) == 0 || pending[0] != id {
+				t.Errorf("%s: response %s does not follow its call", names(messages), id)
+				return
+			}
+			pending = pending[1:]
+			continue
+		}
+		if len(pending) > 0 {
+			t.Errorf("%s: calls %v are not followed by their responses", names(messages), pending)
+			return
+		}
+		for _, c := range m.ToolCalls() {
+			pending = append(pending, c.ID())
+		}
+	}
+}
+
+// count estimates one token per message.
+type count struct{}
+
+func (count) Tokens(messages []llm.Message) int { return len(messages) }
+func (count) ToolTokens(tools []llm.Tool) int   { return len(tools) }
+
+var testConversation = conversation(
+	"s",
+	"u1", "a1 c1", "t:c1", "a1",
+	"u2", "a2 c2 c3", "t:c2", "t:c3", "a3 c4", "t:c4", "a2",
+)
+
+func TestDropOldest(t *testing.T) {
+	tests := []struct {
+		budget int
+		want   string
+	}{
+		{20, "s u1 a1 t:c1 a1 u2 a2 t:c2 t:c3 a3 t:c4 a2"},
+		{8, "s u2 a2 t:c2 t:c3 a3 t:c4 a2"},
+		{6, "s u2 a3 t:c4 a2"},
+		{4, "s u2 a2"},
+		{1, "s u2 a2"}, // as short as possible
+	}
+	for _, tt := range tests {
+		got, err := DropOldest{}.Truncate(context.Background(), testConversation, tt.budget, count{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names(got) != tt.want {
+			t.Errorf("budget %d: %s, want %s", tt.budget, names(got), tt.want)
+		}
+		checkPairs(t, got)
+	}
+}
+
+func TestKeepLastN(t *testing.T) {
+	tests := []struct {
+		n, budget int
+		want      string
+	}{
+		{1, 20, "s u2 a2 t:c2 t:c3 a3 t:c4 a2"},
+		{2, 20, "s u1 a1 t:c1 a1 u2 a2 t:c2 t:c3 a3 t:c4 a2"},
+		{0, 20, "s u1 a1 t:c1 a1 u2 a2 t:c2 t:c3 a3 t:c4 a2"},
+		{1, 6, "s u2 a3 t:c4 a2"},
+	}
+	for _, tt := range tests {
+		got, err := KeepLastN{N: tt.n}.Truncate(context.Background(), testConversation, tt.budget, count{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names(got) != tt.want {
+			t.Errorf("N %d, budget %d: %s, want %s", tt.n, tt.budget, names(got), tt.want)
+		}
+		checkPairs(t, got)
+	}
+}
+
+// summarizer answers "summary N" to the Nth request and records the
+// prompts.
+type summarizer struct {
+	prompts []string
+}
+
+func (p *summarizer) SendMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool, opts ...llm.Option) (llm.Message, error) {
+	p.prompts = append(p.prompts, prompt)
+	return &msg{text: fmt.Sprint("summary ", len(p.prompts))}, nil
+}
+
+func (p *summarizer) CreateToolResponse(id string, content any) (llm.Message, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *summarizer) SupportsTools() bool { return false }
+func (p *summarizer) Name() string        { return "summarizer" }
+
+func TestSummarize(t *testing.T) {
+	p := new(summarizer)
+	s := &Summarize{Provider: p, KeepLast: 1}
+	ctx := context.Background()
+	messages := conversation("s", "u1", "a1", "u2", "a2 c1", "t:c1", "a2", "u3", "a3")
+
+	got, err := s.Truncate(ctx, messages, 5, count{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "s Summary of the earlier conversation:\nsummary 1 u3 a3"; names(got) != want {
+		t.Errorf("Truncate = %q, want %q", names(got), want)
+	}
+	want := "[user] u1\n\n[assistant] a1\n\n[user] u2\n\n[assistant] a2\n\n[tool call] tool null\n\n" +
+		"[tool result] t:c1\n\n[assistant] a2\n\n"
+	if len(p.prompts) != 1 || p.prompts[0] != want {
+		t.Errorf("prompts = %q, want %q", p.prompts, want)
+	}
+
+	// The same older turns reuse the summary.
+	if _, err = s.Truncate(ctx, messages, 5, count{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.prompts) != 1 {
+		t.Errorf("summary not reused: %d requests", len(p.prompts))
+	}
+
+	// A longer conversation extends it with the new older turn only.
+	messages = append(messages, conversation("u4", "a4")...)
+	got, err = s.Truncate(ctx, messages, 5, count{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "s Summary of the earlier conversation:\nsummary 2 u4 a4"; names(got) != want {
+		t.Errorf("Truncate = %q, want %q", names(got), want)
+	}
+	want = "Summary of the conversation so far:\nsummary 1\n\nContinuation:\n[user] u3\n\n[assistant] a3\n\n"
+	if len(p.prompts) != 2 || p.prompts[1] != want {
+		t.Errorf("prompt = %q, want %q", p.prompts[len(p.prompts)-1], want)
+	}
+
+	// Another conversation of the same length is summarized from scratch.
+	other := conversation("s", "u5", "a5", "u6", "a6", "u7", "a7", "u8", "a8", "u9", "a9")
+	if _, err = s.Truncate(ctx, other, 5, count{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.prompts) != 3 || !strings.HasPrefix(p.prompts[2], "[user] u5") {
+		t.Errorf("prompt = %q, want the whole older conversation", p.prompts[len(p.prompts)-1])
+	}
+
+	// Conversations that fit are not summarized.
+	if got, _ = s.Truncate(ctx, other, 20, count{}); len(got) != len(other) || len(p.prompts) != 3 {
+		t.Errorf("fitting conversation changed: %s", names(got))
+	}
+}
+
+func TestFit(t *testing.T) {
+	w := &Window{Limit: 12, Reserve: 2, Estimator: count{}}
+	tools := []llm.Tool{{Name: "a"}, {Name: "b"}}
+	if b := w.Budget(tools, nil); b != 8 {
+		t.Errorf("Budget = %d, want 8", b)
+	}
+	got, err := w.Fit(context.Background(), testConversation, tools, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "s u2 a2 t:c2 t:c3 a3 t:c4 a2"; names(got) != want {
+		t.Errorf("Fit = %s, want %s", names(got), want)
+	}
+
+	w.Limit = 5
+	if _, err = w.Fit(context.Background(), testConversation, tools, nil); !errors.Is(err, llm.ErrContextLength) {
+		t.Errorf("Fit in a too small window: err = %v, want ErrContextLength", err)
+	}
+}
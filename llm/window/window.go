@@ -0,0 +1,95 @@
+// Package window keeps conversations within the context window of a model:
+// it estimates the number of tokens of a request and, when it is too long,
+// shortens the conversation with a pluggable Strategy.
+package window
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goplus/xgowiz/llm"
+	"github.com/goplus/xgowiz/llm/history"
+)
+
+// DefaultReserve is the number of tokens kept for the response when the
+// request does not set a maximum.
+const DefaultReserve = 4096
+
+// Window is the context window of a model.
+type Window struct {
+	// Limit is the size of the context window in tokens. If zero,
+	// DefaultLimit is used.
+	Limit int
+
+	// Reserve is the number of tokens kept for the response. If zero, the
+	// maximum number of tokens of the request is used, or DefaultReserve,
+	// but at most a quarter of Limit.
+	Reserve int
+
+	// Estimator estimates the number of tokens. If nil, Heuristic is used.
+	Estimator Estimator
+
+	// Strategy shortens the conversations that do not fit. If nil,
+	// DropOldest is used.
+	Strategy Strategy
+}
+
+// New creates the Window of model.
+func New(model string) *Window {
+	return &Window{Limit: Limit(model)}
+}
+
+// Budget returns the number of tokens available to the messages of a
+// request with the given tools and options.
+func (w *Window) Budget(tools []llm.Tool, opts *llm.Options) int {
+	limit := w.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	reserve := w.Reserve
+	if reserve <= 0 {
+		reserve = DefaultReserve
+		if opts != nil && opts.MaxTokens > 0 {
+			reserve = opts.MaxTokens
+		}
+		if reserve > limit/4 {
+			reserve = limit / 4
+		}
+	}
+	est := w.estimator()
+	budget := limit - reserve - est.ToolTokens(tools)
+	if opts != nil && opts.System != "" {
+		budget -= est.Tokens([]llm.Message{history.NewTextMessage("system", opts.System)})
+	}
+	return budget
+}
+
+// Fit returns messages shortened to fit in the window together with tools
+// and the system prompt of opts. It returns messages unchanged if they fit.
+// The error wraps llm.ErrContextLength if they cannot be shortened enough.
+func (w *Window) Fit(ctx context.Context, messages []llm.Message, tools []llm.Tool, opts *llm.Options) ([]llm.Message, error) {
+	est := w.estimator()
+	budget := w.Budget(tools, opts)
+	if est.Tokens(messages) <= budget {
+		return messages, nil
+	}
+	strategy := w.Strategy
+	if strategy == nil {
+		strategy = DropOldest{}
+	}
+	ret, err := strategy.Truncate(ctx, messages, budget, est)
+	if err != nil {
+		return nil, err
+	}
+	if n := est.Tokens(ret); n > budget {
+		return nil, fmt.Errorf("%w: about %d tokens for a budget of %d", llm.ErrContextLength, n, budget)
+	}
+	return ret, nil
+}
+
+func (w *Window) estimator() Estimator {
+	if w.Estimator != nil {
+		return w.Estimator
+	}
+	return Heuristic{}
+}
@@ -0,0 +1,327 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FilePatch is the change of one file in a unified diff.
+type FilePatch struct {
+	OldPath string // empty for a new file
+	NewPath string // empty for a deleted file
+	Hunks   []*Hunk
+}
+
+// Hunk is a group of changed lines. Lines are prefixed by ' ', '-' or '+'
+// and include their line ending.
+type Hunk struct {
+	OldStart int
+	Lines    []string
+}
+
+// PatchResult describes the change of a file applied by ApplyPatch.
+type PatchResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"` // modified, created or deleted
+}
+
+// ParsePatch parses a unified diff, as produced by diff -u or git diff.
+func ParsePatch(patch string) ([]*FilePatch, error) {
+	lines := strings.SplitAfter(patch, "\n")
+	var files []*FilePatch
+	var fp *FilePatch
+	var hunk *Hunk
+	oldLeft, newLeft := 0, 0
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			switch {
+			case line == "":
+				// the patch ended, checked below
+			case strings.HasPrefix(line, `\`): // \ No newline at end of file
+				markNoNewline(hunk)
+				continue
+			case line[0] == ' ' || line == "\n" || line == "\r\n":
+				if line[0] != ' ' { // empty context line whose space was stripped
+					line = " " + line
+				}
+				oldLeft--
+				newLeft--
+			case line[0] == '-':
+				oldLeft--
+			case line[0] == '+':
+				newLeft--
+			default:
+				return nil, fmt.Errorf("patch: line %d: unexpected %q in hunk", i+1, strings.TrimRight(line, "\r\n"))
+			}
+			if line != "" {
+				hunk.Lines = append(hunk.Lines, line)
+				continue
+			}
+		}
+		if hunk != nil && (oldLeft != 0 || newLeft != 0) {
+			return nil, fmt.Errorf("patch: line %d: hunk is truncated", i+1)
+		}
+		switch {
+		case strings.HasPrefix(line, `\`):
+			markNoNewline(hunk)
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			fp = &FilePatch{OldPath: patchPath(line[4:]), NewPath: patchPath(lines[i+1][4:])}
+			files = append(files, fp)
+			hunk = nil
+			i++
+		case strings.HasPrefix(line, "@@ "):
+			if fp == nil {
+				return nil, fmt.Errorf("patch: line %d: hunk without file header", i+1)
+			}
+			var err error
+			hunk = new(Hunk)
+			if hunk.OldStart, oldLeft, newLeft, err = parseHunkHeader(line); err != nil {
+				return nil, fmt.Errorf("patch: line %d: %v", i+1, err)
+			}
+			fp.Hunks = append(fp.Hunks, hunk)
+		default:
+			// other lines such as "diff --git" and "index" are ignored
+			hunk = nil
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("patch: no file changes found, a unified diff is expected")
+	}
+	return files, nil
+}
+
+// markNoNewline removes the line ending of the last line of hunk.
+func markNoNewline(hunk *Hunk) {
+	if hunk == nil || len(hunk.Lines) == 0 {
+		return
+	}
+	last := &hunk.Lines[len(hunk.Lines)-1]
+	*last = strings.TrimSuffix(strings.TrimSuffix(*last, "\n"), "\r")
+}
+
+// patchPath returns the path of a --- or +++ line without its a/ or b/
+// prefix and timestamp, or an empty string for /dev/null.
+func patchPath(s string) string {
+	s = strings.TrimRight(s, "\r\n")
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+// parseHunkHeader parses "@@ -l,s +l,s @@".
+func parseHunkHeader(line string) (oldStart, oldLines, newLines int, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[3] != "@@" || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("invalid hunk header %q", strings.TrimSpace(line))
+	}
+	parse := func(r string) (start, n int, err error) {
+		s, c, found := strings.Cut(r, ",")
+		n = 1
+		if found {
+			if n, err = strconv.Atoi(c); err != nil {
+				return
+			}
+		}
+		start, err = strconv.Atoi(s)
+		return
+	}
+	if oldStart, oldLines, err = parse(fields[1][1:]); err != nil {
+		return
+	}
+	_, newLines, err = parse(fields[2][1:])
+	return
+}
+
+// ApplyPatch applies a unified diff to the files of the workspace. Hunks
+// whose lines moved are located by their context. Either all changes are
+// applied or none.
+func (w *Workspace) ApplyPatch(patch string) ([]PatchResult, error) {
+	files, err := ParsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	type change struct {
+		abs     string
+		content []byte // nil to delete
+		result  PatchResult
+	}
+	var changes []change
+	for _, fp := range files {
+		var c change
+		switch {
+		case fp.OldPath == "" && fp.NewPath == "":
+			return nil, errors.New("patch: file without path")
+		case fp.OldPath == "":
+			c.result = PatchResult{Path: fp.NewPath, Status: "created"}
+		case fp.NewPath == "":
+			c.result = PatchResult{Path: fp.OldPath, Status: "deleted"}
+		default:
+			if fp.OldPath != fp.NewPath {
+				return nil, fmt.Errorf("patch: renaming %s to %s is not supported", fp.OldPath, fp.NewPath)
+			}
+			c.result = PatchResult{Path: fp.NewPath, Status: "modified"}
+		}
+		if c.abs, err = w.Resolve(c.result.Path); err != nil {
+			return nil, err
+		}
+
+		var old []string
+		if c.result.Status == "created" {
+			if _, err := os.Lstat(c.abs); err == nil {
+				return nil, fmt.Errorf("patch: %s already exists", c.result.Path)
+			}
+		} else {
+			data, err := w.readFile(c.abs)
+			if err != nil {
+				return nil, err
+			}
+			old = splitLines(string(data))
+		}
+		lines, err := applyHunks(old, fp.Hunks)
+		if err != nil {
+			return nil, fmt.Errorf("patch: %s: %v", c.result.Path, err)
+		}
+		if c.result.Status == "deleted" {
+			if len(lines) > 0 {
+				return nil, fmt.Errorf("patch: %s: deletion does not remove all lines", c.result.Path)
+			}
+		} else {
+			c.content = []byte(strings.Join(lines, ""))
+			if int64(len(c.content)) > w.maxFileSize() {
+				return nil, fmt.Errorf("patch: %s would be too large", c.result.Path)
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	results := make([]PatchResult, 0, len(changes))
+	for _, c := range changes {
+		if c.content == nil {
+			err = os.Remove(c.abs)
+		} else {
+			if err = os.MkdirAll(filepath.Dir(c.abs), 0o755); err == nil {
+				err = writeFile(c.abs, c.content)
+			}
+		}
+		if err != nil {
+			return results, err
+		}
+		results = append(results, c.result)
+	}
+	return results, nil
+}
+
+// writeFile replaces the content of the file at abs, keeping its mode.
+func writeFile(abs string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(abs); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(abs), ".patch-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), abs)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// applyHunks applies hunks to lines. Each hunk is searched at its line
+// first, then at the nearest position where its old lines match.
+func applyHunks(lines []string, hunks []*Hunk) ([]string, error) {
+	var out []string
+	pos := 0 // lines before pos are done
+	for i, h := range hunks {
+		var old, repl []string
+		for _, l := range h.Lines {
+			switch l[0] {
+			case ' ':
+				old = append(old, l[1:])
+				repl = append(repl, l[1:])
+			case '-':
+				old = append(old, l[1:])
+			case '+':
+				repl = append(repl, l[1:])
+			}
+		}
+		hint := h.OldStart - 1
+		if len(old) == 0 { // lines are inserted after line OldStart
+			hint = h.OldStart
+		}
+		at := findLines(lines, old, pos, hint)
+		if at < 0 {
+			return nil, fmt.Errorf("hunk %d (line %d) does not match the file", i+1, h.OldStart)
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, repl...)
+		pos = at + len(old)
+	}
+	return append(out, lines[pos:]...), nil
+}
+
+// findLines returns the index not before min where lines contains old,
+// the closest to hint, or -1. Line endings are ignored, so that CRLF files
+// and missing final newlines do not prevent a match.
+func findLines(lines, old []string, min, hint int) int {
+	match := func(at int) bool {
+		if at < min || at+len(old) > len(lines) {
+			return false
+		}
+		for j, l := range old {
+			if got := lines[at+j]; got != l && strings.TrimRight(got, "\r\n") != strings.TrimRight(l, "\r\n") {
+				return false
+			}
+		}
+		return true
+	}
+	if len(old) == 0 { // pure insertion
+		if hint < min {
+			hint = min
+		}
+		if hint > len(lines) {
+			hint = len(lines)
+		}
+		return hint
+	}
+	for d := 0; d <= len(lines); d++ {
+		if match(hint - d) {
+			return hint - d
+		}
+		if match(hint + d) {
+			return hint + d
+		}
+	}
+	return -1
+}
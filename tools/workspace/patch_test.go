@@ -0,0 +1,205 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const mainXgo = `import "fmt"
+
+func greet(name string) {
+	fmt.Println("hello", name)
+}
+
+greet "world"
+`
+
+func readAll(t *testing.T, w *Workspace, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(w.Root(), filepath.FromSlash(rel)))
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return string(data)
+}
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string // content of main.xgo
+		patch string
+		want  string
+	}{
+		{
+			name: "exact",
+			file: mainXgo,
+			patch: `--- a/main.xgo
++++ b/main.xgo
+@@ -3,3 +3,3 @@
+ func greet(name string) {
+-	fmt.Println("hello", name)
++	fmt.Println("hi", name)
+ }
+`,
+			want: strings.Replace(mainXgo, `"hello"`, `"hi"`, 1),
+		},
+		{
+			name: "moved",
+			file: "// header\n// more\n" + mainXgo,
+			patch: `--- a/main.xgo
++++ b/main.xgo
+@@ -3,3 +3,3 @@
+ func greet(name string) {
+-	fmt.Println("hello", name)
++	fmt.Println("hi", name)
+ }
+@@ -7,1 +7,1 @@
+-greet "world"
++greet "xgo"
+`,
+			want: "// header\n// more\n" + strings.NewReplacer(`"hello"`, `"hi"`, `"world"`, `"xgo"`).Replace(mainXgo),
+		},
+		{
+			name: "crlf",
+			file: strings.ReplaceAll(mainXgo, "\n", "\r\n"),
+			patch: `--- a/main.xgo
++++ b/main.xgo
+@@ -7 +7 @@
+-greet "world"
++greet "xgo"
+`,
+			want: strings.ReplaceAll(mainXgo[:len(mainXgo)-len("greet \"world\"\n")], "\n", "\r\n") + "greet \"xgo\"\n",
+		},
+		{
+			name: "insert and no final newline",
+			file: "a\nb",
+			patch: `--- a/main.xgo
++++ b/main.xgo
+@@ -1,2 +1,3 @@
+ a
++x
+ b
+\ No newline at end of file
+`,
+			want: "a\nx\nb",
+		},
+		{
+			name:  "stripped empty context line",
+			file:  "a\n\nb\n",
+			patch: "--- a/main.xgo\n+++ b/main.xgo\n@@ -1,3 +1,3 @@\n a\n\n-b\n+c\n",
+			want:  "a\n\nc\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _ := newTestWorkspace(t, map[string]string{"main.xgo": tt.file})
+			res, err := w.ApplyPatch(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != 1 || res[0] != (PatchResult{Path: "main.xgo", Status: "modified"}) {
+				t.Errorf("results = %+v", res)
+			}
+			if got := readAll(t, w, "main.xgo"); got != tt.want {
+				t.Errorf("main.xgo =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPatchCreateDelete(t *testing.T) {
+	w, _ := newTestWorkspace(t, map[string]string{"old.xgo": "a\nb\n"})
+	patch := `diff --git a/old.xgo b/old.xgo
+--- a/old.xgo
++++ /dev/null
+@@ -1,2 +0,0 @@
+-a
+-b
+--- /dev/null
++++ b/pkg/new.xgo
+@@ -0,0 +1,2 @@
++package pkg
++
+`
+	res, err := w.ApplyPatch(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PatchResult{{"old.xgo", "deleted"}, {"pkg/new.xgo", "created"}}
+	if len(res) != 2 || res[0] != want[0] || res[1] != want[1] {
+		t.Errorf("results = %+v, want %+v", res, want)
+	}
+	if _, err := os.Stat(filepath.Join(w.Root(), "old.xgo")); !os.IsNotExist(err) {
+		t.Errorf("old.xgo not deleted: %v", err)
+	}
+	if got := readAll(t, w, "pkg/new.xgo"); got != "package pkg\n\n" {
+		t.Errorf("pkg/new.xgo = %q", got)
+	}
+}
+
+func TestParsePatchErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"not a diff", "just text\n", "no file changes found"},
+		{"no header", "@@ -1 +1 @@\n-a\n+b\n", "line 1: hunk without file header"},
+		{"bad header", "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1\n", "line 3: invalid hunk header"},
+		{"bad line count", "--- a/a.txt\n+++ b/a.txt\n@@ -1,x +1 @@\n", "line 3: strconv.Atoi"},
+		{"unexpected line", "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n*a\n", `line 4: unexpected "*a" in hunk`},
+		{"truncated", "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n-a\n+b\n", "hunk is truncated"},
+	}
+	for _, tt := range tests {
+		if _, err := ParsePatch(tt.patch); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	const hunk = "@@ -1 +1 @@\n-a\n+b\n"
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"no match", "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-z\n+b\n", "hunk 1 (line 1) does not match"},
+		{"out of order", "--- a/a.txt\n+++ b/a.txt\n@@ -2 +2 @@\n-c\n+d\n@@ -1 +1 @@\n-a\n+b\n", "hunk 2 (line 1) does not match"},
+		{"parent", "--- a/../outside/secret.txt\n+++ b/../outside/secret.txt\n@@ -1 +1 @@\n-secret\n+leak\n", "outside of the workspace"},
+		{"parent new file", "--- /dev/null\n+++ b/sub/../../escape.txt\n@@ -0,0 +1 @@\n+x\n", "outside of the workspace"},
+		{"absolute", "--- /dev/null\n+++ /tmp/escape.txt\n@@ -0,0 +1 @@\n+x\n", "outside of the workspace"},
+		{"link", "--- a/out/secret.txt\n+++ b/out/secret.txt\n@@ -1 +1 @@\n-secret\n+leak\n", "outside of the workspace"},
+		{"link new file", "--- /dev/null\n+++ b/out/new.txt\n@@ -0,0 +1 @@\n+x\n", "outside of the workspace"},
+		{"exists", "--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1 @@\n+x\n", "a.txt already exists"},
+		{"rename", "--- a/a.txt\n+++ b/b.txt\n" + hunk, "renaming a.txt to b.txt is not supported"},
+		{"partial delete", "--- a/a.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n", "deletion does not remove all lines"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, outside := newTestWorkspace(t, map[string]string{"a.txt": "a\nc\n"})
+			symlink(t, outside, filepath.Join(w.Root(), "out"))
+			// A valid change before the failing one is not applied either.
+			patch := "--- /dev/null\n+++ b/first.txt\n@@ -0,0 +1 @@\n+first\n" + tt.patch
+			_, err := w.ApplyPatch(patch)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+			if strings.Contains(tt.want, "outside") && !errors.Is(err, ErrOutside) {
+				t.Errorf("err = %v, want ErrOutside", err)
+			}
+			if got := readAll(t, w, "a.txt"); got != "a\nc\n" {
+				t.Errorf("a.txt = %q, want it unchanged", got)
+			}
+			if _, err := os.Stat(filepath.Join(w.Root(), "first.txt")); !os.IsNotExist(err) {
+				t.Errorf("first.txt created by a failed patch")
+			}
+			if data, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); string(data) != "secret\n" {
+				t.Errorf("secret.txt = %q", data)
+			}
+		})
+	}
+}
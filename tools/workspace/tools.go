@@ -0,0 +1,127 @@
+package workspace
+
+import (
+	"context"
+
+	"github.com/goplus/xgowiz/llm/tool"
+)
+
+// ReadFileArgs are the arguments of the read_file tool.
+type ReadFileArgs struct {
+	Path      string `json:"path" desc:"path of the file relative to the workspace root"`
+	StartLine int    `json:"start_line,omitempty" desc:"first line to read, starting at 1"`
+	EndLine   int    `json:"end_line,omitempty" desc:"last line to read, inclusive; the end of the file if omitted"`
+}
+
+// ListDirArgs are the arguments of the list_dir tool.
+type ListDirArgs struct {
+	Path  string `json:"path,omitempty" desc:"path of the directory relative to the workspace root; the root if omitted"`
+	Depth int    `json:"depth,omitempty" desc:"number of levels to list, 1 if omitted"`
+}
+
+// ListDirResult is the result of the list_dir tool.
+type ListDirResult struct {
+	Entries   []Entry `json:"entries"`
+	Truncated bool    `json:"truncated,omitempty"`
+}
+
+// GlobArgs are the arguments of the glob tool.
+type GlobArgs struct {
+	Pattern string `json:"pattern" desc:"slash-separated pattern relative to the workspace root, where ** matches any number of directories, e.g. **/*.xgo"`
+}
+
+// GlobResult is the result of the glob tool.
+type GlobResult struct {
+	Files     []string `json:"files"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+// GrepArgs are the arguments of the grep tool.
+type GrepArgs struct {
+	Pattern string `json:"pattern" desc:"regular expression in Go (RE2) syntax"`
+	Path    string `json:"path,omitempty" desc:"file or directory to search relative to the workspace root; the root if omitted"`
+	Include string `json:"include,omitempty" desc:"pattern the file names must match, e.g. *.xgo"`
+}
+
+// GrepResult is the result of the grep tool.
+type GrepResult struct {
+	Matches   []Match `json:"matches"`
+	Truncated bool    `json:"truncated,omitempty"`
+}
+
+// ApplyPatchArgs are the arguments of the apply_patch tool.
+type ApplyPatchArgs struct {
+	Patch string `json:"patch" desc:"unified diff with --- and +++ headers and @@ hunks; use /dev/null as the old path to create a file and as the new path to delete one"`
+}
+
+// ApplyPatchResult is the result of the apply_patch tool.
+type ApplyPatchResult struct {
+	Files []PatchResult `json:"files"`
+}
+
+// Register adds the tools to read the files of w to r, and the apply_patch
+// tool if writable is set.
+func Register(r *tool.Registry, w *Workspace, writable bool) error {
+	err := tool.Register(r, "read_file",
+		"Read a text file of the workspace, or a range of its lines.",
+		func(ctx context.Context, args ReadFileArgs) (*FileContent, error) {
+			return w.ReadFile(args.Path, args.StartLine, args.EndLine)
+		})
+	if err != nil {
+		return err
+	}
+	err = tool.Register(r, "list_dir",
+		"List the files and directories of a directory of the workspace.",
+		func(ctx context.Context, args ListDirArgs) (*ListDirResult, error) {
+			entries, truncated, err := w.ListDir(args.Path, args.Depth)
+			if err != nil {
+				return nil, err
+			}
+			if entries == nil {
+				entries = []Entry{}
+			}
+			return &ListDirResult{Entries: entries, Truncated: truncated}, nil
+		})
+	if err != nil {
+		return err
+	}
+	err = tool.Register(r, "glob",
+		"Find the files of the workspace whose paths match a pattern.",
+		func(ctx context.Context, args GlobArgs) (*GlobResult, error) {
+			files, truncated, err := w.Glob(args.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			if files == nil {
+				files = []string{}
+			}
+			return &GlobResult{Files: files, Truncated: truncated}, nil
+		})
+	if err != nil {
+		return err
+	}
+	err = tool.Register(r, "grep",
+		"Search the lines matching a regular expression in the text files of the workspace.",
+		func(ctx context.Context, args GrepArgs) (*GrepResult, error) {
+			matches, truncated, err := w.Grep(args.Pattern, args.Path, args.Include)
+			if err != nil {
+				return nil, err
+			}
+			if matches == nil {
+				matches = []Match{}
+			}
+			return &GrepResult{Matches: matches, Truncated: truncated}, nil
+		})
+	if err != nil || !writable {
+		return err
+	}
+	return tool.Register(r, "apply_patch",
+		"Edit, create or delete files of the workspace by applying a unified diff. Either all changes are applied or none.",
+		func(ctx context.Context, args ApplyPatchArgs) (*ApplyPatchResult, error) {
+			files, err := w.ApplyPatch(args.Patch)
+			if err != nil {
+				return nil, err
+			}
+			return &ApplyPatchResult{Files: files}, nil
+		})
+}
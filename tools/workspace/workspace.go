@@ -0,0 +1,406 @@
+// Package workspace provides tools to inspect and edit the files of a
+// project: read_file, list_dir, glob, grep and apply_patch. All paths are
+// relative to the root of the workspace, and the tools cannot reach files
+// outside of it, through .. or symbolic links.
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrOutside is returned for paths outside of the workspace.
+var ErrOutside = errors.New("path is outside of the workspace")
+
+// ErrBinary is returned when reading a binary file.
+var ErrBinary = errors.New("binary file")
+
+// Workspace is a directory whose files the tools can access.
+type Workspace struct {
+	root string // absolute, without symbolic links
+
+	// MaxFileSize limits the size of the files read, searched and patched.
+	// If zero, 1MiB is used.
+	MaxFileSize int64
+
+	// MaxResults limits the entries of list_dir and the matches of glob and
+	// grep. If zero, 500 is used.
+	MaxResults int
+}
+
+// New creates a workspace rooted at root.
+func New(root string) (*Workspace, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("workspace: %s is not a directory", root)
+	}
+	return &Workspace{root: abs}, nil
+}
+
+// Root returns the absolute path of the root directory.
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+func (w *Workspace) maxFileSize() int64 {
+	if w.MaxFileSize == 0 {
+		return 1 << 20
+	}
+	return w.MaxFileSize
+}
+
+func (w *Workspace) maxResults() int {
+	if w.MaxResults == 0 {
+		return 500
+	}
+	return w.MaxResults
+}
+
+// Resolve returns the absolute path of the file at the slash-separated
+// path rel, relative to the root. The file need not exist, but the part of
+// the path that exists must not leave the workspace.
+func (w *Workspace) Resolve(rel string) (string, error) {
+	if rel == "" {
+		rel = "."
+	}
+	if path.IsAbs(rel) || filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+		return "", fmt.Errorf("%s: %w (paths are relative to the workspace root)", rel, ErrOutside)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("%s: %w", rel, ErrOutside)
+		}
+	}
+	abs := filepath.Join(w.root, filepath.FromSlash(rel))
+
+	// Resolve the symbolic links of the longest existing prefix.
+	existing, rest := abs, ""
+	for {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			abs = filepath.Join(real, rest)
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	if !w.contains(abs) {
+		return "", fmt.Errorf("%s: %w", rel, ErrOutside)
+	}
+	return abs, nil
+}
+
+func (w *Workspace) contains(abs string) bool {
+	rel, err := filepath.Rel(w.root, abs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// rel returns the slash-separated path of abs relative to the root.
+func (w *Workspace) rel(abs string) string {
+	rel, err := filepath.Rel(w.root, abs)
+	if err != nil {
+		return abs
+	}
+	return filepath.ToSlash(rel)
+}
+
+// readFile reads a text file of the workspace.
+func (w *Workspace) readFile(abs string) ([]byte, error) {
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", w.rel(abs))
+	}
+	if fi.Size() > w.maxFileSize() {
+		return nil, fmt.Errorf("%s is too large (%d bytes, limit %d)", w.rel(abs), fi.Size(), w.maxFileSize())
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(data) {
+		return nil, fmt.Errorf("%s: %w", w.rel(abs), ErrBinary)
+	}
+	return data, nil
+}
+
+// isBinary reports whether data looks like the content of a binary file:
+// it contains a NUL byte or is not valid UTF-8 in its first 8000 bytes.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+		// ignore the last rune if it is cut
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					data = data[:i]
+				}
+				break
+			}
+		}
+	}
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+// FileContent is the result of ReadFile.
+type FileContent struct {
+	Path       string `json:"path"`
+	Content    string `json:"content"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	TotalLines int    `json:"total_lines"`
+}
+
+// ReadFile reads the lines start to end (1-based and inclusive) of the file
+// at rel. A zero start means the first line and a zero end the last one.
+func (w *Workspace) ReadFile(rel string, start, end int) (*FileContent, error) {
+	abs, err := w.Resolve(rel)
+	if err != nil {
+		return nil, err
+	}
+	data, err := w.readFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if start <= 0 {
+		start = 1
+	}
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	ret := &FileContent{Path: w.rel(abs), StartLine: start, EndLine: end, TotalLines: len(lines)}
+	if start > end {
+		if start > len(lines) && len(lines) > 0 {
+			return nil, fmt.Errorf("start line %d is past the end of %s (%d lines)", start, ret.Path, len(lines))
+		}
+		ret.EndLine = start - 1
+		return ret, nil
+	}
+	ret.Content = strings.Join(lines[start-1:end], "")
+	return ret, nil
+}
+
+// Entry is an entry of a directory listing.
+type Entry struct {
+	Path string `json:"path"`
+	Type string `json:"type"` // file, dir or symlink
+	Size int64  `json:"size,omitempty"`
+}
+
+// ListDir lists the directory at rel, and its subdirectories down to depth
+// levels. Hidden directories such as .git are listed but not entered.
+func (w *Workspace) ListDir(rel string, depth int) (entries []Entry, truncated bool, err error) {
+	abs, err := w.Resolve(rel)
+	if err != nil {
+		return nil, false, err
+	}
+	if depth <= 0 {
+		depth = 1
+	}
+	var walk func(dir string, level int) error
+	walk = func(dir string, level int) error {
+		des, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, de := range des {
+			if len(entries) >= w.maxResults() {
+				truncated = true
+				return nil
+			}
+			p := filepath.Join(dir, de.Name())
+			e := Entry{Path: w.rel(p), Type: "file"}
+			switch {
+			case de.Type()&fs.ModeSymlink != 0:
+				e.Type = "symlink"
+			case de.IsDir():
+				e.Type = "dir"
+			default:
+				if fi, err := de.Info(); err == nil {
+					e.Size = fi.Size()
+				}
+			}
+			entries = append(entries, e)
+			if e.Type == "dir" && level < depth && !strings.HasPrefix(de.Name(), ".") {
+				if err := walk(p, level+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err = walk(abs, 1)
+	return
+}
+
+// walk calls fn for the regular files under the directory abs, skipping
+// hidden directories. Symbolic links are not followed. It stops when fn
+// returns false.
+func (w *Workspace) walk(abs string, fn func(path string, d fs.DirEntry) bool) error {
+	err := filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == abs {
+				return err
+			}
+			return nil // skip unreadable entries
+		}
+		if d.IsDir() {
+			if p != abs && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if !fn(p, d) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return err
+}
+
+// Glob returns the files matching pattern, a slash-separated path pattern
+// as in path.Match where ** matches any number of directories.
+func (w *Workspace) Glob(pattern string) (matches []string, truncated bool, err error) {
+	if _, err = path.Match(pattern, ""); err != nil {
+		return nil, false, err
+	}
+	segs := strings.Split(path.Clean(pattern), "/")
+	for _, seg := range segs {
+		if seg == ".." {
+			return nil, false, fmt.Errorf("%s: %w", pattern, ErrOutside)
+		}
+	}
+	err = w.walk(w.root, func(p string, d fs.DirEntry) bool {
+		if matchPath(segs, strings.Split(w.rel(p), "/")) {
+			if len(matches) >= w.maxResults() {
+				truncated = true
+				return false
+			}
+			matches = append(matches, w.rel(p))
+		}
+		return true
+	})
+	sort.Strings(matches)
+	return
+}
+
+func matchPath(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchPath(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchPath(pattern[1:], name[1:])
+}
+
+// Match is a line matching a grep.
+type Match struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// Grep searches the regular expression expr in the files under the
+// directory or file rel whose base names match include, if not empty.
+// Binary and too large files are skipped.
+func (w *Workspace) Grep(expr, rel, include string) (matches []Match, truncated bool, err error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, false, err
+	}
+	if include != "" {
+		if _, err = path.Match(include, ""); err != nil {
+			return nil, false, err
+		}
+	}
+	abs, err := w.Resolve(rel)
+	if err != nil {
+		return nil, false, err
+	}
+	search := func(p string) bool {
+		if include != "" {
+			if ok, _ := path.Match(include, filepath.Base(p)); !ok {
+				return true
+			}
+		}
+		data, err := w.readFile(p)
+		if err != nil {
+			return true
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for n := 1; scanner.Scan(); n++ {
+			line := scanner.Text()
+			if !re.MatchString(line) {
+				continue
+			}
+			if len(matches) >= w.maxResults() {
+				truncated = true
+				return false
+			}
+			if len(line) > 500 {
+				line = line[:500] + "..."
+			}
+			matches = append(matches, Match{Path: w.rel(p), Line: n, Text: line})
+		}
+		return true
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, false, err
+	}
+	if !fi.IsDir() {
+		search(abs)
+		return
+	}
+	err = w.walk(abs, func(p string, d fs.DirEntry) bool {
+		return search(p)
+	})
+	return
+}
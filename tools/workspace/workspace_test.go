@@ -0,0 +1,165 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestWorkspace creates a workspace with files, given by their
+// slash-separated paths, next to a directory outside of it holding
+// secret.txt.
+func newTestWorkspace(t *testing.T, files map[string]string) (*Workspace, string) {
+	t.Helper()
+	dir := t.TempDir()
+	root, outside := filepath.Join(dir, "root"), filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, outside
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	w, outside := newTestWorkspace(t, map[string]string{"src/main.xgo": "echo 1\n"})
+	root := w.Root()
+	symlink(t, outside, filepath.Join(root, "out"))
+	symlink(t, filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret.txt"))
+	symlink(t, "../src", filepath.Join(root, "src", "self"))
+	symlink(t, "src", filepath.Join(root, "code"))
+
+	tests := []struct {
+		rel  string
+		want string // path relative to the root, or "" if outside
+	}{
+		{"", "."},
+		{".", "."},
+		{"src/main.xgo", "src/main.xgo"},
+		{"./src//main.xgo", "src/main.xgo"},
+		{"new/dir/file.xgo", "new/dir/file.xgo"},
+		{"code/main.xgo", "src/main.xgo"},
+		{"src/self/self/main.xgo", "src/main.xgo"},
+		{"code/new.xgo", "src/new.xgo"},
+		{"..", ""},
+		{"../outside/secret.txt", ""},
+		{"src/../../outside/secret.txt", ""},
+		{"src/../main.xgo", ""},
+		{"/etc/passwd", ""},
+		{"out", ""},
+		{"out/secret.txt", ""},
+		{"out/new.txt", ""},
+		{"out/new/dir/file.txt", ""},
+		{"secret.txt", ""},
+	}
+	for _, tt := range tests {
+		got, err := w.Resolve(tt.rel)
+		if tt.want == "" {
+			if !errors.Is(err, ErrOutside) {
+				t.Errorf("Resolve(%q) = %s, %v, want ErrOutside", tt.rel, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", tt.rel, err)
+			continue
+		}
+		if want := filepath.Join(root, filepath.FromSlash(tt.want)); got != want {
+			t.Errorf("Resolve(%q) = %s, want %s", tt.rel, got, want)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	w, outside := newTestWorkspace(t, map[string]string{
+		"a.txt":   "one\ntwo\nthree\n",
+		"bin.dat": "a\x00b",
+	})
+	symlink(t, filepath.Join(outside, "secret.txt"), filepath.Join(w.Root(), "link.txt"))
+	tests := []struct {
+		rel        string
+		start, end int
+		want       string // content, or error
+	}{
+		{"a.txt", 0, 0, "one\ntwo\nthree\n"},
+		{"a.txt", 2, 2, "two\n"},
+		{"a.txt", 2, 10, "two\nthree\n"},
+		{"a.txt", 5, 0, "start line 5 is past the end"},
+		{"bin.dat", 0, 0, "binary file"},
+		{"link.txt", 0, 0, "outside of the workspace"},
+		{"../outside/secret.txt", 0, 0, "outside of the workspace"},
+	}
+	for _, tt := range tests {
+		fc, err := w.ReadFile(tt.rel, tt.start, tt.end)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = fc.Content
+		}
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("ReadFile(%s, %d, %d) = %q, want %q", tt.rel, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestGlobGrep(t *testing.T) {
+	w, outside := newTestWorkspace(t, map[string]string{
+		"main.xgo":         "echo \"hello\"\n",
+		"pkg/a/util.xgo":   "func hello() {}\n",
+		"pkg/a/b/deep.xgo": "// nothing\n",
+		".git/config.xgo":  "hello\n",
+	})
+	symlink(t, outside, filepath.Join(w.Root(), "out"))
+
+	matches, _, err := w.Glob("**/*.xgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(matches, " "); got != "main.xgo pkg/a/b/deep.xgo pkg/a/util.xgo" {
+		t.Errorf("Glob = %s", got)
+	}
+	if _, _, err = w.Glob("../**"); !errors.Is(err, ErrOutside) {
+		t.Errorf("Glob(../**): err = %v", err)
+	}
+
+	found, _, err := w.Grep("hel+o", "", "*.xgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range found {
+		got = append(got, m.Path)
+	}
+	if strings.Join(got, " ") != "main.xgo pkg/a/util.xgo" {
+		t.Errorf("Grep = %v", found)
+	}
+	if _, _, err = w.Grep("secret", "out", ""); !errors.Is(err, ErrOutside) {
+		t.Errorf("Grep in a link to outside: err = %v", err)
+	}
+}
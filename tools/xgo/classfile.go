@@ -0,0 +1,224 @@
+package xgo
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A classfile (.gox) declares a class: its first var block declares the
+// fields and its funcs are the methods, whose receiver is named this. The
+// conversions below work on the Go-compatible subset of XGo.
+
+// ToClassfile converts the struct type class of src and its methods into a
+// classfile. It returns the name of the classfile and its source.
+func ToClassfile(filename string, src []byte, class string) (string, []byte, error) {
+	fset := token.NewFileSet()
+	f, shift, err := parseGo(fset, filename, src)
+	if err != nil {
+		return "", nil, subsetError(err)
+	}
+	off := func(pos token.Pos) int {
+		return fset.Position(pos).Offset - shift
+	}
+
+	var edits []edit
+	var found bool
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.VAR {
+				return "", nil, fmt.Errorf("var declarations would become fields of %s, move them out first", class)
+			}
+			spec, st := structSpec(d, class)
+			if spec == nil {
+				continue
+			}
+			if len(d.Specs) > 1 {
+				return "", nil, fmt.Errorf("type %s is declared in a group, move it out first", class)
+			}
+			if spec.TypeParams != nil {
+				return "", nil, fmt.Errorf("type %s is generic, classes cannot be", class)
+			}
+			var sb strings.Builder
+			sb.WriteString("var (\n")
+			for _, field := range st.Fields.List {
+				start := field.Pos()
+				if field.Doc != nil {
+					start = field.Doc.Pos()
+				}
+				sb.WriteString("\t")
+				sb.Write(src[off(start):off(field.Type.End())])
+				if field.Comment != nil {
+					sb.WriteString(" ")
+					sb.Write(src[off(field.Comment.Pos()):off(field.Comment.End())])
+				}
+				sb.WriteString("\n")
+			}
+			sb.WriteString(")")
+			edits = append(edits, edit{off(d.Pos()), off(d.End()), sb.String()})
+			found = true
+		case *ast.FuncDecl:
+			recv := receiverOf(d, class)
+			if recv == nil {
+				return "", nil, fmt.Errorf("func %s is not a method of %s and would become one, move it out first", d.Name.Name, class)
+			}
+			edits = append(edits, edit{off(d.Recv.Pos()), off(d.Name.Pos()), ""})
+			if len(recv.Names) == 1 && recv.Names[0].Name != "this" && recv.Names[0].Name != "_" {
+				obj := recv.Names[0].Obj
+				ast.Inspect(d.Body, func(n ast.Node) bool {
+					if id, ok := n.(*ast.Ident); ok && id.Obj == obj && obj != nil {
+						edits = append(edits, edit{off(id.Pos()), off(id.End()), "this"})
+					}
+					return true
+				})
+			}
+		}
+	}
+	if !found {
+		return "", nil, fmt.Errorf("struct type %s not found", class)
+	}
+	return class + ".gox", formatSource(applyEdits(src, edits)), nil
+}
+
+// FromClassfile converts the classfile src into a struct type and its
+// methods. If class is empty, it is derived from the file name, e.g. Rect
+// for Rect.gox or Rect_yap.gox.
+func FromClassfile(filename string, src []byte, class string) (string, []byte, error) {
+	if class == "" {
+		class = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+		class, _, _ = strings.Cut(class, "_")
+	}
+	if !token.IsIdentifier(class) {
+		return "", nil, fmt.Errorf("invalid class name %q", class)
+	}
+	fset := token.NewFileSet()
+	f, shift, err := parseGo(fset, filename, src)
+	if err != nil {
+		return "", nil, subsetError(err)
+	}
+	off := func(pos token.Pos) int {
+		return fset.Position(pos).Offset - shift
+	}
+
+	var edits []edit
+	fields := false
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.VAR || fields {
+				continue
+			}
+			fields = true
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "type %s struct {\n", class)
+			for _, spec := range d.Specs {
+				spec := spec.(*ast.ValueSpec)
+				if len(spec.Values) > 0 || spec.Type == nil {
+					return "", nil, fmt.Errorf("field %s must have a type and no initial value", spec.Names[0].Name)
+				}
+				start := spec.Pos()
+				if spec.Doc != nil {
+					start = spec.Doc.Pos()
+				}
+				sb.WriteString("\t")
+				sb.Write(src[off(start):off(spec.Type.End())])
+				if spec.Comment != nil {
+					sb.WriteString(" ")
+					sb.Write(src[off(spec.Comment.Pos()):off(spec.Comment.End())])
+				}
+				sb.WriteString("\n")
+			}
+			sb.WriteString("}")
+			edits = append(edits, edit{off(d.Pos()), off(d.End()), sb.String()})
+		case *ast.FuncDecl:
+			if d.Recv != nil {
+				return "", nil, fmt.Errorf("func %s has a receiver, classfile methods have none", d.Name.Name)
+			}
+			edits = append(edits, edit{off(d.Name.Pos()), off(d.Name.Pos()), "(this *" + class + ") "})
+		}
+	}
+	if !fields {
+		// a class without fields
+		edits = append(edits, edit{len(src), len(src), "\ntype " + class + " struct{}\n"})
+	}
+	name := strings.ToLower(class[:1]) + class[1:] + ".xgo"
+	return name, formatSource(applyEdits(src, edits)), nil
+}
+
+func structSpec(d *ast.GenDecl, class string) (*ast.TypeSpec, *ast.StructType) {
+	if d.Tok != token.TYPE {
+		return nil, nil
+	}
+	for _, spec := range d.Specs {
+		spec := spec.(*ast.TypeSpec)
+		if spec.Name.Name != class {
+			continue
+		}
+		if st, ok := spec.Type.(*ast.StructType); ok {
+			return spec, st
+		}
+	}
+	return nil, nil
+}
+
+func receiverOf(d *ast.FuncDecl, class string) *ast.Field {
+	if d.Recv == nil || len(d.Recv.List) != 1 {
+		return nil
+	}
+	recv := d.Recv.List[0]
+	typ := recv.Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if id, ok := typ.(*ast.Ident); ok && id.Name == class {
+		return recv
+	}
+	return nil
+}
+
+func subsetError(err error) error {
+	return fmt.Errorf("only the Go-compatible subset of XGo can be converted: %v", err)
+}
+
+type edit struct {
+	start, end int
+	text       string
+}
+
+func applyEdits(src []byte, edits []edit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		if e.start < last { // overlaps a previous edit
+			continue
+		}
+		buf.Write(src[last:e.start])
+		buf.WriteString(e.text)
+		last = e.end
+	}
+	buf.Write(src[last:])
+	return buf.Bytes()
+}
+
+// formatSource formats src as Go if it is valid Go, with or without a
+// package clause.
+func formatSource(src []byte) []byte {
+	if out, err := format.Source(src); err == nil {
+		return out
+	}
+	const clause = "package main\n"
+	out, err := format.Source(append([]byte(clause), src...))
+	if err != nil || !bytes.HasPrefix(out, []byte(clause)) {
+		return src
+	}
+	return bytes.TrimLeft(out[len(clause):], "\n")
+}
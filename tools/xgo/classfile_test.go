@@ -0,0 +1,134 @@
+package xgo
+
+import (
+	"strings"
+	"testing"
+)
+
+const rectGo = `import "fmt"
+
+// Rect is a rectangle.
+type Rect struct {
+	// Width of the rectangle
+	W float64
+	H float64 // height
+}
+
+func (r *Rect) Area() float64 {
+	return r.W * r.H
+}
+
+func (_ Rect) String() string {
+	return fmt.Sprint("rect")
+}
+`
+
+const rectGox = `import "fmt"
+
+// Rect is a rectangle.
+var (
+	// Width of the rectangle
+	W float64
+	H float64 // height
+)
+
+func Area() float64 {
+	return this.W * this.H
+}
+
+func String() string {
+	return fmt.Sprint("rect")
+}
+`
+
+func TestToClassfile(t *testing.T) {
+	name, got, err := ToClassfile("rect.xgo", []byte(rectGo), "Rect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Rect.gox" {
+		t.Errorf("name = %s, want Rect.gox", name)
+	}
+	if string(got) != rectGox {
+		t.Errorf("ToClassfile() =\n%s\nwant\n%s", got, rectGox)
+	}
+}
+
+func TestToClassfileErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"not found", "type Other struct{}\n", "struct type Rect not found"},
+		{"var", "var x int\ntype Rect struct{}\n", "var declarations would become fields"},
+		{"group", "type (\n\tRect struct{}\n\tOther int\n)\n", "declared in a group"},
+		{"generic", "type Rect[T any] struct{ v T }\n", "is generic"},
+		{"func", "type Rect struct{}\nfunc helper() {}\n", "func helper is not a method of Rect"},
+		{"other method", "type Rect struct{}\ntype Other int\nfunc (o Other) M() {}\n", "func M is not a method of Rect"},
+		{"not go", "type Rect struct{}\nprintln \"hi\"\n", "only the Go-compatible subset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ToClassfile("rect.xgo", []byte(tt.src), "Rect")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromClassfile(t *testing.T) {
+	name, got, err := FromClassfile("Rect.gox", []byte(rectGox), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "rect.xgo" {
+		t.Errorf("name = %s, want rect.xgo", name)
+	}
+	// Methods take a pointer receiver named this.
+	want := strings.NewReplacer("(r *Rect)", "(this *Rect)", "(_ Rect)", "(this *Rect)", "r.", "this.").Replace(rectGo)
+	if string(got) != want {
+		t.Errorf("FromClassfile() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFromClassfileName(t *testing.T) {
+	tests := []struct {
+		filename, class string
+		name, want      string // file name and type declared, or error
+	}{
+		{"Rect_yap.gox", "", "rect.xgo", "type Rect struct{}"},
+		{"dir/Shape.gox", "", "shape.xgo", "type Shape struct{}"},
+		{"main.gox", "Game", "game.xgo", "type Game struct{}"},
+		{"my-class.gox", "", "", `invalid class name "my-class"`},
+	}
+	for _, tt := range tests {
+		name, got, err := FromClassfile(tt.filename, []byte("func Run() {}\n"), tt.class)
+		if err != nil {
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("FromClassfile(%s): err = %v, want %q", tt.filename, err, tt.want)
+			}
+			continue
+		}
+		if name != tt.name || !strings.Contains(string(got), tt.want) {
+			t.Errorf("FromClassfile(%s) = %s\n%s\nwant %s with %s", tt.filename, name, got, tt.name, tt.want)
+		}
+	}
+}
+
+func TestFromClassfileErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"initial value", "var (\n\tN int = 1\n)\n", "field N must have a type and no initial value"},
+		{"no type", "var (\n\tN = 1\n)\n", "field N must have a type"},
+		{"receiver", "type T int\nfunc (t T) M() {}\n", "func M has a receiver"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := FromClassfile("Rect.gox", []byte(tt.src), "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
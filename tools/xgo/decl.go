@@ -0,0 +1,107 @@
+package xgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// Decl describes a top-level declaration.
+type Decl struct {
+	Kind      string `json:"kind"` // func, method, type, var or const
+	Name      string `json:"name"`
+	Receiver  string `json:"receiver,omitempty"`
+	Signature string `json:"signature,omitempty"` // type of funcs and methods, type of vars and consts if given
+	Line      int    `json:"line,omitempty"`
+}
+
+// parseGo parses src as Go. XGo files may omit the package clause, so
+// "package main" is inserted if it is missing. The returned shift is the
+// number of bytes inserted.
+func parseGo(fset *token.FileSet, filename string, src []byte) (f *ast.File, shift int, err error) {
+	f, err = parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err == nil || hasPackageClause(src) {
+		return
+	}
+	const clause = "package main;"
+	f, err = parser.ParseFile(fset, filename, append([]byte(clause), src...), parser.ParseComments)
+	return f, len(clause), err
+}
+
+func hasPackageClause(src []byte) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	return err == nil && f.Name != nil
+}
+
+// Declarations lists the top-level declarations of the XGo source src.
+// Sources in the Go-compatible subset of XGo are parsed directly, others
+// are translated to Go by the toolchain first.
+func Declarations(ctx context.Context, tc *Toolchain, filename string, src []byte) ([]Decl, []Diagnostic, error) {
+	fset := token.NewFileSet()
+	f, _, err := parseGo(fset, filename, src)
+	if err != nil {
+		if tc == nil {
+			return nil, nil, fmt.Errorf("%w (parsing as Go: %v)", ErrNoToolchain, err)
+		}
+		gosrc, diags, err := tc.GoSource(ctx, filename, src)
+		if err != nil || diags != nil {
+			return nil, diags, err
+		}
+		fset = token.NewFileSet()
+		if f, err = parser.ParseFile(fset, filename, gosrc, 0); err != nil {
+			return nil, nil, err
+		}
+	}
+	return declsOf(fset, f), nil, nil
+}
+
+func declsOf(fset *token.FileSet, f *ast.File) []Decl {
+	var decls []Decl
+	line := func(pos token.Pos) int {
+		return fset.PositionFor(pos, true).Line
+	}
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			decl := Decl{Kind: "func", Name: d.Name.Name, Signature: nodeString(fset, d.Type), Line: line(d.Pos())}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				decl.Kind = "method"
+				decl.Receiver = nodeString(fset, d.Recv.List[0].Type)
+			}
+			decls = append(decls, decl)
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					decls = append(decls, Decl{Kind: "type", Name: spec.Name.Name, Line: line(spec.Pos())})
+				case *ast.ValueSpec:
+					var typ string
+					if spec.Type != nil {
+						typ = nodeString(fset, spec.Type)
+					}
+					for _, name := range spec.Names {
+						if name.Name == "_" {
+							continue
+						}
+						decls = append(decls, Decl{Kind: d.Tok.String(), Name: name.Name, Signature: typ, Line: line(name.Pos())})
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
+
+func nodeString(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, node)
+	return strings.TrimSpace(buf.String())
+}
@@ -0,0 +1,226 @@
+package xgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sandbox runs the XGo toolchain on code in a temporary module, with
+// limited time and resources and, where the platform allows, without
+// network access.
+type Sandbox struct {
+	// Toolchain runs the commands. It must not be nil.
+	Toolchain *Toolchain
+
+	// Timeout limits the wall time of a command. If zero, 60s is used.
+	Timeout time.Duration
+
+	// CPUTime limits the CPU time of each process. If zero, the time is
+	// only limited by Timeout.
+	CPUTime time.Duration
+
+	// Memory limits the virtual memory of each process in bytes. If zero,
+	// 4GiB is used.
+	Memory int64
+
+	// MaxOutput limits the size of stdout and stderr each. If zero, 64KiB
+	// is used.
+	MaxOutput int
+
+	// AllowNetwork allows the code to access the network and the
+	// toolchain to download modules.
+	AllowNetwork bool
+}
+
+// SourceFile is a file of the temporary module.
+type SourceFile struct {
+	Name    string `json:"name" desc:"relative path of the file, such as main.xgo, Rect.gox or main_test.xgo"`
+	Content string `json:"content" desc:"content of the file"`
+}
+
+// RunResult is the result of running a command in the sandbox.
+type RunResult struct {
+	Command   string `json:"command"`
+	ExitCode  int    `json:"exit_code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	TimedOut  bool   `json:"timed_out,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"` // the output exceeded the limit
+	Duration  string `json:"duration"`
+	Note      string `json:"note,omitempty"`
+}
+
+// Build builds the module made of files.
+func (s *Sandbox) Build(ctx context.Context, files []SourceFile) (*RunResult, error) {
+	return s.run(ctx, files, "", "build", "-o", os.DevNull, ".")
+}
+
+// Run runs the main package made of files with args and stdin.
+func (s *Sandbox) Run(ctx context.Context, files []SourceFile, args []string, stdin string) (*RunResult, error) {
+	return s.run(ctx, files, stdin, append([]string{"run", "."}, args...)...)
+}
+
+// Test runs the tests of the module made of files. If pattern is not
+// empty, only the tests matching it are run.
+func (s *Sandbox) Test(ctx context.Context, files []SourceFile, pattern string) (*RunResult, error) {
+	args := []string{"test", "-v"}
+	if pattern != "" {
+		args = append(args, "-run", pattern)
+	}
+	return s.run(ctx, files, "", append(args, ".")...)
+}
+
+func (s *Sandbox) run(ctx context.Context, files []SourceFile, stdin string, args ...string) (*RunResult, error) {
+	if s.Toolchain == nil {
+		return nil, ErrNoToolchain
+	}
+	dir, err := writeModule(files)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name, cmdArgs, note := s.wrap(s.Toolchain.Path, args)
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
+	cmd.Dir = dir
+	cmd.Env = s.env(dir)
+	cmd.Stdin = strings.NewReader(stdin)
+	stdout := &limitedBuffer{max: s.maxOutput()}
+	stderr := &limitedBuffer{max: s.maxOutput()}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	setProcessGroup(cmd)
+
+	start := time.Now()
+	err = cmd.Run()
+	res := &RunResult{
+		Command:   filepath.Base(s.Toolchain.Path) + " " + strings.Join(args, " "),
+		Stdout:    stdout.String(),
+		Stderr:    strings.ReplaceAll(stderr.String(), dir+string(os.PathSeparator), ""),
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+		Truncated: stdout.truncated || stderr.truncated,
+		Duration:  time.Since(start).Round(time.Millisecond).String(),
+		Note:      note,
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitCode()
+	case res.TimedOut:
+		res.ExitCode = -1
+	default:
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Sandbox) maxOutput() int {
+	if s.MaxOutput == 0 {
+		return 64 << 10
+	}
+	return s.MaxOutput
+}
+
+// env returns a minimal environment for the toolchain. The caches of the
+// user are kept so that builds do not start from scratch.
+func (s *Sandbox) env(dir string) []string {
+	env := []string{
+		"HOME=" + dir,
+		"TMPDIR=" + os.TempDir(),
+		"CGO_ENABLED=0",
+		"GOTOOLCHAIN=local",
+		"GOFLAGS=-mod=mod",
+	}
+	for _, name := range []string{"PATH", "GOROOT", "XGOROOT", "GOPROOT", "GOPATH", "GOMODCACHE", "GOCACHE", "SYSTEMROOT"} {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	if _, ok := os.LookupEnv("GOCACHE"); !ok {
+		if cache, err := os.UserCacheDir(); err == nil {
+			env = append(env, "GOCACHE="+filepath.Join(cache, "go-build"))
+		}
+	}
+	if _, ok := os.LookupEnv("GOPATH"); !ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			env = append(env, "GOPATH="+filepath.Join(home, "go"))
+		}
+	}
+	if !s.AllowNetwork {
+		env = append(env, "GOPROXY=off")
+	}
+	return env
+}
+
+// writeModule writes files into a new temporary module.
+func writeModule(files []SourceFile) (string, error) {
+	if len(files) == 0 {
+		return "", errors.New("no files given")
+	}
+	dir, err := os.MkdirTemp("", "xgowiz-sandbox-")
+	if err != nil {
+		return "", err
+	}
+	hasMod := false
+	for _, f := range files {
+		name := filepath.Clean(filepath.FromSlash(f.Name))
+		if f.Name == "" || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(os.PathSeparator)) {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("invalid file name %q", f.Name)
+		}
+		hasMod = hasMod || name == "go.mod"
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+			err = os.WriteFile(path, []byte(f.Content), 0o644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	if !hasMod {
+		// not named main, which tests could not import
+		err = os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module sandbox\n\ngo 1.18\n"), 0o644)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.max - b.buf.Len(); n < len(p) {
+		b.truncated = true
+		if n > 0 {
+			b.buf.Write(p[:n])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
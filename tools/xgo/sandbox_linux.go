@@ -0,0 +1,28 @@
+package xgo
+
+import (
+	"os/exec"
+	"sync"
+)
+
+var (
+	unshareOnce sync.Once
+	unshareCmd  []string
+)
+
+// isolateNetwork returns the command prefix running a command in a new
+// network namespace, or nil if unprivileged user namespaces are not
+// available.
+func isolateNetwork() []string {
+	unshareOnce.Do(func() {
+		path, err := exec.LookPath("unshare")
+		if err != nil {
+			return
+		}
+		cmd := []string{path, "--user", "--map-root-user", "--net"}
+		if exec.Command(cmd[0], append(cmd[1:], "true")...).Run() == nil {
+			unshareCmd = cmd
+		}
+	})
+	return unshareCmd
+}
@@ -0,0 +1,7 @@
+//go:build unix && !linux
+
+package xgo
+
+func isolateNetwork() []string {
+	return nil
+}
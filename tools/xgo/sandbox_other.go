@@ -0,0 +1,13 @@
+//go:build !unix
+
+package xgo
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// wrap returns the command running path with args. Resource limits and
+// network isolation are not supported on this platform.
+func (s *Sandbox) wrap(path string, args []string) (string, []string, string) {
+	return path, args, "resource limits and network isolation are not supported on this system"
+}
@@ -0,0 +1,79 @@
+package xgo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteModule(t *testing.T) {
+	dir, err := writeModule([]SourceFile{
+		{Name: "main.xgo", Content: `echo "hi"`},
+		{Name: "shape/Rect.gox", Content: "var W int"},
+		{Name: "./sub/../util.xgo", Content: "func f() {}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, want := range map[string]string{
+		"main.xgo":       `echo "hi"`,
+		"shape/Rect.gox": "var W int",
+		"util.xgo":       "func f() {}",
+		"go.mod":         "module sandbox\n\ngo 1.18\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+
+	dir, err = writeModule([]SourceFile{{Name: "go.mod", Content: "module example.com/m\n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if data, _ := os.ReadFile(filepath.Join(dir, "go.mod")); string(data) != "module example.com/m\n" {
+		t.Errorf("go.mod = %q, want the one given", data)
+	}
+}
+
+func TestWriteModuleInvalidName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "invalid file name"},
+		{"..", "invalid file name"},
+		{"../escape.xgo", "invalid file name"},
+		{"a/../../escape.xgo", "invalid file name"},
+		{"/etc/passwd", "invalid file name"},
+		{"", "no files given"},
+	}
+	for i, tt := range tests {
+		var files []SourceFile
+		if i < len(tests)-1 {
+			files = []SourceFile{{Name: "main.xgo"}, {Name: tt.name}}
+		}
+		dir, err := writeModule(files)
+		if err == nil {
+			os.RemoveAll(dir)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("writeModule(%q): err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{max: 5}
+	for _, s := range []string{"abc", "def", "gh"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Errorf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if b.String() != "abcde" || !b.truncated {
+		t.Errorf("buffer = %q, truncated %v, want abcde, true", b.String(), b.truncated)
+	}
+}
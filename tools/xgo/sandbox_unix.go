@@ -0,0 +1,43 @@
+//go:build unix
+
+package xgo
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup runs cmd in its own process group, so that the processes
+// it starts are killed with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 2 * time.Second
+}
+
+// wrap returns the command running path with args under the resource
+// limits of the sandbox, and without network access if possible.
+func (s *Sandbox) wrap(path string, args []string) (name string, cmdArgs []string, note string) {
+	memory := s.Memory
+	if memory == 0 {
+		memory = 4 << 30
+	}
+	script := "ulimit -v " + strconv.FormatInt(memory>>10, 10)
+	if s.CPUTime > 0 {
+		script += "; ulimit -t " + strconv.FormatInt(int64((s.CPUTime+time.Second-1)/time.Second), 10)
+	}
+	script += `; exec "$0" "$@"`
+	name, cmdArgs = "/bin/sh", append([]string{"-c", script, path}, args...)
+	if !s.AllowNetwork {
+		if prefix := isolateNetwork(); prefix != nil {
+			name, cmdArgs = prefix[0], append(append(prefix[1:], name), cmdArgs...)
+		} else {
+			note = "network access could not be disabled on this system"
+		}
+	}
+	return
+}
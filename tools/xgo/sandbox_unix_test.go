@@ -0,0 +1,98 @@
+//go:build unix
+
+package xgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      Sandbox
+		script string
+	}{
+		{"default", Sandbox{AllowNetwork: true}, `ulimit -v 4194304; exec "$0" "$@"`},
+		{"limits", Sandbox{AllowNetwork: true, Memory: 1 << 30, CPUTime: 1500 * time.Millisecond},
+			`ulimit -v 1048576; ulimit -t 2; exec "$0" "$@"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, args, note := tt.s.wrap("/bin/xgo", []string{"run", "."})
+			want := []string{"-c", tt.script, "/bin/xgo", "run", "."}
+			if name != "/bin/sh" || !reflect.DeepEqual(args, want) || note != "" {
+				t.Errorf("wrap() = %s %q %q, want /bin/sh %q", name, args, note, want)
+			}
+		})
+	}
+
+	s := Sandbox{}
+	name, args, note := s.wrap("/bin/xgo", []string{"build"})
+	if prefix := isolateNetwork(); prefix != nil {
+		got := append([]string{name}, args...)
+		if !reflect.DeepEqual(got[:len(prefix)+1], append(prefix, "/bin/sh")) || note != "" {
+			t.Errorf("wrap() = %q %q, want it prefixed with %q", got, note, prefix)
+		}
+	} else if name != "/bin/sh" || !strings.Contains(note, "network access could not be disabled") {
+		t.Errorf("wrap() = %s, %q, want /bin/sh with a note", name, note)
+	}
+}
+
+// fakeToolchain returns a toolchain whose command prints its memory limit,
+// arguments, working directory files and stdin, or sleeps if its first
+// argument is sleep.
+func fakeToolchain(t *testing.T) *Toolchain {
+	path := filepath.Join(t.TempDir(), "xgo")
+	script := `#!/bin/sh
+if [ "$1" = sleep ]; then sleep 10; fi
+echo "limit $(ulimit -v)"
+echo "args $*"
+echo "files $(ls)"
+cat
+echo "failed $PWD/main.xgo" >&2
+exit 3
+`
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return &Toolchain{Path: path}
+}
+
+func TestSandboxRun(t *testing.T) {
+	s := &Sandbox{Toolchain: fakeToolchain(t), Memory: 1 << 30, AllowNetwork: true}
+	res, err := s.Run(context.Background(), []SourceFile{{Name: "main.xgo"}}, []string{"a", "b"}, "input\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "limit 1048576\nargs run . a b\nfiles go.mod\nmain.xgo\ninput\n"
+	if res.Stdout != want {
+		t.Errorf("stdout = %q, want %q", res.Stdout, want)
+	}
+	if res.Stderr != "failed main.xgo\n" {
+		t.Errorf("stderr = %q, want the sandbox directory removed", res.Stderr)
+	}
+	if res.ExitCode != 3 || res.TimedOut || res.Command != "xgo run . a b" {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestSandboxTimeout(t *testing.T) {
+	s := &Sandbox{Toolchain: fakeToolchain(t), Timeout: 200 * time.Millisecond, AllowNetwork: true}
+	start := time.Now()
+	res, err := s.run(context.Background(), []SourceFile{{Name: "main.xgo"}}, "", "sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.TimedOut || res.ExitCode != -1 {
+		t.Errorf("result = %+v, want timed out", res)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("run returned after %v", d)
+	}
+}
@@ -0,0 +1,160 @@
+package xgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNoToolchain is returned when no XGo toolchain is installed.
+var ErrNoToolchain = errors.New("xgo: toolchain not found, install xgo (https://github.com/goplus/xgo)")
+
+// Diagnostic is an error reported at a position of a source file.
+type Diagnostic struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (d *Diagnostic) String() string {
+	if d.Line == 0 {
+		return d.Message
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// Toolchain runs the commands of an installed XGo toolchain.
+type Toolchain struct {
+	// Path is the path of the xgo (or, for older releases, gop) command.
+	Path string
+}
+
+// FindToolchain looks for the xgo command, then for the gop command of
+// older releases, in PATH. It returns nil if neither is found.
+func FindToolchain() *Toolchain {
+	for _, name := range []string{"xgo", "gop"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return &Toolchain{Path: path}
+		}
+	}
+	return nil
+}
+
+// Format formats the XGo source src, like xgo fmt. If src has syntax
+// errors, they are returned as diagnostics.
+func (tc *Toolchain) Format(ctx context.Context, filename string, src []byte) ([]byte, []Diagnostic, error) {
+	if tc == nil {
+		return nil, nil, ErrNoToolchain
+	}
+	dir, file, err := tempSource(filename, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if out, err := tc.run(ctx, dir, "fmt", file); err != nil {
+		return nil, diagnostics(out, dir, filename, err), nil
+	}
+	formatted, err := os.ReadFile(filepath.Join(dir, file))
+	return formatted, nil, err
+}
+
+// GoSource translates the XGo source src into Go, like xgo go. The Go code
+// keeps line directives referring to filename.
+func (tc *Toolchain) GoSource(ctx context.Context, filename string, src []byte) ([]byte, []Diagnostic, error) {
+	if tc == nil {
+		return nil, nil, ErrNoToolchain
+	}
+	dir, file, err := tempSource(filename, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module main\n\ngo 1.18\n"), 0o644); err != nil {
+		return nil, nil, err
+	}
+	if out, err := tc.run(ctx, dir, "go", "."); err != nil {
+		return nil, diagnostics(out, dir, filename, err), nil
+	}
+	gens, _ := filepath.Glob(filepath.Join(dir, "*_autogen.go"))
+	if len(gens) == 0 {
+		return nil, nil, fmt.Errorf("xgo: %s go generated no Go file", filepath.Base(tc.Path))
+	}
+	gosrc, err := os.ReadFile(gens[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.ReplaceAll(gosrc, []byte(filepath.Join(dir, file)), []byte(filename)), nil, nil
+}
+
+func (tc *Toolchain) run(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, tc.Path, args...)
+	cmd.Dir = dir
+	return cmd.CombinedOutput()
+}
+
+// tempSource writes src to a new temporary directory, under the base name
+// of filename, defaulting to main.xgo.
+func tempSource(filename string, src []byte) (dir, file string, err error) {
+	file = filepath.Base(filename)
+	if filename == "" || !isSourceFile(file) {
+		file = "main.xgo"
+	}
+	if dir, err = os.MkdirTemp("", "xgowiz-"); err != nil {
+		return
+	}
+	if err = os.WriteFile(filepath.Join(dir, file), src, 0o644); err != nil {
+		os.RemoveAll(dir)
+	}
+	return
+}
+
+func isSourceFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".xgo", ".gop", ".gox", ".go":
+		return true
+	}
+	return false
+}
+
+var rePosition = regexp.MustCompile(`^(.+?):(\d+):(\d+):\s*(.*)$`)
+
+// diagnostics extracts the errors of the output of a failed command, with
+// the paths of the temporary directory dir replaced by filename.
+func diagnostics(out []byte, dir, filename string, err error) []Diagnostic {
+	var diags []Diagnostic
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m := rePosition.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		file := m[1]
+		if strings.HasPrefix(file, dir) || !strings.ContainsRune(file, os.PathSeparator) {
+			file = filename
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		diags = append(diags, Diagnostic{File: file, Line: lineNo, Column: col, Message: m[4]})
+	}
+	if len(diags) == 0 {
+		msg := strings.TrimSpace(strings.ReplaceAll(string(out), dir+string(os.PathSeparator), ""))
+		if msg == "" {
+			msg = err.Error()
+		}
+		diags = append(diags, Diagnostic{Message: msg})
+	}
+	return diags
+}
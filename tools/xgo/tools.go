@@ -0,0 +1,173 @@
+// Package xgo provides tools understanding XGo source code for the agent
+// loop: syntax checking, formatting, listing declarations and classfile
+// conversion, and building, running and testing code in a sandbox.
+//
+// Checking and formatting run the installed XGo toolchain (xgo, or gop for
+// older releases). Listing declarations and converting classfiles also work
+// without it for sources in the Go-compatible subset of XGo.
+package xgo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goplus/xgowiz/llm/tool"
+)
+
+// SourceArgs are the arguments of the tools working on a source file.
+type SourceArgs struct {
+	Source   string `json:"source" desc:"XGo source code"`
+	Filename string `json:"filename,omitempty" desc:"file name, such as main.xgo or Rect.gox; the extension selects the kind of file"`
+}
+
+// CheckResult is the result of the xgo_check tool.
+type CheckResult struct {
+	OK          bool         `json:"ok"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// FormatResult is the result of the xgo_format tool.
+type FormatResult struct {
+	Source      string       `json:"source,omitempty"`
+	Changed     bool         `json:"changed"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// DeclsResult is the result of the xgo_decls tool.
+type DeclsResult struct {
+	Decls       []Decl       `json:"decls"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// ClassfileArgs are the arguments of the xgo_classfile tool.
+type ClassfileArgs struct {
+	SourceArgs
+	To    string `json:"to" enum:"classfile,struct" desc:"classfile converts a struct type and its methods into a classfile, struct converts a classfile back"`
+	Class string `json:"class,omitempty" desc:"name of the class; required to convert to a classfile, derived from the file name otherwise"`
+}
+
+// ClassfileResult is the result of the xgo_classfile tool.
+type ClassfileResult struct {
+	Filename string `json:"filename"`
+	Source   string `json:"source"`
+}
+
+// Register adds the XGo source tools to r. tc may be nil if no toolchain
+// is installed; the tools needing it then fail with ErrNoToolchain.
+func Register(r *tool.Registry, tc *Toolchain) error {
+	err := tool.Register(r, "xgo_check",
+		"Check XGo source code for syntax and compile errors, reported with their positions.",
+		func(ctx context.Context, args SourceArgs) (*CheckResult, error) {
+			_, diags, err := tc.GoSource(ctx, filename(args.Filename), []byte(args.Source))
+			if err != nil {
+				return nil, err
+			}
+			return &CheckResult{OK: len(diags) == 0, Diagnostics: diags}, nil
+		})
+	if err != nil {
+		return err
+	}
+	err = tool.Register(r, "xgo_format",
+		"Format XGo source code like xgo fmt.",
+		func(ctx context.Context, args SourceArgs) (*FormatResult, error) {
+			out, diags, err := tc.Format(ctx, filename(args.Filename), []byte(args.Source))
+			if err != nil {
+				return nil, err
+			}
+			if diags != nil {
+				return &FormatResult{Diagnostics: diags}, nil
+			}
+			return &FormatResult{Source: string(out), Changed: string(out) != args.Source}, nil
+		})
+	if err != nil {
+		return err
+	}
+	err = tool.Register(r, "xgo_decls",
+		"List the top-level declarations (funcs, methods, types, vars and consts) of XGo source code with their lines.",
+		func(ctx context.Context, args SourceArgs) (*DeclsResult, error) {
+			decls, diags, err := Declarations(ctx, tc, filename(args.Filename), []byte(args.Source))
+			if err != nil {
+				return nil, err
+			}
+			if decls == nil {
+				decls = []Decl{}
+			}
+			return &DeclsResult{Decls: decls, Diagnostics: diags}, nil
+		})
+	if err != nil {
+		return err
+	}
+	return tool.Register(r, "xgo_classfile",
+		"Convert between a struct type with methods and the equivalent XGo classfile (.gox), whose var block declares the fields and whose funcs are the methods.",
+		func(ctx context.Context, args ClassfileArgs) (*ClassfileResult, error) {
+			var name string
+			var out []byte
+			var err error
+			switch args.To {
+			case "classfile":
+				if args.Class == "" {
+					return nil, &tool.ArgumentError{Tool: "xgo_classfile", Err: fmt.Errorf("class is required")}
+				}
+				name, out, err = ToClassfile(filename(args.Filename), []byte(args.Source), args.Class)
+			case "struct":
+				name, out, err = FromClassfile(filename(args.Filename), []byte(args.Source), args.Class)
+			default:
+				return nil, &tool.ArgumentError{Tool: "xgo_classfile", Err: fmt.Errorf("invalid conversion %q", args.To)}
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &ClassfileResult{Filename: name, Source: string(out)}, nil
+		})
+}
+
+// BuildArgs are the arguments of the xgo_build tool.
+type BuildArgs struct {
+	Files []SourceFile `json:"files" desc:"files of the module; a go.mod is added if missing"`
+}
+
+// RunArgs are the arguments of the xgo_run tool.
+type RunArgs struct {
+	Files []SourceFile `json:"files" desc:"files of the main package; a go.mod is added if missing"`
+	Args  []string     `json:"args,omitempty" desc:"command line arguments"`
+	Stdin string       `json:"stdin,omitempty" desc:"standard input"`
+}
+
+// TestArgs are the arguments of the xgo_test tool.
+type TestArgs struct {
+	Files []SourceFile `json:"files" desc:"files of the package including its tests (*_test.xgo or *test.gox); a go.mod is added if missing"`
+	Run   string       `json:"run,omitempty" desc:"regular expression selecting the tests to run"`
+}
+
+// RegisterSandbox adds the tools building, running and testing code in sb
+// to r.
+func RegisterSandbox(r *tool.Registry, sb *Sandbox) error {
+	err := tool.Register(r, "xgo_build",
+		"Build XGo code with the local toolchain and report the compile errors.",
+		func(ctx context.Context, args BuildArgs) (*RunResult, error) {
+			return sb.Build(ctx, args.Files)
+		})
+	if err != nil {
+		return err
+	}
+	err = tool.Register(r, "xgo_run",
+		"Run an XGo program with the local toolchain, without network access and with limited time and memory, and return its output and exit code.",
+		func(ctx context.Context, args RunArgs) (*RunResult, error) {
+			return sb.Run(ctx, args.Files, args.Args, args.Stdin)
+		})
+	if err != nil {
+		return err
+	}
+	return tool.Register(r, "xgo_test",
+		"Run the tests of an XGo package with the local toolchain, without network access and with limited time and memory.",
+		func(ctx context.Context, args TestArgs) (*RunResult, error) {
+			return sb.Test(ctx, args.Files, args.Run)
+		})
+}
+
+func filename(name string) string {
+	if name == "" {
+		return "main.xgo"
+	}
+	return name
+}